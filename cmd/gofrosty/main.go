@@ -19,7 +19,91 @@ func main() {
 	case "install":
 		err := lib.InstallCmdRun(args)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "link":
+		err := lib.LinkCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "unlink":
+		err := lib.UnlinkCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "run":
+		err := lib.RunCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "pack":
+		err := lib.PackCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "publish":
+		err := lib.PublishCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "login":
+		err := lib.LoginCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "logout":
+		err := lib.LogoutCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "whoami":
+		err := lib.WhoamiCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "search":
+		err := lib.SearchCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "view":
+		err := lib.ViewCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "shrinkwrap":
+		err := lib.ShrinkwrapCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "ci":
+		err := lib.CICmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "import":
+		err := lib.ImportCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
+		}
+		os.Exit(0)
+	case "serve":
+		err := lib.ServeCmdRun(args)
+		if err != nil {
+			log.Fatal(lib.Redact(err.Error()))
 		}
 		os.Exit(0)
 	default:
@@ -30,5 +114,19 @@ func main() {
 
 func printUsage() {
 	fmt.Println("usage: frosty <command> [args]")
-	fmt.Println("  frosty install -- Install dependencies from npm-shrinkwrap.json")
+	fmt.Println("  frosty install    -- Install dependencies from npm-shrinkwrap.json or package.json")
+	fmt.Println("  frosty ci         -- Install exactly what the lockfile records into a clean node_modules")
+	fmt.Println("  frosty shrinkwrap -- Write npm-shrinkwrap.json from node_modules")
+	fmt.Println("  frosty import     -- Convert between yarn.lock, package-lock.json and npm-shrinkwrap.json")
+	fmt.Println("  frosty link       -- Register package, or link a registered package into node_modules")
+	fmt.Println("  frosty unlink     -- Unregister package, or restore a linked package from the cache")
+	fmt.Println("  frosty run        -- Run a script from package.json")
+	fmt.Println("  frosty pack       -- Create a publishable tarball of the package")
+	fmt.Println("  frosty publish    -- Pack the package and publish it to the registry")
+	fmt.Println("  frosty login      -- Log in to the registry, and save the token in ~/.npmrc")
+	fmt.Println("  frosty logout     -- Revoke the registry token, and remove it from npmrc")
+	fmt.Println("  frosty whoami     -- Print the username of the logged in user")
+	fmt.Println("  frosty search     -- Search the registry for packages")
+	fmt.Println("  frosty view       -- Show registry data of a package (ex: frosty view foo@^1 dependencies)")
+	fmt.Println("  frosty serve      -- Serve the cache as a read-only npm registry")
 }
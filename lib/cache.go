@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"os"
 	"path"
 )
@@ -64,7 +66,7 @@ func (c *Cache) Add(name, version string, pkg *Package) error {
 		return nil
 	}
 
-	cacheDir := path.Join(c.ModulesDir, name, pkg.Version)
+	cacheDir := path.Join(c.ModulesDir, name, cacheDirName(version, pkg))
 	if !IsDir(cacheDir) {
 		// Directory exists but is not in index.
 		err := os.MkdirAll(cacheDir, os.ModePerm)
@@ -79,6 +81,60 @@ func (c *Cache) Add(name, version string, pkg *Package) error {
 		}
 	}
 
+	// the module dir is changed by install scripts, the tarball it came from
+	// is kept as published (see CacheRegistry)
+	if pkg.Tarball != "" {
+		err := os.Rename(pkg.Tarball, TarballPath(cacheDir))
+		if err != nil {
+			err = CopyFile(pkg.Tarball, TarballPath(cacheDir))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	GetContext().Debug("CACHED %s@%s => %s", name, version, cacheDir)
 	return c.Index.Add(name, version, cacheDir)
 }
+
+// cacheDirName returns the directory a package cached under key is stored in,
+// within the directory of its module. Registry versions are stored by version.
+// Packages from anywhere else (ex: git, tarball URLs) are stored by version and
+// source, so they never share contents with the registry version.
+//
+//   1.2.0 (registry)               =>  1.2.0
+//   github:u/foo#<sha> (at 1.2.0)  =>  1.2.0-<sha1 of resolved>
+func cacheDirName(key string, pkg *Package) string {
+	if key == pkg.Version || pkg.Registry != "" {
+		return pkg.Version
+	}
+
+	source := pkg.Resolved
+	if source == "" {
+		source = key
+	}
+	sum := sha1.Sum([]byte(source))
+	return pkg.Version + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Remove deletes module cached in dir, along with every index entry which
+// points to it (ex: when its contents do not match a lockfile)
+func (c *Cache) Remove(name string, dir string) error {
+	if m, ok := c.Index.Modules[name]; ok {
+		for key, entry := range m.Index {
+			if entry == dir {
+				m.Delete(key)
+			}
+		}
+	}
+
+	GetContext().Debug("UNCACHED %s => %s", name, dir)
+	os.Remove(TarballPath(dir))
+	return os.RemoveAll(dir)
+}
+
+// TarballPath returns path of the tarball a module cached in dir was
+// downloaded as. Only modules downloaded from a registry have one.
+func TarballPath(dir string) string {
+	return dir + ".tgz"
+}
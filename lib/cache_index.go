@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"path"
 	"regexp"
+	"strings"
 )
 
 // CacheIndex manages local cache on disk
@@ -88,7 +89,13 @@ func (c *CacheIndex) Load() error {
 func (c *CacheIndex) Add(name string, version string, dir string) error {
 	m, ok := c.Modules[name]
 	if !ok {
-		m = NewModuleIndex(name, c.RootDir)
+		// scoped modules are indexed in a directory per scope (see Load)
+		root := c.RootDir
+		if parts := strings.Split(name, "/"); len(parts) > 1 {
+			root = path.Join(c.RootDir, parts[0])
+		}
+
+		m = NewModuleIndex(name, root)
 		c.Modules[name] = m
 	}
 
@@ -0,0 +1,422 @@
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sethmcl/gofrosty/vendor/nsemver"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// errNotInRegistry is returned for versions which upstream has not published
+var errNotInRegistry = errors.New("Not found")
+
+// CacheRegistry serves the contents of a Cache as a read-only npm registry.
+// Cached versions are served as the tarballs they were downloaded as, since
+// install scripts change cached module directories. Versions cached without
+// their tarball (ex: by older versions of frosty) are not served. When
+// Upstream is set, modules and versions missing from the cache are fetched
+// from it, and added to the cache once their tarball is downloaded.
+type CacheRegistry struct {
+	Cache    *Cache
+	Upstream *NpmRegistryClient
+
+	// dists remembers checksums of cached tarballs
+	dists map[string]*Dist
+	mu    sync.Mutex
+}
+
+// NewCacheRegistry creates registry serving cache. upstream may be nil.
+func NewCacheRegistry(cache *Cache, upstream *NpmRegistryClient) *CacheRegistry {
+	return &CacheRegistry{
+		Cache:    cache,
+		Upstream: upstream,
+		dists:    make(map[string]*Dist),
+	}
+}
+
+// ServeHTTP handles registry requests
+//
+//   GET /<name>                    -- packument
+//   GET /<name>/-/<name>-<ver>.tgz -- tarball
+//   GET /-/ping
+func (r *CacheRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	GetContext().Debug("%s %s", req.Method, req.URL.Path)
+
+	if req.Method != "GET" && req.Method != "HEAD" {
+		writeRegistryError(w, http.StatusMethodNotAllowed, "This registry is read-only")
+		return
+	}
+
+	p, err := url.PathUnescape(req.URL.EscapedPath())
+	if err != nil {
+		writeRegistryError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p = strings.TrimPrefix(p, "/")
+
+	if p == "-/ping" {
+		writeJSONResponse(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+
+	if i := strings.Index(p, "/-/"); i > 0 {
+		r.serveTarball(w, req, p[:i], p[i+3:])
+		return
+	}
+
+	if !isPackageName(p) {
+		writeRegistryError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	r.servePackument(w, req, p)
+}
+
+// isPackageName returns true for names and scoped names (ex: foo, @foo/bar)
+func isPackageName(name string) bool {
+	parts := strings.Split(name, "/")
+	if strings.HasPrefix(name, "@") {
+		return len(parts) == 2 && len(parts[0]) > 1 && parts[1] != ""
+	}
+	return len(parts) == 1 && name != "" && !strings.HasPrefix(name, ".")
+}
+
+// servePackument serves packument built from cached versions, merged with the
+// upstream packument when there is an upstream
+func (r *CacheRegistry) servePackument(w http.ResponseWriter, req *http.Request, name string) {
+	baseURL := registryBaseURL(req)
+	versions := make(map[string]interface{})
+	distTags := make(map[string]string)
+
+	if r.Upstream != nil {
+		packument, err := r.Upstream.GetPackument(name)
+		if err != nil {
+			GetContext().Info("Upstream packument for %s is unavailable (%s)", name, err.Error())
+		} else {
+			for version, manifest := range packument.Versions {
+				proxied := *manifest
+				proxied.Dist = &Dist{
+					Tarball:   genTarURL(baseURL, name, version),
+					Shasum:    manifest.Dist.Shasum,
+					Integrity: manifest.Dist.Integrity,
+				}
+				versions[version] = &proxied
+			}
+			for tag, version := range packument.DistTags {
+				distTags[tag] = version
+			}
+		}
+	}
+
+	cached, err := r.cachedManifests(name, baseURL)
+	if err != nil {
+		writeRegistryError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for version, manifest := range cached {
+		versions[version] = manifest
+	}
+
+	if len(versions) == 0 {
+		writeRegistryError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if _, ok := distTags["latest"]; !ok {
+		list := make([]string, 0, len(versions))
+		for version := range versions {
+			list = append(list, version)
+		}
+		if latest, err := nsemver.MatchLatest("*", list); err == nil {
+			distTags["latest"] = latest
+		}
+	}
+
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"name":      name,
+		"dist-tags": distTags,
+		"versions":  versions,
+	})
+}
+
+// cachedDirs returns cache directory of every cached version of a module which
+// has its tarball
+func (r *CacheRegistry) cachedDirs(name string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dirs := make(map[string]string)
+	module, ok := r.Cache.Index.Modules[name]
+	if !ok {
+		return dirs
+	}
+
+	// packages cached from git or tarball URLs are stored apart from the
+	// registry versions (see cacheDirName), and are not served
+	for _, dir := range module.Index {
+		pkg, err := LoadPackageFromDir(dir)
+		if err != nil || pkg.Name != name || pkg.Version == "" || path.Base(dir) != pkg.Version {
+			continue
+		}
+		if !IsFile(TarballPath(dir)) {
+			continue
+		}
+		dirs[pkg.Version] = dir
+	}
+
+	return dirs
+}
+
+// cachedManifests returns manifests of cached versions, as published in their
+// tarball. Fields added by the publisher (ex: _id) are removed, and dist
+// describes the tarball.
+func (r *CacheRegistry) cachedManifests(name string, baseURL string) (map[string]interface{}, error) {
+	manifests := make(map[string]interface{})
+
+	for version, dir := range r.cachedDirs(name) {
+		contents, err := readTarballManifest(TarballPath(dir))
+		if err != nil {
+			return nil, err
+		}
+
+		manifest := make(map[string]interface{})
+		err = json.Unmarshal(contents, &manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		for key := range manifest {
+			if strings.HasPrefix(key, "_") {
+				delete(manifest, key)
+			}
+		}
+
+		dist, err := r.dist(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest["dist"] = &Dist{
+			Tarball:   genTarURL(baseURL, name, version),
+			Shasum:    dist.Shasum,
+			Integrity: dist.Integrity,
+		}
+		manifests[version] = manifest
+	}
+
+	return manifests, nil
+}
+
+// dist returns checksums of the tarball of a cached module directory
+func (r *CacheRegistry) dist(dir string) (*Dist, error) {
+	r.mu.Lock()
+	dist, ok := r.dists[dir]
+	r.mu.Unlock()
+	if ok {
+		return dist, nil
+	}
+
+	f, err := os.Open(TarballPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sha1sum := sha1.New()
+	sha512sum := sha512.New()
+	_, err = io.Copy(io.MultiWriter(sha1sum, sha512sum), f)
+	if err != nil {
+		return nil, err
+	}
+
+	dist = &Dist{
+		Shasum:    hex.EncodeToString(sha1sum.Sum(nil)),
+		Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sha512sum.Sum(nil)),
+	}
+
+	r.mu.Lock()
+	r.dists[dir] = dist
+	r.mu.Unlock()
+
+	return dist, nil
+}
+
+// serveTarball serves the tarball of a cached version, or downloads it from upstream
+func (r *CacheRegistry) serveTarball(w http.ResponseWriter, req *http.Request, name string, file string) {
+	base := name[strings.LastIndex(name, "/")+1:]
+	version := strings.TrimSuffix(strings.TrimPrefix(file, base+"-"), ".tgz")
+	if !isPackageName(name) || version == file || !strings.HasSuffix(file, ".tgz") {
+		writeRegistryError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if dir, ok := r.cachedDirs(name)[version]; ok {
+		f, err := os.Open(TarballPath(dir))
+		if err != nil {
+			writeRegistryError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.Copy(w, f)
+		return
+	}
+
+	if r.Upstream == nil {
+		writeRegistryError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	tarball, err := r.fetchUpstream(name, version)
+	if err != nil {
+		status := http.StatusBadGateway
+		if err == errNotInRegistry || IsHTTPStatus(err, http.StatusNotFound) {
+			status = http.StatusNotFound
+		}
+		writeRegistryError(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(tarball)
+}
+
+// fetchUpstream downloads tarball of a version from upstream, and adds it to the
+// cache. The original tarball is returned, so its checksums match the ones
+// advertised by upstream.
+func (r *CacheRegistry) fetchUpstream(name string, version string) ([]byte, error) {
+	packument, err := r.Upstream.GetPackument(name)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, ok := packument.Versions[version]
+	if !ok {
+		return nil, errNotInRegistry
+	}
+
+	tarURL := manifest.Dist.Tarball
+	if tarURL == "" {
+		tarURL = genTarURL(manifest.Registry, name, manifest.Version)
+	}
+
+	var tarball []byte
+	err = r.Upstream.Download(tarURL, nil, func(res *http.Response) error {
+		var err error
+		tarball, err = ioutil.ReadAll(res.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "frosty-serve")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pkgDir := path.Join(tmpDir, "package")
+	err = ExtractTar(bytes.NewReader(tarball), pkgDir, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := LoadPackageFromDir(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg.Tarball = path.Join(tmpDir, "package.tgz")
+	err = ioutil.WriteFile(pkg.Tarball, tarball, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.Cache.Add(name, manifest.Version, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	return tarball, r.Cache.Index.Commit()
+}
+
+// readTarballManifest returns contents of package.json in a package tarball
+func readTarballManifest(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gzf, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gzf.Close()
+
+	// entries are under a single top level directory, usually package/
+	tarReader := tar.NewReader(gzf)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No package.json in %s", file)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parts := strings.SplitN(path.Clean(header.Name), "/", 2)
+		if len(parts) == 2 && parts[1] == "package.json" {
+			return ioutil.ReadAll(tarReader)
+		}
+	}
+}
+
+// registryBaseURL returns URL the request was sent to, without path
+func registryBaseURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, req.Host)
+}
+
+func writeRegistryError(w http.ResponseWriter, status int, message string) {
+	writeJSONResponse(w, status, map[string]string{"error": message})
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, body interface{}) {
+	bytes, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		bytes = []byte(`{"error":"Unable to encode response"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// CICmdRun installs exactly what the lockfile records into a clean
+// node_modules, for continuous integration. Unlike install, it fails when
+// there is no lockfile or when it is out of sync with package.json, never
+// writes lockfiles, and fails as soon as a package cannot be installed, even
+// with --force. It accepts the flags of install.
+//
+//   frosty ci [-registry url] [-frosty-home dir]
+func CICmdRun(args []string) error {
+	ctx := GetContext()
+
+	// the lockfile is mandatory, and must be left as it is. Flags are not
+	// parsed past the first argument, so the forced ones go first, and are
+	// applied again in case a later flag changed them.
+	err := InstallCmdInit(append([]string{"-shrinkwrap", "-save=false"}, args...))
+	if err != nil {
+		return err
+	}
+
+	if !ctx.UseShrinkwrap || ctx.ShrinkwrapPath == "" {
+		return fmt.Errorf("%s has no npm-shrinkwrap.json, package-lock.json or yarn.lock", ctx.Cwd)
+	}
+	ctx.SaveLockfiles = false
+	ctx.SavePackageLock = false
+	ctx.Force = false
+
+	ctx.Debug(ctx.String())
+
+	pkg, err := LoadPackage(path.Join(ctx.Cwd, "package.json"))
+	if err != nil {
+		return err
+	}
+
+	ctx.Workspaces, err = LoadWorkspaces(pkg)
+	if err != nil {
+		return err
+	}
+
+	graph, _, err := LoadLockGraph(ctx.ShrinkwrapPath)
+	if err != nil {
+		return err
+	}
+
+	problems := graph.Unsatisfied(pkg, ctx.Workspaces)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is out of sync with package.json, run frosty install to update it:\n  %s",
+			ctx.ShrinkwrapPath, strings.Join(problems, "\n  "))
+	}
+
+	// packages left from earlier installs would be kept as they are
+	dirs := []string{ctx.NodeModulesDir}
+	for _, name := range SortedWorkspaceNames(ctx.Workspaces) {
+		dirs = append(dirs, path.Join(ctx.Workspaces[name].Dir, "node_modules"))
+	}
+	for _, dir := range dirs {
+		ctx.Debug("Removing %s", dir)
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx.Debug("Installing modules from %s...", ctx.ShrinkwrapPath)
+	ictx := NewInstallContext()
+
+	err = installLockGraph(ctx, graph, ictx)
+	if err != nil {
+		return err
+	}
+
+	return finishInstall(ctx, ictx)
+}
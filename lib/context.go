@@ -2,6 +2,7 @@ package lib
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
@@ -13,20 +14,29 @@ var stdout *log.Logger
 
 // Context represents an instance of running frosty
 type Context struct {
-	Cache          *Cache
-	Cwd            string
-	Force          bool
-	FrostyHome     string
-	GoFrostyJSPath string
-	GoFrostyJS     *GoFrostyJS
-	NodeModulesDir string
-	NpmAuthToken   string
-	NpmRegistry    *NpmRegistryClient
-	PackagePath    string
-	ShrinkwrapPath string
-	UsePackage     bool
-	UseShrinkwrap  bool
-	Verbose        bool
+	Cache            *Cache
+	Cwd              string
+	FailOnDeprecated bool
+	Force            bool
+	FrostyHome       string
+	GoFrostyJSPath   string
+	GoFrostyJS       *GoFrostyJS
+	GitHosts         map[string]*GitHost
+	LockfileVersion  int
+	NodeModulesDir   string
+	NpmAuthToken     string
+	NpmRegistry      *NpmRegistryClient
+	Npmrc            *Npmrc
+	Output           io.Writer
+	PackagePath      string
+	SaveLockfiles    bool
+	SavePackageLock  bool
+	ShrinkwrapPath   string
+	UsePackage       bool
+	UseShrinkwrap    bool
+	Verbose          bool
+	Workspace        string
+	Workspaces       map[string]*Workspace
 }
 
 // GetContext returns Context singleton
@@ -34,19 +44,34 @@ func GetContext() *Context {
 	if instance == nil {
 		instance = &Context{}
 		instance.NpmAuthToken = GetNpmAuthToken()
+		RegisterSecret(instance.NpmAuthToken)
+		instance.GitHosts = NewGitHosts()
 		instance.NpmRegistry = NewNpmRegistryClient(
 			GetNpmRegistryURL(),
 			instance.NpmAuthToken)
 
-		stdout = log.New(os.Stdout, "", log.Ldate)
+		instance.Output = os.Stdout
+
+		stdout = log.New(NewRedactWriter(os.Stdout), "", log.Ldate)
 	}
 
 	return instance
 }
 
-// String returns string representation of the context object
+// SetLogOutput changes where log messages are written. Messages are redacted
+// before they reach w.
+func (c *Context) SetLogOutput(w io.Writer) {
+	stdout.SetOutput(NewRedactWriter(w))
+}
+
+// String returns string representation of the context object. Secrets are masked.
 func (c *Context) String() string {
-	return fmt.Sprintf(`<<Context>>
+	token := ""
+	if c.NpmAuthToken != "" {
+		token = RedactMask
+	}
+
+	return Redact(fmt.Sprintf(`<<Context>>
   Cache           = %s
   Cwd             = %s
   Force           = %t
@@ -60,6 +85,7 @@ func (c *Context) String() string {
   UsePackage      = %t
   UseShrinkwrap   = %t
   Verbose         = %t
+  Workspace       = %s
 `,
 		c.Cache.RootDir,
 		c.Cwd,
@@ -67,22 +93,31 @@ func (c *Context) String() string {
 		c.FrostyHome,
 		c.GoFrostyJSPath,
 		c.NodeModulesDir,
-		c.NpmAuthToken,
+		token,
 		c.NpmRegistry.RootURL,
 		c.PackagePath,
 		c.ShrinkwrapPath,
 		c.UsePackage,
 		c.UseShrinkwrap,
-		c.Verbose)
+		c.Verbose,
+		c.Workspace))
 }
 
-// Info prints log message
+// Info prints log message. Secrets are masked (see Redact).
 func (c *Context) Info(args ...interface{}) {
 	str := fmt.Sprintf(args[0].(string), args[1:]...)
 	stdout.Println(str)
 }
 
-// Debug prints debug log message
+// Print writes command output (ex: search results) to Output. Unlike log
+// messages, it has no date prefix. Registered secrets are masked (see
+// RedactSecrets), the rest is printed as is.
+func (c *Context) Print(args ...interface{}) {
+	str := fmt.Sprintf(args[0].(string), args[1:]...)
+	fmt.Fprintln(c.Output, RedactSecrets(str))
+}
+
+// Debug prints debug log message. Secrets are masked (see Redact).
 func (c *Context) Debug(args ...interface{}) {
 	if c.Verbose == true {
 		str := fmt.Sprintf(args[0].(string), args[1:]...)
@@ -3,6 +3,9 @@ package lib
 import (
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GetFrostyHome returns absolute path to default frosty home directory
@@ -33,3 +36,60 @@ func GetNpmRegistryURL() string {
 
 	return url
 }
+
+// GetGitHostURL returns FROSTY_<NAME>_URL environment variable, which
+// overrides the base URL of a git host (ex: FROSTY_GITHUB_URL for GitHub Enterprise).
+// If this is not set, then returns fallback
+func GetGitHostURL(name string, fallback string) string {
+	url := os.Getenv("FROSTY_" + strings.ToUpper(name) + "_URL")
+
+	if url == "" {
+		url = fallback
+	}
+
+	return url
+}
+
+// GetTagTTL returns FROSTY_TAG_TTL environment variable, which controls how long
+// dist-tag resolutions are cached. If this is not set, then returns 5 minutes
+func GetTagTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("FROSTY_TAG_TTL"))
+	if err != nil {
+		return 5 * time.Minute
+	}
+
+	return ttl
+}
+
+// GetPackumentMaxAge returns FROSTY_PACKUMENT_MAX_AGE environment variable, which
+// controls how long cached packuments are used before they are revalidated.
+// If this is not set, then returns 5 minutes
+func GetPackumentMaxAge() time.Duration {
+	maxAge, err := time.ParseDuration(os.Getenv("FROSTY_PACKUMENT_MAX_AGE"))
+	if err != nil {
+		return 5 * time.Minute
+	}
+
+	return maxAge
+}
+
+// GetFetchRetries returns how many times failed registry requests are retried
+func GetFetchRetries() int {
+	retries, err := strconv.Atoi(os.Getenv("FROSTY_FETCH_RETRIES"))
+	if err != nil || retries < 0 {
+		return 3
+	}
+
+	return retries
+}
+
+// GetEnvAny returns the first non-empty environment variable of names
+func GetEnvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Credential authorizes requests to URLs on Host whose path starts with Path.
+// Either Token (bearer) or Basic (base64 encoded user:password) is set. Host
+// has no port when it is the default port of the scheme, unless AnyPort is set
+// (ex: netrc machines), in which case Host matches every port.
+type Credential struct {
+	Host    string
+	Path    string
+	Token   string
+	Basic   string
+	Source  string
+	AnyPort bool
+}
+
+// Credentials holds every configured credential. A credential is only sent to
+// the host and port it was configured for.
+type Credentials struct {
+	Entries []*Credential
+}
+
+// NewCredentials creates an empty credential store
+func NewCredentials() *Credentials {
+	return &Credentials{}
+}
+
+// Header returns value of the authorization header
+func (c *Credential) Header() string {
+	if c.Token != "" {
+		return "Bearer " + c.Token
+	}
+	return "Basic " + c.Basic
+}
+
+// Add adds credential for URLs starting with prefix (ex: https://example.com/npm
+// or //example.com/npm/)
+func (c *Credentials) Add(prefix string, cred *Credential) {
+	u, err := url.Parse(prefix)
+	if err != nil || u.Host == "" {
+		return
+	}
+
+	RegisterSecret(cred.Token)
+	RegisterSecret(cred.Basic)
+	if decoded, err := base64.StdEncoding.DecodeString(cred.Basic); err == nil {
+		if i := strings.Index(string(decoded), ":"); i >= 0 {
+			RegisterSecret(string(decoded)[i+1:])
+		}
+	}
+
+	cred.Host = urlHost(u)
+	cred.Path = u.Path
+	if !strings.HasSuffix(cred.Path, "/") {
+		cred.Path += "/"
+	}
+
+	c.Entries = append(c.Entries, cred)
+
+	// longest path wins, and earlier sources win ties
+	sort.SliceStable(c.Entries, func(i, j int) bool {
+		return len(c.Entries[i].Path) > len(c.Entries[j].Path)
+	})
+}
+
+// Lookup returns credential for a URL, or nil when none is configured for it
+func (c *Credentials) Lookup(rawURL string) *Credential {
+	return c.find(rawURL, func(*Credential) bool { return true })
+}
+
+// find returns the best credential for a URL which is accepted by the filter
+func (c *Credentials) find(rawURL string, accept func(*Credential) bool) *Credential {
+	if c == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	host := urlHost(u)
+	hostname := strings.ToLower(u.Hostname())
+	p := u.Path
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+
+	for _, cred := range c.Entries {
+		if cred.Host != host && !(cred.AnyPort && cred.Host == hostname) {
+			continue
+		}
+		if accept(cred) && strings.HasPrefix(p, cred.Path) {
+			return cred
+		}
+	}
+	return nil
+}
+
+// urlHost returns host of u, lower cased and without the default port of its
+// scheme
+//
+//   https://Example.com:443/npm  =>  example.com
+//   https://example.com:8443/npm =>  example.com:8443
+func urlHost(u *url.URL) string {
+	host := strings.ToLower(u.Host)
+	port := u.Port()
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	return host
+}
+
+// LoadCredentials collects credentials from npmrc and netrc. npmrc credentials
+// are keyed by URL (ex: //example.com/npm/:_authToken), and only apply to the
+// port in the key, or to the default port when there is none. The unscoped
+// _authToken and _auth keys apply to the default registry. netrc credentials
+// apply to every port and path of their machine.
+//
+// always-auth makes npm send credentials with GET requests as well. Matching
+// credentials are always sent here, so it does not change anything.
+func LoadCredentials(npmrc *Npmrc, netrcPath string) (*Credentials, error) {
+	c := NewCredentials()
+
+	keys := make([]string, 0, len(npmrc.Values))
+	for key := range npmrc.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		i := strings.LastIndex(key, ":")
+		if !strings.HasPrefix(key, "//") || i < 0 {
+			continue
+		}
+		prefix, field := "https:"+key[:i], key[i+1:]
+		source := npmrc.Sources[key]
+
+		switch field {
+		case "_authToken":
+			c.Add(prefix, &Credential{Token: npmrc.Get(key), Source: source})
+		case "_auth":
+			c.Add(prefix, &Credential{Basic: npmrc.Get(key), Source: source})
+		case "_password":
+			username := npmrc.Get(key[:i] + ":username")
+			password, err := base64.StdEncoding.DecodeString(npmrc.Get(key))
+			if username == "" || err != nil {
+				return nil, fmt.Errorf("%s requires a username and base64 encoded password", key[:i])
+			}
+			basic := base64.StdEncoding.EncodeToString([]byte(username + ":" + string(password)))
+			c.Add(prefix, &Credential{Basic: basic, Source: source})
+		}
+	}
+
+	registry := npmrc.Registry()
+	if token := npmrc.Get("_authToken"); token != "" {
+		c.Add(registry, &Credential{Token: token, Source: npmrc.Sources["_authToken"]})
+	}
+	if auth := npmrc.Get("_auth"); auth != "" {
+		c.Add(registry, &Credential{Basic: auth, Source: npmrc.Sources["_auth"]})
+	}
+
+	if netrcPath != "" && IsFile(netrcPath) {
+		contents, err := ioutil.ReadFile(netrcPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for machine, login := range ParseNetrc(string(contents)) {
+			basic := base64.StdEncoding.EncodeToString([]byte(login[0] + ":" + login[1]))
+			c.Add("https://"+machine, &Credential{Basic: basic, Source: netrcPath, AnyPort: true})
+		}
+	}
+
+	return c, nil
+}
+
+// GetNetrcPath returns NETRC environment variable, or ~/.netrc
+func GetNetrcPath() string {
+	if netrc := os.Getenv("NETRC"); netrc != "" {
+		return netrc
+	}
+	return path.Join(os.Getenv("HOME"), ".netrc")
+}
+
+// ParseNetrc returns login and password of each machine in a netrc file. The
+// default entry is ignored, since it would send credentials to any host.
+func ParseNetrc(contents string) map[string][2]string {
+	machines := make(map[string][2]string)
+
+	var machine string
+	var login [2]string
+	flush := func() {
+		if machine != "" {
+			machines[strings.ToLower(machine)] = login
+		}
+		machine = ""
+		login = [2]string{}
+	}
+
+	lines := strings.Split(contents, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for j := 0; j < len(fields); j++ {
+			var value string
+			if j+1 < len(fields) {
+				value = fields[j+1]
+			}
+
+			switch fields[j] {
+			case "machine":
+				flush()
+				machine = value
+				j++
+			case "default":
+				flush()
+			case "login":
+				login[0] = value
+				j++
+			case "password":
+				login[1] = value
+				j++
+			case "account":
+				j++
+			case "macdef":
+				// macro definitions run until the next blank line
+				flush()
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	flush()
+
+	return machines
+}
@@ -6,7 +6,7 @@ import (
 	"math"
 	"os"
 	"path"
-	"regexp"
+	"path/filepath"
 	"strings"
 )
 
@@ -42,24 +42,6 @@ func IsDir(dir string) bool {
 	return stat.IsDir()
 }
 
-// IsTarURL returns true if url string points to a tar file
-func IsTarURL(url string) bool {
-	match, _ := regexp.MatchString("^http.*[\\.tar\\.gz|\\.tgz]$", url)
-	return match
-}
-
-// IsGitURL returns true if this module's URL is a git repository
-func IsGitURL(url string) bool {
-	match, _ := regexp.MatchString("^git\\+", url)
-	return match
-}
-
-// IsFileURL returns true if this module's URL is a local path on disk
-func IsFileURL(url string) bool {
-	match, _ := regexp.MatchString("^file:", url)
-	return match
-}
-
 // CopyFile copies a file
 func CopyFile(source string, dest string) error {
 	sourceFile, err := os.Open(source)
@@ -147,6 +129,38 @@ func CopyDirBlacklist(source string, dest string, blacklist []string) error {
 	return nil
 }
 
+// ListFilesBlacklist returns regular files under root, relative to it. Entries
+// at the top level of root which are in blacklist are skipped.
+func ListFilesBlacklist(root string, blacklist []string) ([]string, error) {
+	files := []string{}
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if path.Dir(rel) == "." && StringSliceContains(blacklist, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode().IsRegular() {
+			files = append(files, rel)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
 // Mkdirs creates 1..N directories. Returns error if any fail.
 func Mkdirs(dirs []string) error {
 	for _, dir := range dirs {
@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// GitHost describes a git hosting service which can be referenced using a
+// shorthand dependency specifier (ex: github:user/repo)
+type GitHost struct {
+	Name    string
+	BaseURL string
+}
+
+// HostedGit represents a dependency which lives in a repository on a GitHost
+type HostedGit struct {
+	Host       *GitHost
+	User       string
+	Project    string
+	Committish string
+}
+
+var hostedGitRe = regexp.MustCompile(
+	"^(?:([a-z]+):)?([^/@#:.\\s][^/#:\\s]*)/([^/#\\s]+?)(?:\\.git)?(?:#(.+))?$")
+
+// NewGitHosts returns the set of known git hosts, keyed by shortcut name.
+// Base URLs can be overridden using FROSTY_GITHUB_URL, FROSTY_GITLAB_URL and
+// FROSTY_BITBUCKET_URL.
+func NewGitHosts() map[string]*GitHost {
+	return map[string]*GitHost{
+		"github": &GitHost{
+			Name:    "github",
+			BaseURL: GetGitHostURL("github", "https://github.com"),
+		},
+		"gitlab": &GitHost{
+			Name:    "gitlab",
+			BaseURL: GetGitHostURL("gitlab", "https://gitlab.com"),
+		},
+		"bitbucket": &GitHost{
+			Name:    "bitbucket",
+			BaseURL: GetGitHostURL("bitbucket", "https://bitbucket.org"),
+		},
+	}
+}
+
+// ParseHostedGit parses a hosted git shorthand. The following forms are supported:
+//
+//   user/repo
+//   user/repo#v1.2.0
+//   github:user/repo
+//   gitlab:group/proj#main
+//   bitbucket:user/repo
+//
+// Returns false if the specifier is not a hosted git shorthand.
+func ParseHostedGit(spec string, hosts map[string]*GitHost) (*HostedGit, bool) {
+	m := hostedGitRe.FindStringSubmatch(spec)
+	if m == nil {
+		return nil, false
+	}
+
+	hostName := m[1]
+	if hostName == "" {
+		hostName = "github"
+	}
+
+	host, ok := hosts[hostName]
+	if !ok {
+		return nil, false
+	}
+
+	// users and refs are passed to git, which must never read them as options
+	if strings.HasPrefix(m[2], "-") || strings.HasPrefix(m[4], "-") {
+		return nil, false
+	}
+
+	return &HostedGit{
+		Host:       host,
+		User:       m[2],
+		Project:    m[3],
+		Committish: m[4],
+	}, true
+}
+
+// Ref returns the committish, or HEAD when none was specified
+func (h *HostedGit) Ref() string {
+	if h.Committish == "" {
+		return "HEAD"
+	}
+	return h.Committish
+}
+
+// TarballURL returns URL of archive for the referenced commit
+func (h *HostedGit) TarballURL() string {
+	base := strings.TrimSuffix(h.Host.BaseURL, "/")
+	ref := h.Ref()
+
+	switch h.Host.Name {
+	case "gitlab":
+		return fmt.Sprintf("%s/%s/%s/-/archive/%s/%s-%s.tar.gz",
+			base, h.User, h.Project, ref, h.Project, ref)
+	case "bitbucket":
+		return fmt.Sprintf("%s/%s/%s/get/%s.tar.gz", base, h.User, h.Project, ref)
+	default:
+		return fmt.Sprintf("%s/%s/%s/archive/%s.tar.gz", base, h.User, h.Project, ref)
+	}
+}
+
+// GitURL returns ssh clone URL of repository. This is used for private
+// repositories, where the archive cannot be downloaded anonymously.
+func (h *HostedGit) GitURL() string {
+	host := h.Host.BaseURL
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimSuffix(host, "/")
+	return fmt.Sprintf("git@%s:%s/%s.git", host, h.User, h.Project)
+}
+
+// String returns the canonical shorthand for this dependency
+func (h *HostedGit) String() string {
+	s := fmt.Sprintf("%s:%s/%s", h.Host.Name, h.User, h.Project)
+	if h.Committish != "" {
+		s += "#" + h.Committish
+	}
+	return s
+}
+
+// GitClone clones repository at url into dir, and checks out ref. The .git
+// directory is removed once the checkout completes.
+func GitClone(url string, ref string, dir string) error {
+	ctx := GetContext()
+
+	tmp, err := ioutil.TempDir("", "frosty-git")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// url and ref come from dependency specs, and are never read as options.
+	// checkout cannot tell options from refs, so ref is resolved to a commit
+	// first.
+	git := func(args ...string) (string, error) {
+		ctx.Debug("git %s", strings.Join(args, " "))
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			if len(out) > 0 {
+				ctx.Info(string(out))
+			}
+			return "", fmt.Errorf("git clone of %s#%s failed: %s", url, ref, err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	_, err = git("clone", "--quiet", "--", url, tmp)
+	if err != nil {
+		return err
+	}
+
+	// branches other than the default one only exist on origin after a clone
+	commit := ""
+	for _, rev := range []string{ref, "origin/" + ref} {
+		commit, err = git("-C", tmp, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = git("-C", tmp, "checkout", "--quiet", commit)
+	if err != nil {
+		return err
+	}
+
+	return CopyDirBlacklist(tmp, dir, []string{".git"})
+}
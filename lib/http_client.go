@@ -0,0 +1,450 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPConfig configures the transport used for registry and tarball requests.
+// HTTPSProxy is used for https URLs, and Proxy for the rest (or for https URLs
+// too, when HTTPSProxy is not set). NoProxy lists hosts which are reached
+// directly. CA, Cert and Key hold PEM data; CAFile, CertFile and KeyFile are
+// read from disk. ReadTimeout bounds the wait for response headers, and each
+// wait for more of the response body.
+type HTTPConfig struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Proxy          string
+	HTTPSProxy     string
+	NoProxy        string
+	StrictSSL      bool
+	CA             string
+	CAFile         string
+	Cert           string
+	CertFile       string
+	Key            string
+	KeyFile        string
+}
+
+// HTTPError is returned when a request fails, after all retries are used up
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+// Error returns string representation of the error
+func (e *HTTPError) Error() string {
+	reason := fmt.Sprintf("HTTP %d response", e.StatusCode)
+	if e.Err != nil {
+		reason = e.Err.Error()
+	}
+
+	attempts := "attempt"
+	if e.Attempts != 1 {
+		attempts = "attempts"
+	}
+
+	return Redact(fmt.Sprintf("%s %s failed after %d %s: %s",
+		e.Method, e.URL, e.Attempts, attempts, reason))
+}
+
+// IsHTTPStatus returns true if err is an *HTTPError with the status code
+func IsHTTPStatus(err error, statusCode int) bool {
+	httpErr, ok := err.(*HTTPError)
+	return ok && httpErr.StatusCode == statusCode
+}
+
+// DefaultHTTPConfig returns settings used when none are configured. Proxies
+// come from the HTTPS_PROXY, HTTP_PROXY and NO_PROXY env vars.
+func DefaultHTTPConfig() *HTTPConfig {
+	return &HTTPConfig{
+		ConnectTimeout: 10 * time.Second,
+		ReadTimeout:    30 * time.Second,
+		Proxy:          GetEnvAny("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy:     GetEnvAny("HTTPS_PROXY", "https_proxy"),
+		NoProxy:        GetEnvAny("NO_PROXY", "no_proxy"),
+		StrictSSL:      true,
+	}
+}
+
+// NewHTTPClient creates an http.Client with a tuned transport. Clients should be
+// shared between requests, so that connections are reused; see SharedHTTPClient.
+func NewHTTPClient(config *HTTPConfig) (*http.Client, error) {
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := tlsClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   config.ConnectTimeout,
+		ResponseHeaderTimeout: config.ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+var sharedHTTPClients = make(map[HTTPConfig]*http.Client)
+var sharedHTTPClientsMu sync.Mutex
+
+// SharedHTTPClient returns a client for the configuration, creating it on first
+// use. Callers with the same configuration share connections.
+func SharedHTTPClient(config *HTTPConfig) (*http.Client, error) {
+	sharedHTTPClientsMu.Lock()
+	defer sharedHTTPClientsMu.Unlock()
+
+	if client, ok := sharedHTTPClients[*config]; ok {
+		return client, nil
+	}
+
+	client, err := NewHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedHTTPClients[*config] = client
+	return client, nil
+}
+
+// proxyFunc returns function which picks the proxy for a request
+func proxyFunc(config *HTTPConfig) (func(*http.Request) (*url.URL, error), error) {
+	proxy, err := parseProxyURL(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	httpsProxy, err := parseProxyURL(config.HTTPSProxy)
+	if err != nil {
+		return nil, err
+	}
+	if httpsProxy == nil {
+		httpsProxy = proxy
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if IsNoProxy(req.URL, config.NoProxy) {
+			return nil, nil
+		}
+		if req.URL.Scheme == "https" {
+			return httpsProxy, nil
+		}
+		return proxy, nil
+	}, nil
+}
+
+// parseProxyURL parses proxy URL, which defaults to the http scheme
+//
+//   proxy.example.com:8080 => http://proxy.example.com:8080
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid proxy %s", raw)
+	}
+	return u, nil
+}
+
+// IsNoProxy returns true if the URL's host is listed in noProxy, a comma or
+// space separated list of hosts. Entries match the host and its subdomains, and
+// may include a port. * matches every host, and IP ranges use CIDR notation.
+//
+//   example.com, .internal, 10.0.0.0/8, localhost:8080
+func IsNoProxy(u *url.URL, noProxy string) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" && u.Scheme == "https" {
+		port = "443"
+	} else if port == "" {
+		port = "80"
+	}
+
+	entries := strings.FieldsFunc(noProxy, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tlsClientConfig builds TLS settings. Extra CAs are trusted in addition to the
+// system roots.
+func tlsClientConfig(config *HTTPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !config.StrictSSL}
+
+	ca := unescapePEM(config.CA)
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		ca += "\n" + string(pem)
+	}
+
+	if strings.TrimSpace(ca) != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, fmt.Errorf("No certificates found in ca or cafile")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	cert, key := unescapePEM(config.Cert), unescapePEM(config.Key)
+	if config.CertFile != "" {
+		pem, err := ioutil.ReadFile(config.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		cert = string(pem)
+	}
+	if config.KeyFile != "" {
+		pem, err := ioutil.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = string(pem)
+	}
+
+	if cert != "" || key != "" {
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate :: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	return tlsConfig, nil
+}
+
+// unescapePEM replaces literal \n with newlines, since npmrc files store PEM
+// data on a single line
+func unescapePEM(s string) string {
+	return strings.Replace(s, "\\n", "\n", -1)
+}
+
+// isRetryableStatus returns true for responses which may succeed if the
+// request is sent again
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// backoff returns delay before the next attempt, growing exponentially with
+// the number of attempts made so far. Jitter keeps concurrent clients from
+// retrying in lockstep.
+func backoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	d := min << uint(attempt-1)
+	if d > max || d <= 0 {
+		d = max
+	}
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date. Returns false when the header is missing or invalid.
+func retryAfter(res *http.Response, max time.Duration) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if d < 0 {
+		d = 0
+	}
+	if d > max {
+		d = max
+	}
+	return d, true
+}
+
+// ReadTimeoutError is returned when a response body stalls, and no data arrives
+// for longer than the read timeout
+type ReadTimeoutError struct {
+	Timeout time.Duration
+}
+
+// Error returns string representation of the error
+func (e *ReadTimeoutError) Error() string {
+	return fmt.Sprintf("No data received for %s", e.Timeout)
+}
+
+// idleTimeoutBody aborts a response body when a read waits for data for
+// longer than timeout. The deadline only runs while reading, so bodies which
+// are consumed slowly, or which make slow progress, are not cut off.
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	stalled int32
+}
+
+// newIdleTimeoutBody wraps body. cancel aborts the request of the body.
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) io.ReadCloser {
+	b := &idleTimeoutBody{body: body, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&b.stalled, 1)
+			cancel()
+		})
+		b.timer.Stop()
+	}
+	return b
+}
+
+// Read reads from the body, and returns a *ReadTimeoutError when no data
+// arrives in time
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	if b.timer != nil {
+		b.timer.Reset(b.timeout)
+		defer b.timer.Stop()
+	}
+
+	n, err := b.body.Read(p)
+	if err != nil && err != io.EOF && atomic.LoadInt32(&b.stalled) == 1 {
+		return n, &ReadTimeoutError{Timeout: b.timeout}
+	}
+	return n, err
+}
+
+// Close closes the body, and releases its request
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
+
+// isDialError returns true when a request failed before it was sent, because
+// no connection could be made
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// discard drains and closes a response body, so the connection can be reused
+func discard(res *http.Response) {
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
+
+// flightGroup makes concurrent calls with the same key share a single execution
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Do runs fn, unless a call with the same key is already running, in which case
+// it waits for that call and returns its result
+func (g *flightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.val, f.err
+	}
+
+	f := &flight{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.val, f.err = fn()
+	f.wg.Done()
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+
+	return f.val, f.err
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ImportCmdRun converts a lockfile to another format. Both lockfiles describe
+// the same resolved graph, so versions, resolved URLs and integrity hashes are
+// kept as they are and nothing is resolved again.
+//
+//   frosty import -from yarn.lock -to npm-shrinkwrap.json [-lockfile-version 1|2|3]
+//   frosty import -from package-lock.json -to yarn.lock
+func ImportCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	cwdFlag := importCmd.String("C", cwd, "Set working directory")
+	verboseFlag := importCmd.Bool("verbose", false, "Show verbose log output")
+	fromFlag := importCmd.String("from", "",
+		"Lockfile to convert (yarn.lock, package-lock.json or npm-shrinkwrap.json)")
+	toFlag := importCmd.String("to", "",
+		"Lockfile to write (yarn.lock, package-lock.json or npm-shrinkwrap.json)")
+	lockfileVersionFlag := importCmd.Int("lockfile-version", 0,
+		"lockfileVersion (1, 2 or 3) of npm lockfiles, defaults to the version of the existing lockfile")
+
+	importCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+
+	if *fromFlag == "" || *toFlag == "" {
+		return fmt.Errorf("Please specify the lockfiles to convert with --from and --to")
+	}
+
+	from := ResolvePath(*fromFlag, ctx.Cwd)
+	to := ResolvePath(*toFlag, ctx.Cwd)
+	if from == to {
+		return fmt.Errorf("--from and --to are both %s", from)
+	}
+
+	graph, fromVersion, err := LoadLockGraph(from)
+	if err != nil {
+		return err
+	}
+
+	if path.Base(to) == "yarn.lock" {
+		lock, conflicts := NewYarnLock(graph)
+		for _, conflict := range conflicts {
+			ctx.Info("WARN %s, yarn.lock can only record one version", conflict)
+		}
+		err = lock.Write(to)
+	} else {
+		version := *lockfileVersionFlag
+		if version == 0 {
+			if fromVersion == 0 {
+				fromVersion = 1
+			}
+			version = LockfileVersionOf(to, fromVersion)
+		}
+		err = WriteLockfile(to, graph, version)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx.Info("Converted %s to %s", from, to)
+	return nil
+}
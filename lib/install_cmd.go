@@ -4,9 +4,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // InstallCmdInit initialized application Context
@@ -23,19 +28,46 @@ func InstallCmdInit(args []string) error {
 	verboseFlag := installCmd.Bool("verbose", false, "Show verbose log output")
 	forceFlag := installCmd.Bool("force", false,
 		"Force install -- continue even if some packages fail to install")
+	failOnDeprecatedFlag := installCmd.Bool("fail-on-deprecated", false,
+		"Fail the install if any deprecated package is installed")
 	frostyHomeFlag := installCmd.String("frosty-home", GetFrostyHome(),
 		"Location of frosty home directory")
 	configFlag := installCmd.String("config", "", "Path to gofrosty.js configuration")
-	shrinkwrapFlag := installCmd.Bool("shrinkwrap", false, "Force usage of npm-shrinkwrap.json")
+	shrinkwrapFlag := installCmd.Bool("shrinkwrap", false,
+		"Force usage of the lockfile (npm-shrinkwrap.json, package-lock.json or yarn.lock)")
 	packageFlag := installCmd.Bool("package", false, "Force usage of package.json")
+	saveFlag := installCmd.Bool("save", true, "Write lockfiles from the installed tree")
+	savePackageLockFlag := installCmd.Bool("save-package-lock", false,
+		"Write package-lock.json, even if the project has none")
+	lockfileVersionFlag := installCmd.Int("lockfile-version", 1,
+		"lockfileVersion (1, 2 or 3) of new lockfiles, existing lockfiles keep theirs")
+	tagTTLFlag := installCmd.Duration("tag-ttl", GetTagTTL(),
+		"How long dist-tag resolutions (ex: latest) are cached")
+	maxAgeFlag := installCmd.Duration("packument-max-age", GetPackumentMaxAge(),
+		"How long packuments are used before they are revalidated with the registry")
+	workspaceFlag := installCmd.String("w", "", "Only install dependencies of this workspace")
+	registryFlag := installCmd.String("registry", "", "Registry URL, overrides npmrc and env vars")
+	fallbackFlag := installCmd.String("fallback-registry", "",
+		"Comma separated registries to try when a package is missing from the registry")
+	retriesFlag := installCmd.Int("fetch-retries", GetFetchRetries(),
+		"How many times failed registry requests are retried")
+	connectTimeoutFlag := installCmd.Duration("connect-timeout", DefaultHTTPConfig().ConnectTimeout,
+		"How long to wait for a connection to the registry")
+	readTimeoutFlag := installCmd.Duration("read-timeout", DefaultHTTPConfig().ReadTimeout,
+		"How long to wait for data from the registry before retrying")
 
 	installCmd.Parse(args)
 
 	ctx.Cwd = *cwdFlag
 	ctx.Verbose = *verboseFlag
 	ctx.Force = *forceFlag
+	ctx.FailOnDeprecated = *failOnDeprecatedFlag
 	ctx.FrostyHome = *frostyHomeFlag
 	ctx.GoFrostyJSPath = *configFlag
+	ctx.Workspace = *workspaceFlag
+	ctx.SaveLockfiles = *saveFlag
+	ctx.SavePackageLock = *savePackageLockFlag
+	ctx.LockfileVersion = *lockfileVersionFlag
 
 	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
 	ctx.NodeModulesDir = path.Join(ctx.Cwd, "node_modules")
@@ -45,25 +77,27 @@ func InstallCmdInit(args []string) error {
 		ctx.GoFrostyJSPath = ResolvePath(*configFlag, cwd)
 	}
 
+	if ctx.LockfileVersion < 1 || ctx.LockfileVersion > 3 {
+		return fmt.Errorf("Unsupported lockfileVersion %d, expected 1, 2 or 3", ctx.LockfileVersion)
+	}
+
 	if *shrinkwrapFlag && *packageFlag {
 		return errors.New(
 			"Please specify either --shrinkwrap or --package flag, but not both")
 	}
 
-	if *shrinkwrapFlag {
-		ctx.UseShrinkwrap = true
-		ctx.UsePackage = false
-	}
-
-	if *packageFlag {
-		ctx.UseShrinkwrap = false
-		ctx.UsePackage = true
-	}
+	ctx.UseShrinkwrap = *shrinkwrapFlag
+	ctx.UsePackage = *packageFlag
 
-	candidateShrinkwrapPath := path.Join(ctx.Cwd, "npm-shrinkwrap.json")
+	// npm-shrinkwrap.json takes precedence over package-lock.json, like with
+	// npm, and yarn.lock is only used when there is no npm lockfile
+	candidateShrinkwrapPath := FindLockfile(ctx.Cwd)
 	candidatePackagePath := path.Join(ctx.Cwd, "package.json")
 
 	if ctx.UseShrinkwrap {
+		if candidateShrinkwrapPath == "" {
+			return fmt.Errorf("%s has no npm-shrinkwrap.json, package-lock.json or yarn.lock", ctx.Cwd)
+		}
 		ctx.ShrinkwrapPath = candidateShrinkwrapPath
 	}
 
@@ -72,7 +106,7 @@ func InstallCmdInit(args []string) error {
 	}
 
 	if !ctx.UseShrinkwrap && !ctx.UsePackage {
-		if IsFile(candidateShrinkwrapPath) {
+		if candidateShrinkwrapPath != "" {
 			ctx.UseShrinkwrap = true
 			ctx.ShrinkwrapPath = candidateShrinkwrapPath
 			ctx.UsePackage = false
@@ -92,6 +126,26 @@ func InstallCmdInit(args []string) error {
 	}
 	ctx.Cache = cache
 
+	npmFlags := make(map[string]string)
+	if *registryFlag != "" {
+		npmFlags["registry"] = *registryFlag
+	}
+	if *fallbackFlag != "" {
+		npmFlags["fallback-registry"] = *fallbackFlag
+	}
+	err = ConfigureNpm(ctx, npmFlags, func(config *HTTPConfig) {
+		config.ConnectTimeout = *connectTimeoutFlag
+		config.ReadTimeout = *readTimeoutFlag
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.NpmRegistry.TagCache = LoadTagCache(path.Join(cache.RootDir, "tags.json"), *tagTTLFlag)
+	ctx.NpmRegistry.PackumentCache = NewPackumentCache(
+		path.Join(ctx.FrostyHome, "packuments"), *maxAgeFlag)
+	ctx.NpmRegistry.Retries = *retriesFlag
+
 	return nil
 }
 
@@ -107,6 +161,10 @@ func InstallCmdRun(args []string) error {
 	// Print run-time context values, for debugging
 	ctx.Debug(ctx.String())
 
+	if ctx.UseShrinkwrap && path.Base(ctx.ShrinkwrapPath) == "yarn.lock" {
+		return installFromYarnLock(ctx)
+	}
+
 	if ctx.UseShrinkwrap {
 		return installFromShrinkwrapJSON(ctx)
 	}
@@ -118,36 +176,96 @@ func InstallCmdRun(args []string) error {
 	return nil
 }
 
-// Install npm modules from npm-shrinkwrap.json file
+// Install npm modules from npm-shrinkwrap.json or package-lock.json file. The
+// exact tree described by the lockfile is installed, nothing is resolved again.
 func installFromShrinkwrapJSON(ctx *Context) error {
 	ctx.Debug("Installing modules from %s...", ctx.ShrinkwrapPath)
+	ictx := NewInstallContext()
 
-	// // Parse npm-shrinkwrap.json file
-	// shrinkwrap, err := LoadShrinkwrapFile(ctx.ShrinkwrapPath)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// // Map dependencies from npm-shrinkwrap.json to frosty module objects
-	// modules, err := module.TransformDependencies(shrinkwrap.FlattenDeps())
-	// if err != nil {
-	// 	return err
-	// }
-
-	// // Add each module to the local cache, downloading from network as needed.
-	// err = populateCache(cache, modules)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// // Materialize npm-shrinkwrap.json dependency tree in ./node_modules
-	// // from modules stored  in local cache
-	// err = materialize(shrinkwrap)
-	// if err != nil {
-	// 	return err
-	// }
+	graph, _, err := LoadLockfile(ctx.ShrinkwrapPath)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	// workspaces are linked rather than fetched
+	ctx.Workspaces = nil
+	packagePath := path.Join(ctx.Cwd, "package.json")
+	if IsFile(packagePath) {
+		pkg, err := LoadPackage(packagePath)
+		if err != nil {
+			return err
+		}
+
+		ctx.Workspaces, err = LoadWorkspaces(pkg)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = graph.CheckPaths(ctx.Cwd, ctx.Workspaces)
+	if err != nil {
+		return err
+	}
+
+	err = installLockGraph(ctx, graph, ictx)
+	if err != nil {
+		return err
+	}
+
+	return finishInstall(ctx, ictx)
+}
+
+// Install npm modules from yarn.lock file. yarn.lock does not record the
+// layout of node_modules, which is computed from package.json and the pinned
+// versions. When package.json declares dependencies which yarn.lock has not
+// resolved, yarn.lock is out of date and modules are installed from
+// package.json instead.
+func installFromYarnLock(ctx *Context) error {
+	ctx.Debug("Installing modules from %s...", ctx.ShrinkwrapPath)
+	ictx := NewInstallContext()
+
+	lock, err := LoadYarnLock(ctx.ShrinkwrapPath)
+	if err != nil {
+		return err
+	}
+
+	packagePath := path.Join(ctx.Cwd, "package.json")
+	pkg, err := LoadPackage(packagePath)
+	if err != nil {
+		return err
+	}
+
+	ctx.Workspaces, err = LoadWorkspaces(pkg)
+	if err != nil {
+		return err
+	}
+
+	missing := lock.Missing(pkg, ctx.Workspaces)
+	if len(missing) > 0 {
+		ctx.Info("WARN %s is out of date with package.json (missing %s), installing from package.json",
+			ctx.ShrinkwrapPath, strings.Join(missing, ", "))
+		ctx.UseShrinkwrap = false
+		ctx.UsePackage = true
+		ctx.PackagePath = packagePath
+		return installFromPackageJSON(ctx)
+	}
+
+	graph, err := lock.Graph(pkg, ctx.Workspaces)
+	if err != nil {
+		return err
+	}
+
+	err = graph.CheckPaths(ctx.Cwd, ctx.Workspaces)
+	if err != nil {
+		return err
+	}
+
+	err = installLockGraph(ctx, graph, ictx)
+	if err != nil {
+		return err
+	}
+
+	return finishInstall(ctx, ictx)
 }
 
 // Install npm modules from package.json file
@@ -159,23 +277,182 @@ func installFromPackageJSON(ctx *Context) error {
 		return err
 	}
 
-	err = installDepMap(pkg.Dependencies, ctx.NodeModulesDir, ictx)
+	ctx.Workspaces, err = LoadWorkspaces(pkg)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.Cache.Index.Commit()
+	if len(ctx.Workspaces) > 0 {
+		err = installWorkspaces(ctx, pkg, ictx)
+	} else if ctx.Workspace != "" {
+		err = fmt.Errorf("%s does not define any workspaces", ctx.PackagePath)
+	} else {
+		err = installDepMap(pkg.Dependencies, ctx.NodeModulesDir, ctx.Cwd, ictx)
+	}
 	if err != nil {
 		return err
 	}
 
+	return finishInstall(ctx, ictx)
+}
+
+// finishInstall saves caches and lockfiles once packages are installed
+func finishInstall(ctx *Context, ictx *InstallContext) error {
+	err := ctx.Cache.Index.Commit()
+	if err != nil {
+		return err
+	}
+
+	err = ctx.NpmRegistry.TagCache.Commit()
+	if err != nil {
+		return err
+	}
+
+	err = saveLockfiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	return reportDeprecations(ctx, ictx)
+}
+
+// saveLockfiles records the installed tree in the lockfiles of the project.
+// npm-shrinkwrap.json is written unless the project only has package-lock.json
+// or yarn.lock. package-lock.json is written when it exists or when requested.
+func saveLockfiles(ctx *Context) error {
+	if !ctx.SaveLockfiles {
+		return nil
+	}
+
+	shrinkwrapPath := path.Join(ctx.Cwd, "npm-shrinkwrap.json")
+	packageLockPath := path.Join(ctx.Cwd, "package-lock.json")
+	yarnLockPath := path.Join(ctx.Cwd, "yarn.lock")
+
+	files := []string{}
+	if IsFile(shrinkwrapPath) || (!IsFile(packageLockPath) && !IsFile(yarnLockPath)) {
+		files = append(files, shrinkwrapPath)
+	}
+	if IsFile(packageLockPath) || ctx.SavePackageLock {
+		files = append(files, packageLockPath)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	graph, err := BuildLockGraph(ctx.Cwd)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err := WriteLockfile(file, graph, LockfileVersionOf(file, ctx.LockfileVersion))
+		if err != nil {
+			return err
+		}
+		ctx.Debug("Wrote %s", file)
+	}
+
 	return nil
 }
 
-func installDepMap(deps map[string]string, nodeModulesDir string, ictx *InstallContext) error {
+// reportDeprecations warns once about each deprecated package which has been
+// installed, listing where it is in the dependency tree. Fails when
+// --fail-on-deprecated is set.
+func reportDeprecations(ctx *Context, ictx *InstallContext) error {
+	deprecations := ictx.SortedDeprecations()
+	for _, d := range deprecations {
+		paths := make([]string, 0, len(d.InstallDirs))
+		for _, dir := range d.InstallDirs {
+			paths = append(paths, TreePath(ctx.Cwd, dir))
+		}
+		sort.Strings(paths)
+
+		ctx.Info("WARN deprecated %s@%s (%s): %s",
+			d.Name, d.Version, strings.Join(paths, ", "), d.Message)
+	}
+
+	if ctx.FailOnDeprecated && len(deprecations) > 0 {
+		return fmt.Errorf("%d deprecated packages were installed, and --fail-on-deprecated is set",
+			len(deprecations))
+	}
+
+	return nil
+}
+
+// installWorkspaces links every workspace into the root node_modules, then installs
+// dependencies of the root package and of its workspaces in one pass. Dependencies
+// are hoisted to the root node_modules, unless a different spec for the same name is
+// already hoisted, in which case they are installed in the workspace's node_modules.
+func installWorkspaces(ctx *Context, root *Package, ictx *InstallContext) error {
+	names := SortedWorkspaceNames(ctx.Workspaces)
+	for _, name := range names {
+		err := ctx.Workspaces[name].Link(path.Join(ctx.NodeModulesDir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	hoisted := make(map[string]string)
+	targets := names
+
+	if ctx.Workspace != "" {
+		ws, err := FindWorkspace(ctx.Workspaces, root.Dir, ctx.Workspace)
+		if err != nil {
+			return err
+		}
+		targets = []string{ws.Name}
+	} else {
+		for name, version := range root.Dependencies {
+			hoisted[name] = version
+		}
+	}
+
+	nested := make(map[string]map[string]string)
+	for _, wsName := range targets {
+		nested[wsName] = make(map[string]string)
+		for name, version := range ctx.Workspaces[wsName].Package.Dependencies {
+			// local paths are relative to the workspace, so they are not hoisted
+			if strings.HasPrefix(version, "file:") || isPathSpec(version) {
+				nested[wsName][name] = version
+				continue
+			}
+
+			existing, ok := hoisted[name]
+			if !ok {
+				hoisted[name] = version
+				continue
+			}
+
+			if existing != version {
+				ctx.Debug("%s@%s conflicts with hoisted %s@%s, installing in workspace %s",
+					name, version, name, existing, wsName)
+				nested[wsName][name] = version
+			}
+		}
+	}
+
+	err := installDepMap(hoisted, ctx.NodeModulesDir, root.Dir, ictx)
+	if err != nil {
+		return err
+	}
+
+	for _, wsName := range targets {
+		wsDir := ctx.Workspaces[wsName].Dir
+		err := installDepMap(nested[wsName], path.Join(wsDir, "node_modules"), wsDir, ictx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// installDepMap installs deps in nodeModulesDir. Local paths in deps are
+// relative to baseDir, the directory of the package which declares them.
+func installDepMap(deps map[string]string, nodeModulesDir string, baseDir string, ictx *InstallContext) error {
 	for name, version := range deps {
 		installDir := path.Join(nodeModulesDir, name)
-		err := installDep(name, version, installDir, ictx)
+		err := installDep(name, version, installDir, baseDir, ictx)
 		if err != nil {
 			return err
 		}
@@ -183,7 +460,7 @@ func installDepMap(deps map[string]string, nodeModulesDir string, ictx *InstallC
 	return nil
 }
 
-func installDep(name string, version string, installDir string, ictx *InstallContext) error {
+func installDep(name string, version string, installDir string, baseDir string, ictx *InstallContext) error {
 	if IsDir(installDir) {
 		return nil
 	}
@@ -191,6 +468,36 @@ func installDep(name string, version string, installDir string, ictx *InstallCon
 	ctx := GetContext()
 	ctx.Debug("Installing %s@%s to %s", name, version, installDir)
 
+	spec, err := ParseSpec(name, version)
+	if err != nil {
+		return err
+	}
+
+	// dependencies on a package in the same monorepo are linked to the workspace
+	if ws, ok := ctx.Workspaces[name]; ok && ws.Satisfies(spec) {
+		return ws.Link(installDir)
+	}
+
+	if spec.Type == WorkspaceSpec {
+		return fmt.Errorf("No workspace satisfies %s", spec)
+	}
+
+	// aliased packages are installed under the alias name, but are resolved and
+	// cached using the real package name and spec
+	fetch := spec
+	if spec.Type == AliasSpec {
+		fetch = spec.Alias
+		ctx.Debug("%s is an alias for %s", name, fetch)
+	}
+
+	// dist-tags move, so they are resolved to a version before the cache lookup
+	if fetch.Type == TagSpec {
+		fetch, err = resolveTagSpec(fetch)
+		if err != nil {
+			return err
+		}
+	}
+
 	if IsDir(installDir) {
 		err := os.RemoveAll(installDir)
 		if err != nil {
@@ -199,27 +506,41 @@ func installDep(name string, version string, installDir string, ictx *InstallCon
 	}
 
 	os.MkdirAll(installDir, os.ModePerm)
-	cacheDir, cacheMiss := ctx.Cache.GetPath(name, version)
+
+	cacheDir := ""
+	cacheMiss := fmt.Errorf("%s is not cacheable", fetch)
+	if fetch.Cacheable() {
+		cacheDir, cacheMiss = ctx.Cache.GetPath(fetch.Name, fetch.Raw)
+	}
 
 	var pkg *Package
-	var err error
 
 	if cacheMiss != nil {
-		ctx.Debug("CACHE MISS %s@%s --- %s", name, version, cacheMiss.Error())
-		return cacheMiss
-		// pkg, err = installDepFromNetwork(name, version, installDir, ictx)
-		// if err != nil {
-		// 	return err
-		// }
+		ctx.Debug("CACHE MISS %s --- %s", fetch, cacheMiss.Error())
+		pkg, err = installDepFromSpec(fetch, installDir, baseDir, "", ictx)
+		if err != nil {
+			return err
+		}
+		defer removeTarball(pkg)
 	} else {
-		ctx.Debug("CACHE HIT %s@%s [%s]", name, version, cacheDir)
+		ctx.Debug("CACHE HIT %s [%s]", fetch, cacheDir)
 		pkg, err = installDepFromCacheDir(cacheDir, installDir)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = installDepMap(pkg.Dependencies, path.Join(installDir, "node_modules"), ictx)
+	if pkg.Deprecated != "" {
+		ictx.AddDeprecated(pkg.Name, pkg.Version, pkg.Deprecated, installDir)
+	}
+
+	// local paths declared by a local package are relative to its sources
+	depsBaseDir := installDir
+	if fetch.Type == DirectorySpec {
+		depsBaseDir = ResolvePath(fetch.Path, baseDir)
+	}
+
+	err = installDepMap(pkg.Dependencies, path.Join(installDir, "node_modules"), depsBaseDir, ictx)
 	if err != nil {
 		return err
 	}
@@ -238,14 +559,17 @@ func installDep(name string, version string, installDir string, ictx *InstallCon
 			return err
 		}
 
-		err := ctx.Cache.Add(name, version, pkg)
-		if err != nil {
-			return err
+		if fetch.Cacheable() {
+			err := ctx.Cache.Add(fetch.Name, fetch.Raw, pkg)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	// symlink bin files from package.json
-	err = pkg.LinkBin(path.Join("..", ".bin"), path.Join("..", path.Base(installDir)))
+	relBin, relModule := BinLinkPaths(name)
+	err = pkg.LinkBin(relBin, relModule)
 	if err != nil {
 		return err
 	}
@@ -253,32 +577,248 @@ func installDep(name string, version string, installDir string, ictx *InstallCon
 	return nil
 }
 
-func installDepFromCacheDir(cacheDir, installDir string) (*Package, error) {
-	err := CopyDir(cacheDir, installDir)
+// lockInstall is a package installed from a lockfile
+type lockInstall struct {
+	name      string
+	fetch     *Spec
+	cacheKey  string
+	cacheMiss bool
+	pkg       *Package
+}
+
+// installLockGraph installs every package of the graph where the graph says
+// it is installed. Packages already installed at the right version are kept.
+func installLockGraph(ctx *Context, graph *LockGraph, ictx *InstallContext) error {
+	installed := []*lockInstall{}
+
+	// parents sort before their node_modules, so they are never copied over
+	// packages nested in them
+	for _, p := range graph.SortedPaths() {
+		if !IsInstallPath(p) {
+			continue
+		}
+
+		node := graph.Packages[p]
+		installDir := path.Join(ctx.Cwd, p)
+		name := LockPathName(p)
+
+		if node.Link {
+			target := path.Join(ctx.Cwd, node.Resolved)
+			err := linkLockNode(name, target, installDir)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if ws := lockNodeWorkspace(ctx, node); ws != nil {
+			err := ws.Link(installDir)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		li, err := installLockNode(ctx, node, p, installDir, ictx)
+		if err != nil {
+			return err
+		}
+		li.name = name
+		installed = append(installed, li)
+		defer removeTarball(li.pkg)
+
+		if li.pkg.Deprecated != "" {
+			ictx.AddDeprecated(li.pkg.Name, li.pkg.Version, li.pkg.Deprecated, installDir)
+		}
+	}
+
+	// install scripts run once dependencies are in place, so nested packages go first
+	for i := len(installed) - 1; i >= 0; i-- {
+		li := installed[i]
+		if !li.cacheMiss {
+			continue
+		}
+
+		err := li.pkg.RunScript("install")
+		if err != nil {
+			return err
+		}
+
+		err = li.pkg.RunScript("postinstall")
+		if err != nil {
+			return err
+		}
+
+		if li.fetch.Cacheable() {
+			err := ctx.Cache.Add(li.fetch.Name, li.cacheKey, li.pkg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, li := range installed {
+		relBin, relModule := BinLinkPaths(li.name)
+		err := li.pkg.LinkBin(relBin, relModule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// installLockNode installs the package at p, from the cache when possible
+func installLockNode(ctx *Context, node *LockNode, p string, installDir string, ictx *InstallContext) (*lockInstall, error) {
+	fetch, err := node.FetchSpec(p)
 	if err != nil {
 		return nil, err
 	}
 
+	// registry packages are cached by version, wherever their registry is;
+	// other tarballs by URL, so they never share the cached registry version
+	li := &lockInstall{fetch: fetch, cacheKey: fetch.Raw}
+	if node.Version != "" && fetch.Type == TarballSpec && isRegistryTarball(fetch.Name, node.Version, fetch.URL) {
+		li.cacheKey = node.Version
+	}
+
+	existing, err := LoadPackageFromDir(installDir)
+	if err == nil && existing.Version == node.Version && (node.Version != "" || existing.Resolved == node.Resolved) &&
+		IntegrityMatches(node.Integrity, existing.Integrity, existing.Shasum) {
+		ctx.Debug("%s is already installed", p)
+		li.pkg = existing
+		return li, nil
+	}
+
+	cacheDir := ""
+	cacheMiss := fmt.Errorf("%s is not cacheable", fetch)
+	if fetch.Cacheable() {
+		cacheDir, cacheMiss = ctx.Cache.GetPath(fetch.Name, li.cacheKey)
+	}
+
+	// cached packages record the checksums they were verified against, and
+	// are downloaded again when those do not match the lockfile
+	if cacheMiss == nil {
+		cached, err := LoadPackageFromDir(cacheDir)
+		if err != nil || !IntegrityMatches(node.Integrity, cached.Integrity, cached.Shasum) {
+			cacheMiss = fmt.Errorf("Cached %s does not match integrity %s", fetch, node.Integrity)
+			err = ctx.Cache.Remove(fetch.Name, cacheDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cacheMiss == nil {
+		ctx.Debug("CACHE HIT %s [%s]", fetch, cacheDir)
+		li.pkg, err = installDepFromCacheDir(cacheDir, installDir)
+		return li, err
+	}
+
+	ctx.Debug("CACHE MISS %s --- %s", fetch, cacheMiss.Error())
+	if _, err := os.Lstat(installDir); err == nil {
+		err := os.RemoveAll(installDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	os.MkdirAll(installDir, os.ModePerm)
+
+	li.cacheMiss = true
+	// local paths in lockfiles are relative to the root package
+	li.pkg, err = installDepFromSpec(fetch, installDir, ctx.Cwd, node.Integrity, ictx)
+	if err != nil {
+		return nil, err
+	}
+
+	return li, nil
+}
+
+// isRegistryTarball returns true when url has the path registries host version
+// of a module at (ex: https://registry.npmjs.org/@scope/foo/-/foo-1.0.0.tgz)
+func isRegistryTarball(name string, version string, url string) bool {
+	base := name[strings.LastIndex(name, "/")+1:]
+	suffix := "/" + name + "/-/" + base + "-" + version + ".tgz"
+	return strings.HasSuffix(strings.SplitN(url, "?", 2)[0], suffix)
+}
+
+// lockNodeWorkspace returns the workspace a lockfile entry refers to, if any
+func lockNodeWorkspace(ctx *Context, node *LockNode) *Workspace {
+	ws, ok := ctx.Workspaces[node.Name]
+	if !ok || !strings.HasPrefix(node.Resolved, "file:") {
+		return nil
+	}
+
+	if ResolvePath(strings.TrimPrefix(node.Resolved, "file:"), ctx.Cwd) != ws.Dir {
+		return nil
+	}
+	return ws
+}
+
+// linkLockNode symlinks a linked package to installDir, and links its bin entries
+func linkLockNode(name string, target string, installDir string) error {
+	rel, err := filepath.Rel(path.Dir(installDir), target)
+	if err != nil {
+		return err
+	}
+
+	err = replaceSymlink(rel, installDir)
+	if err != nil {
+		return err
+	}
+
 	pkg, err := LoadPackageFromDir(installDir)
+	if err != nil {
+		return err
+	}
+
+	relBin, relModule := BinLinkPaths(name)
+	return pkg.LinkBin(relBin, relModule)
+}
+
+// resolveTagSpec returns a version spec for the version a dist-tag points to
+func resolveTagSpec(spec *Spec) (*Spec, error) {
+	ctx := GetContext()
+
+	version, err := ctx.NpmRegistry.ResolveTag(spec.Name, spec.Tag)
 	if err != nil {
 		return nil, err
 	}
 
-	return pkg, nil
+	ctx.Info("%s@%s => %s (dist-tag)", spec.Name, spec.Tag, version)
+	return ParseSpec(spec.Name, version)
+}
+
+// removeTarball removes the downloaded tarball of pkg, when it was not cached
+func removeTarball(pkg *Package) {
+	if pkg.Tarball != "" {
+		os.Remove(pkg.Tarball)
+	}
 }
 
-func installDepFromNetwork(name, version, installDir string, ictx *InstallContext) (*Package, error) {
-	res, err := downloadDep(name, version)
+func installDepFromCacheDir(cacheDir, installDir string) (*Package, error) {
+	err := CopyDir(cacheDir, installDir)
 	if err != nil {
 		return nil, err
 	}
 
-	// untar file
-	err = ExtractTar(res.Body, installDir, 1)
+	pkg, err := LoadPackageFromDir(installDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg, nil
+}
+
+// installDepFromSpec fetches a module which is not in the cache, from wherever
+// its spec points to. Local paths are resolved against baseDir. integrity, if
+// any, is the checksum a lockfile records for the module (see fetchDep).
+func installDepFromSpec(spec *Spec, installDir string, baseDir string, integrity string,
+	ictx *InstallContext) (*Package, error) {
+	dist, err := fetchDep(spec, installDir, baseDir, integrity)
 	if err != nil {
 		return nil, err
 	}
-	res.Body.Close()
 
 	// update package.json to reflect where code was downloaded from
 	pkg, err := LoadPackageFromDir(installDir)
@@ -286,121 +826,176 @@ func installDepFromNetwork(name, version, installDir string, ictx *InstallContex
 		return nil, err
 	}
 
-	pkg.Resolved = res.Request.URL.String()
+	pkg.Resolved = dist.Tarball
+	pkg.Integrity = dist.Integrity
+	pkg.Shasum = dist.Shasum
+	pkg.Registry = dist.Registry
+	pkg.Deprecated = dist.Deprecated
+	pkg.Tarball = dist.File
 	err = pkg.Commit()
 	if err != nil {
 		return nil, err
 	}
 
-	ictx.Add(name, pkg.Version, version, installDir)
+	ictx.Add(spec.Name, pkg.Version, spec.Raw, installDir)
 
 	return pkg, nil
 }
 
-func downloadDep(name string, version string) (*http.Response, error) {
+// fetchDep writes the contents of the module described by spec to installDir.
+// Returns the location the module was resolved to, along with the checksums
+// of tarballs, computed once they are verified. Local paths are resolved against baseDir,
+// the directory of the package which declares the dependency. Tarballs must
+// match integrity, when not empty, as well as the checksums of their dist.
+func fetchDep(spec *Spec, installDir string, baseDir string, integrity string) (*Dist, error) {
+	switch spec.Type {
+	case VersionSpec, RangeSpec, TagSpec, TarballSpec:
+		dist, err := resolveDist(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		// the tarball is checked against the checksums of its dist as it is
+		// extracted, and nothing is left installed when it does not match
+		var verified *Dist
+		err = GetContext().NpmRegistry.Download(dist.Tarball, nil, func(res *http.Response) error {
+			// record where the TAR file was actually served from, after redirects
+			dist.Tarball = res.Request.URL.String()
+
+			// cacheable tarballs are kept as downloaded, for the cache
+			var file *os.File
+			var r io.Reader = res.Body
+			if spec.Cacheable() {
+				var err error
+				file, err = ioutil.TempFile("", "frosty-tarball")
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				r = io.TeeReader(res.Body, file)
+			}
+
+			body := NewIntegrityReader(r)
+			err := ExtractTar(body, installDir, 1)
+			if err == nil {
+				err = body.Verify(dist.Tarball, dist.Integrity, dist.Shasum)
+			}
+			if err == nil {
+				err = body.Verify(dist.Tarball, integrity, "")
+			}
+			if err != nil {
+				if file != nil {
+					os.Remove(file.Name())
+				}
+				return cleanup(installDir, err)
+			}
+
+			verified = body.Verified(dist)
+			if file != nil {
+				verified.File = file.Name()
+			}
+			return nil
+		})
+		return verified, err
+
+	case HostedGitSpec:
+		resolved, err := fetchHostedGit(spec.Hosted, installDir)
+		return &Dist{Tarball: resolved}, err
+
+	case GitSpec:
+		ref := spec.Committish
+		if ref == "" {
+			ref = "HEAD"
+		}
+		return &Dist{Tarball: spec.URL + "#" + ref}, GitClone(spec.URL, ref, installDir)
+
+	case FileSpec:
+		f, err := os.Open(ResolvePath(spec.Path, baseDir))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		body := NewIntegrityReader(f)
+		err = ExtractTar(body, installDir, 1)
+		if err == nil {
+			err = body.Verify("file:"+spec.Path, integrity, "")
+		}
+		if err != nil {
+			return nil, cleanup(installDir, err)
+		}
+		return body.Verified(&Dist{Tarball: "file:" + spec.Path}), nil
+
+	case DirectorySpec:
+		source := ResolvePath(spec.Path, baseDir)
+		return &Dist{Tarball: "file:" + spec.Path},
+			CopyDirBlacklist(source, installDir, []string{"node_modules"})
+	}
+
+	return nil, fmt.Errorf("%s dependencies are not supported [%s]", spec.Type, spec)
+}
+
+// fetchHostedGit downloads archive of a hosted git repository. If the
+// archive cannot be downloaded (ex: private repository), then falls back to
+// cloning the repository over ssh.
+func fetchHostedGit(hosted *HostedGit, installDir string) (string, error) {
+	ctx := GetContext()
+	resolved := hosted.TarballURL()
+
+	res, err := ctx.NpmRegistry.Get(resolved)
+	if err == nil {
+		err = ExtractTar(res.Body, installDir, 1)
+		res.Body.Close()
+	}
+
+	if err != nil {
+		ctx.Debug("Unable to download %s (%s), trying git clone", resolved, err)
+		err = GitClone(hosted.GitURL(), hosted.Ref(), installDir)
+		if err != nil {
+			return "", err
+		}
+		resolved = hosted.GitURL() + "#" + hosted.Ref()
+	}
+
+	return resolved, nil
+}
+
+// resolveDist returns the dist of the tarball described by spec
+func resolveDist(spec *Spec) (*Dist, error) {
 	// At this point, we know the module is not in the cache, so we need to
-	// grab it from the network. The version string can be one of the following:
+	// grab it from the network. The spec can be one of the following:
 	//
 	//    - A URL to a TAR file (ex: http://foo.com/my-tar.tgz)
 	//    - An explicit semver string (ex: 1.0.0)
 	//    - A semver range string (ex: 1.0.x)
-	//    - A URL to a GIT repo (not supported)
-	//
-	// If the URL is a git repo, we return an error (not supported).
+	//    - A dist-tag (ex: latest)
 	//
-	// If the URL is an explicit semver version, we generate a TAR file URL,
-	// based on the configured npm registry host.
+	// If the spec is an explicit semver version, a range or a tag, we query the
+	// registry to get the newest version which satisfies it. The packument of the
+	// module tells us where the TAR file for that version is hosted.
 	//
-	// If the URL is a semver range, we query the registry to get the newest version
-	// which satisfies the semver. We then generate the TAR file URL for that version,
-	// based on the configured npm registry host.
-	//
-	// If version is a TAR file URL, or once we have converted it to a TAR file URL in one
-	// of the previous steps, we download it from the network, and install it.
+	// Once we have a TAR file URL, fetchDep downloads it from the network.
 
 	ctx := GetContext()
+	dist := &Dist{Tarball: spec.URL}
 
-	if IsGitURL(version) {
-		return nil, fmt.Errorf("Git dependencies are not supported [%s]", version)
-	}
+	if spec.IsRegistry() {
+		manifest, err := ctx.NpmRegistry.ResolveVersion(spec.Name, spec.FetchSpec())
+		if err != nil {
+			return nil, err
+		}
 
-	downloadURL, err := ctx.NpmRegistry.GetTarURL(name, version)
-	if err != nil {
-		return nil, err
+		dist = &Dist{
+			Tarball:    manifest.Dist.Tarball,
+			Shasum:     manifest.Dist.Shasum,
+			Integrity:  manifest.Dist.Integrity,
+			Registry:   manifest.Registry,
+			Deprecated: manifest.Deprecated,
+		}
+		if dist.Tarball == "" {
+			dist.Tarball = genTarURL(manifest.Registry, spec.Name, manifest.Version)
+		}
 	}
 
-	return ctx.NpmRegistry.Get(downloadURL)
+	return dist, nil
 }
-
-// func materialize(shrinkwrap *Shrinkwrap) error {
-// nodeModulesDir := path.Join(shrinkwrap.Dir, "node_modules")
-// err := os.MkdirAll(nodeModulesDir, os.ModePerm)
-// if err != nil {
-// 	return err
-// }
-
-// err = materializeDeps(nodeModulesDir, shrinkwrap.Dependencies)
-// if err != nil {
-// 	return err
-// }
-
-// 	return nil
-// }
-
-// func materializeDeps(nodeModulesDir string, deps map[string]*Dependency) error {
-// for _, dep := range deps {
-// 	module, err := module.TransformDependency(dep)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	materializeModule(nodeModulesDir, module)
-// 	subNodeModulesDir := path.Join(nodeModulesDir, dep.Name, "node_modules")
-// 	materializeDeps(subNodeModulesDir, dep.Dependencies)
-// }
-
-// 	return nil
-// }
-
-// func materializeModule(nodeModulesDir string, module *module.Module) error {
-// ctx := GetContext()
-// if !ctx.Cache.Contains(module) {
-// 	return fmt.Errorf(
-// 		"Cannot materialize %s@%s [not in cache]",
-// 		module.Name,
-// 		module.Version)
-// }
-
-// source := module.PathOnDisk
-// dest := path.Join(nodeModulesDir, module.Name)
-
-// if module.PathOnDisk == "" {
-// 	source = cache.ModulePackageDir(module)
-// }
-
-// err := CopyDir(source, dest)
-// if err != nil {
-// 	return err
-// }
-
-// 	return nil
-// }
-
-// func populateCache(cache *module.Cache, modules []*module.Module) error {
-// ctx := GetContext()
-
-// for _, module := range modules {
-// 	ctx.Debug(module.String())
-// 	if !cache.Contains(module) {
-// 		err := cache.Add(module)
-// 		if err != nil {
-// 			return err
-// 		}
-// 	} else {
-// 		ctx.Debug("Cache already contains %s@%s, continuing.",
-// 			module.Name, module.Version)
-// 	}
-// }
-
-// 	return nil
-// }
@@ -2,6 +2,9 @@ package lib
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // InstalledModule keeps track of an installed npm module
@@ -45,13 +48,24 @@ func (im *InstalledModule) contains(haystack []string, needle string) bool {
 // InstallContext keeps track of npm modules which are installed, so that they can be added to the cache after
 // the install process completes.
 type InstallContext struct {
-	Modules map[string]*InstalledModule
+	Modules      map[string]*InstalledModule
+	Deprecations map[string]*Deprecation
+}
+
+// Deprecation is a deprecated package version which has been installed, along
+// with every directory it was installed to
+type Deprecation struct {
+	Name        string
+	Version     string
+	Message     string
+	InstallDirs []string
 }
 
 // NewInstallContext Create new install context
 func NewInstallContext() *InstallContext {
 	return &InstallContext{
-		Modules: make(map[string]*InstalledModule, 0),
+		Modules:      make(map[string]*InstalledModule, 0),
+		Deprecations: make(map[string]*Deprecation),
 	}
 }
 
@@ -82,3 +96,56 @@ func (ictx *InstallContext) Get(name string, explicitSemver string) (*InstalledM
 func (ictx *InstallContext) GenID(name string, explicitSemver string) string {
 	return fmt.Sprintf("%s@%s", name, explicitSemver)
 }
+
+// AddDeprecated records that a deprecated package version has been installed
+func (ictx *InstallContext) AddDeprecated(name string, version string, message string, installDir string) {
+	id := ictx.GenID(name, version)
+	d, ok := ictx.Deprecations[id]
+	if !ok {
+		d = &Deprecation{Name: name, Version: version, Message: message}
+		ictx.Deprecations[id] = d
+	}
+
+	for _, dir := range d.InstallDirs {
+		if dir == installDir {
+			return
+		}
+	}
+	d.InstallDirs = append(d.InstallDirs, installDir)
+}
+
+// SortedDeprecations returns deprecated packages which have been installed,
+// sorted by name and version
+func (ictx *InstallContext) SortedDeprecations() []*Deprecation {
+	ids := make([]string, 0, len(ictx.Deprecations))
+	for id := range ictx.Deprecations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	deprecations := make([]*Deprecation, 0, len(ids))
+	for _, id := range ids {
+		deprecations = append(deprecations, ictx.Deprecations[id])
+	}
+	return deprecations
+}
+
+// TreePath returns where installDir is in the dependency tree rooted at dir
+//
+//   node_modules/foo/node_modules/bar  =>  foo > bar
+//   packages/app/node_modules/foo      =>  packages/app > foo
+func TreePath(dir string, installDir string) string {
+	rel, err := filepath.Rel(dir, installDir)
+	if err != nil {
+		rel = installDir
+	}
+
+	parts := []string{}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "node_modules") {
+		part = strings.Trim(part, "/")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// integrityAlgorithms are the hash algorithms of subresource integrity strings
+// (ex: sha512-<base64>), weakest first
+var integrityAlgorithms = []string{"sha1", "sha256", "sha384", "sha512"}
+
+// IntegrityError is returned when downloaded contents do not match the
+// checksum published or locked for them
+type IntegrityError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+// Error returns string representation of the error
+func (e *IntegrityError) Error() string {
+	return Redact(fmt.Sprintf("Integrity check failed for %s: expected %s, downloaded %s",
+		e.URL, e.Expected, e.Actual))
+}
+
+// IntegrityReader hashes contents as they are read, so that downloads are
+// verified while they are extracted
+type IntegrityReader struct {
+	r      io.Reader
+	hashes map[string]hash.Hash
+}
+
+// NewIntegrityReader wraps r
+func NewIntegrityReader(r io.Reader) *IntegrityReader {
+	return &IntegrityReader{
+		r: r,
+		hashes: map[string]hash.Hash{
+			"sha1":   sha1.New(),
+			"sha256": sha256.New(),
+			"sha384": sha512.New384(),
+			"sha512": sha512.New(),
+		},
+	}
+}
+
+// Read reads from the wrapped reader, and hashes what is read
+func (ir *IntegrityReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	for _, h := range ir.hashes {
+		h.Write(p[:n])
+	}
+	return n, err
+}
+
+// Integrity returns the sha512 integrity of the whole contents. The rest of
+// the contents is read first, as extracting may stop before the end.
+func (ir *IntegrityReader) Integrity() (string, error) {
+	_, err := io.Copy(ioutil.Discard, ir)
+	if err != nil {
+		return "", err
+	}
+	return ir.sum("sha512"), nil
+}
+
+// Shasum returns the hex sha1 of the contents read so far
+func (ir *IntegrityReader) Shasum() string {
+	return hex.EncodeToString(ir.hashes["sha1"].Sum(nil))
+}
+
+// Verified returns a copy of dist whose checksums are computed from the
+// contents, which must have been checked with Verify. Checksums published by
+// registries are never recorded as they are, since Verify only checks one of
+// them.
+func (ir *IntegrityReader) Verified(dist *Dist) *Dist {
+	verified := *dist
+	verified.Integrity = ir.sum("sha512")
+	verified.Shasum = ir.Shasum()
+	return &verified
+}
+
+// Verify checks the whole contents against integrity, or against the hex sha1
+// shasum when integrity has no supported hash. The strongest hash of integrity
+// is used, and contents match when they match any of its values. Contents are
+// trusted when there is no checksum at all.
+func (ir *IntegrityReader) Verify(url string, integrity string, shasum string) error {
+	_, err := ir.Integrity()
+	if err != nil {
+		return err
+	}
+
+	expected := parseIntegrity(integrity)
+	for i := len(integrityAlgorithms) - 1; i >= 0; i-- {
+		algorithm := integrityAlgorithms[i]
+		if len(expected[algorithm]) == 0 {
+			continue
+		}
+
+		actual := ir.sum(algorithm)
+		for _, value := range expected[algorithm] {
+			if value == actual {
+				return nil
+			}
+		}
+		return &IntegrityError{URL: url, Expected: strings.Join(expected[algorithm], " "), Actual: actual}
+	}
+
+	if shasum != "" {
+		actual := ir.Shasum()
+		if !strings.EqualFold(shasum, actual) {
+			return &IntegrityError{URL: url, Expected: "shasum " + shasum, Actual: "shasum " + actual}
+		}
+	}
+
+	return nil
+}
+
+// IntegrityMatches returns true when the checksums recorded for some contents,
+// an integrity and a hex sha1 shasum, match the expected integrity. The
+// strongest hash of expected is compared, and contents whose checksums do not
+// include that algorithm do not match. Anything matches an empty expected
+// integrity.
+func IntegrityMatches(expected string, integrity string, shasum string) bool {
+	hashes := parseIntegrity(expected)
+	actual := parseIntegrity(integrity)
+	if sha1, err := hex.DecodeString(shasum); err == nil && len(sha1) > 0 {
+		actual["sha1"] = append(actual["sha1"], "sha1-"+base64.StdEncoding.EncodeToString(sha1))
+	}
+
+	for i := len(integrityAlgorithms) - 1; i >= 0; i-- {
+		algorithm := integrityAlgorithms[i]
+		if len(hashes[algorithm]) == 0 {
+			continue
+		}
+
+		for _, value := range hashes[algorithm] {
+			for _, other := range actual[algorithm] {
+				if value == other {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// sum returns the integrity string of the contents read so far
+func (ir *IntegrityReader) sum(algorithm string) string {
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(ir.hashes[algorithm].Sum(nil))
+}
+
+// parseIntegrity groups the hashes of a subresource integrity string by
+// algorithm. Options (ex: ?foo) and unsupported algorithms are ignored.
+//
+//   sha512-abc== sha1-def=  =>  {sha512: [sha512-abc==], sha1: [sha1-def=]}
+func parseIntegrity(integrity string) map[string][]string {
+	hashes := make(map[string][]string)
+	for _, value := range strings.Fields(integrity) {
+		value = strings.SplitN(value, "?", 2)[0]
+		parts := strings.SplitN(value, "-", 2)
+		if len(parts) == 2 {
+			hashes[parts[0]] = append(hashes[parts[0]], value)
+		}
+	}
+	return hashes
+}
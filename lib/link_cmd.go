@@ -0,0 +1,231 @@
+package lib
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+)
+
+// linkCmdInit parses flags shared by the link and unlink commands, and returns
+// the remaining arguments
+func linkCmdInit(name string, args []string) ([]string, error) {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	linkCmd := flag.NewFlagSet(name, flag.ExitOnError)
+	cwdFlag := linkCmd.String("C", cwd, "Set working directory")
+	verboseFlag := linkCmd.Bool("verbose", false, "Show verbose log output")
+	frostyHomeFlag := linkCmd.String("frosty-home", GetFrostyHome(),
+		"Location of frosty home directory")
+
+	linkCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+	ctx.FrostyHome = ResolvePath(*frostyHomeFlag, cwd)
+	ctx.NodeModulesDir = path.Join(ctx.Cwd, "node_modules")
+	ctx.PackagePath = path.Join(ctx.Cwd, "package.json")
+	ctx.Workspaces = nil
+
+	err = ConfigureNpm(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := LoadCache(path.Join(ctx.FrostyHome, "cache"))
+	if err != nil {
+		return nil, err
+	}
+	ctx.Cache = cache
+
+	return linkCmd.Args(), nil
+}
+
+// GetLinksDir returns directory where packages are registered by frosty link
+func GetLinksDir(frostyHome string) string {
+	return path.Join(frostyHome, "links")
+}
+
+// LinkCmdRun runs the link command
+//
+//   frosty link          -- register the package in the current directory
+//   frosty link <name>   -- link a registered package into ./node_modules
+func LinkCmdRun(args []string) error {
+	args, err := linkCmdInit("link", args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return registerLink(GetContext())
+	}
+
+	for _, name := range args {
+		err := linkPackage(GetContext(), name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnlinkCmdRun runs the unlink command
+//
+//   frosty unlink        -- unregister the package in the current directory
+//   frosty unlink <name> -- replace link in ./node_modules with a normal install
+func UnlinkCmdRun(args []string) error {
+	args, err := linkCmdInit("unlink", args)
+	if err != nil {
+		return err
+	}
+
+	ctx := GetContext()
+
+	if len(args) == 0 {
+		return unregisterLink(ctx)
+	}
+
+	ictx := NewInstallContext()
+	for _, name := range args {
+		err := unlinkPackage(ctx, name, ictx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Cache.Index.Commit()
+}
+
+// registerLink adds a symlink to the current package in the global links directory
+func registerLink(ctx *Context) error {
+	pkg, err := LoadPackage(ctx.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	if pkg.Name == "" {
+		return fmt.Errorf("Cannot link %s, package has no name", ctx.PackagePath)
+	}
+
+	link := path.Join(GetLinksDir(ctx.FrostyHome), pkg.Name)
+	err = replaceSymlink(pkg.Dir, link)
+	if err != nil {
+		return err
+	}
+
+	ctx.Info("Registered %s => %s", link, pkg.Dir)
+	return nil
+}
+
+// unregisterLink removes the current package from the global links directory
+func unregisterLink(ctx *Context) error {
+	pkg, err := LoadPackage(ctx.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	link := path.Join(GetLinksDir(ctx.FrostyHome), pkg.Name)
+	if _, err := os.Lstat(link); err != nil {
+		return fmt.Errorf("%s is not registered with frosty link", pkg.Name)
+	}
+
+	err = os.Remove(link)
+	if err != nil {
+		return err
+	}
+
+	ctx.Info("Unregistered %s", pkg.Name)
+	return nil
+}
+
+// linkPackage symlinks a registered package into node_modules, and links its bin entries
+func linkPackage(ctx *Context, name string) error {
+	registered := path.Join(GetLinksDir(ctx.FrostyHome), name)
+	target, err := os.Readlink(registered)
+	if err != nil {
+		return fmt.Errorf("%s is not registered, run frosty link in its directory first", name)
+	}
+
+	installDir := path.Join(ctx.NodeModulesDir, name)
+	err = replaceSymlink(target, installDir)
+	if err != nil {
+		return err
+	}
+
+	pkg, err := LoadPackageFromDir(installDir)
+	if err != nil {
+		return err
+	}
+
+	relBin, relModule := BinLinkPaths(name)
+	err = pkg.LinkBin(relBin, relModule)
+	if err != nil {
+		return err
+	}
+
+	ctx.Info("Linked %s => %s", installDir, target)
+	return nil
+}
+
+// unlinkPackage removes a linked package from node_modules, and installs the
+// version declared in package.json in its place
+func unlinkPackage(ctx *Context, name string, ictx *InstallContext) error {
+	installDir := path.Join(ctx.NodeModulesDir, name)
+	info, err := os.Lstat(installDir)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s is not linked in %s", name, ctx.NodeModulesDir)
+	}
+
+	// remove bin entries of the linked package, they are recreated by the install
+	linked, err := LoadPackageFromDir(installDir)
+	if err == nil {
+		for binName := range linked.Bin {
+			os.Remove(path.Join(ctx.NodeModulesDir, ".bin", binName))
+		}
+	}
+
+	err = os.Remove(installDir)
+	if err != nil {
+		return err
+	}
+	ctx.Info("Unlinked %s", installDir)
+
+	pkg, err := LoadPackage(ctx.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	version, ok := pkg.Dependencies[name]
+	if !ok {
+		version, ok = pkg.DevDependencies[name]
+	}
+	if !ok {
+		return nil
+	}
+
+	return installDep(name, version, installDir, ctx.Cwd, ictx)
+}
+
+// replaceSymlink creates symlink at link pointing to target, replacing whatever
+// is at link already
+func replaceSymlink(target string, link string) error {
+	err := os.MkdirAll(path.Dir(link), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(link); err == nil {
+		err = os.RemoveAll(link)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Symlink(target, link)
+}
@@ -0,0 +1,518 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockGraph is a resolved dependency tree, as recorded by lockfiles. Packages
+// are keyed by their location relative to the root package, which is keyed by
+// "" (ex: node_modules/foo/node_modules/bar). Workspaces are keyed by their
+// directory (ex: packages/app).
+type LockGraph struct {
+	Packages map[string]*LockNode
+}
+
+// LockNode is a package in a resolved dependency tree. Name is the name in
+// package.json, which differs from the install name for aliases. Resolved is
+// where the package was fetched from, or for links the location of the linked
+// package relative to the root package. Version is empty for packages which
+// are not versioned by a registry (ex: git dependencies).
+type LockNode struct {
+	Name                 string
+	Version              string
+	Resolved             string
+	Integrity            string
+	Link                 bool
+	Dev                  bool
+	Optional             bool
+	Peer                 bool
+	Dependencies         map[string]string
+	OptionalDependencies map[string]string
+	PeerDependencies     map[string]string
+	DevDependencies      map[string]string
+}
+
+// NewLockGraph creates an empty graph
+func NewLockGraph() *LockGraph {
+	return &LockGraph{Packages: make(map[string]*LockNode)}
+}
+
+// NewLockNode creates a node from a package.json file
+func NewLockNode(pkg *Package) *LockNode {
+	return &LockNode{
+		Name:                 pkg.Name,
+		Version:              pkg.Version,
+		Resolved:             pkg.Resolved,
+		Integrity:            pkg.Integrity,
+		Dependencies:         pkg.Dependencies,
+		OptionalDependencies: pkg.OptionalDependencies,
+		PeerDependencies:     pkg.PeerDependencies,
+		DevDependencies:      pkg.DevDependencies,
+	}
+}
+
+// LockPath returns the location of a package named name, installed in the
+// node_modules directory of the package at parent
+func LockPath(parent string, name string) string {
+	return path.Join(parent, "node_modules", name)
+}
+
+// LockPathName returns the install name of the package at p
+//
+//   node_modules/foo/node_modules/@scope/bar  =>  @scope/bar
+func LockPathName(p string) string {
+	i := strings.LastIndex(p, "node_modules/")
+	if i < 0 {
+		return path.Base(p)
+	}
+	return p[i+len("node_modules/"):]
+}
+
+// IsInstallPath returns true if p is inside a node_modules directory, as
+// opposed to the root package or a workspace
+func IsInstallPath(p string) bool {
+	return strings.HasPrefix(p, "node_modules/") || strings.Contains(p, "/node_modules/")
+}
+
+// CheckPaths returns an error when the graph would write or link outside of
+// the project at dir. Packages must be installed in the node_modules directory
+// of the root or of a workspace, other entries (ex: workspaces) and link
+// targets must be inside the project. Lockfiles come with the project, so they
+// are checked before anything is installed from them.
+func (g *LockGraph) CheckPaths(dir string, workspaces map[string]*Workspace) error {
+	installRoots := map[string]bool{"": true}
+	for _, ws := range workspaces {
+		rel, err := filepath.Rel(dir, ws.Dir)
+		if err == nil {
+			installRoots[filepath.ToSlash(rel)] = true
+		}
+	}
+
+	for _, p := range g.SortedPaths() {
+		if p == "" {
+			continue
+		}
+
+		if !isProjectPath(p) || path.Clean(p) != p {
+			return fmt.Errorf("Invalid lockfile entry %s, it is outside of the project", p)
+		}
+
+		if IsInstallPath(p) {
+			i := strings.Index(p, "node_modules/")
+			if !installRoots[strings.TrimSuffix(p[:i], "/")] {
+				return fmt.Errorf("Invalid lockfile entry %s, it is not in the node_modules of the project or of a workspace", p)
+			}
+		}
+
+		node := g.Packages[p]
+		if node.Link && !isProjectPath(node.Resolved) {
+			return fmt.Errorf("Invalid lockfile entry %s, it links to %s outside of the project", p, node.Resolved)
+		}
+	}
+
+	return nil
+}
+
+// isProjectPath returns true when relative path p stays inside the directory
+// it is relative to
+func isProjectPath(p string) bool {
+	p = path.Clean(p)
+	return p != ".." && !strings.HasPrefix(p, "../") && !path.IsAbs(p)
+}
+
+// lockParentPath returns the package whose node_modules contains p, or the
+// parent directory of p when it is not in a node_modules directory
+func lockParentPath(p string) string {
+	i := strings.LastIndex(p, "node_modules/")
+	if i >= 0 {
+		return strings.TrimSuffix(p[:i], "/")
+	}
+
+	parent := path.Dir(p)
+	if parent == "." || parent == "/" {
+		return ""
+	}
+	return parent
+}
+
+// SortedPaths returns the location of every package, parents first
+func (g *LockGraph) SortedPaths() []string {
+	paths := make([]string, 0, len(g.Packages))
+	for p := range g.Packages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Root returns the root package, which is empty when the lockfile does not
+// describe it
+func (g *LockGraph) Root() *LockNode {
+	root, ok := g.Packages[""]
+	if !ok {
+		root = &LockNode{}
+		g.Packages[""] = root
+	}
+	return root
+}
+
+// Children returns packages installed in the node_modules directory of the
+// package at parent, keyed by install name
+func (g *LockGraph) Children(parent string) map[string]string {
+	prefix := LockPath(parent, "")
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	children := make(map[string]string)
+	for p := range g.Packages {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		name := p[len(prefix):]
+		if !strings.Contains(name, "/node_modules/") {
+			children[name] = p
+		}
+	}
+	return children
+}
+
+// Resolve returns the location of the package name required by the package
+// at from, following the node_modules lookup of node.js
+func (g *LockGraph) Resolve(from string, name string) (string, bool) {
+	dir := from
+	for {
+		candidate := LockPath(dir, name)
+		if _, ok := g.Packages[candidate]; ok {
+			return candidate, true
+		}
+		if dir == "" {
+			return "", false
+		}
+		dir = lockParentPath(dir)
+	}
+}
+
+// MarkFlags sets the dev and optional flags of installed packages. Packages
+// are dev when they are only required through devDependencies of the root
+// package or of workspaces, and optional when they are only required through
+// optionalDependencies.
+func (g *LockGraph) MarkFlags() {
+	prod := g.reachable(func(p string, node *LockNode) []string {
+		return mergeDependencyNames(node.Dependencies, node.OptionalDependencies)
+	})
+
+	required := g.reachable(func(p string, node *LockNode) []string {
+		names := []string{}
+		for name := range node.Dependencies {
+			if _, optional := node.OptionalDependencies[name]; !optional {
+				names = append(names, name)
+			}
+		}
+		if !IsInstallPath(p) {
+			for name := range node.DevDependencies {
+				names = append(names, name)
+			}
+		}
+		return names
+	})
+
+	for p, node := range g.Packages {
+		if IsInstallPath(p) {
+			node.Dev = !prod[p]
+			node.Optional = !required[p]
+		}
+	}
+}
+
+// reachable returns locations of packages required by the root package and
+// by workspaces, following the requirements returned by edges
+func (g *LockGraph) reachable(edges func(p string, node *LockNode) []string) map[string]bool {
+	seen := make(map[string]bool)
+	queue := []string{""}
+	seen[""] = true
+
+	for p, node := range g.Packages {
+		if node.Link && !IsInstallPath(node.Resolved) && g.Packages[node.Resolved] != nil {
+			seen[p] = true
+			queue = append(queue, p)
+		}
+	}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		node, ok := g.Packages[p]
+		if !ok {
+			continue
+		}
+
+		// requirements of linked packages are resolved from the link target
+		if node.Link {
+			if !seen[node.Resolved] {
+				seen[node.Resolved] = true
+				queue = append(queue, node.Resolved)
+			}
+			continue
+		}
+
+		for _, name := range edges(p, node) {
+			dep, ok := g.Resolve(p, name)
+			if ok && !seen[dep] {
+				seen[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	return seen
+}
+
+func mergeDependencyNames(maps ...map[string]string) []string {
+	names := []string{}
+	for _, m := range maps {
+		for name := range m {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Unsatisfied returns the dependencies declared by the root package and by
+// workspaces which the graph does not satisfy, either because they are
+// missing or because the locked version does not match. Dependencies on
+// workspaces are linked, and optional dependencies may be missing.
+func (g *LockGraph) Unsatisfied(root *Package, workspaces map[string]*Workspace) []string {
+	froms := map[string]*Package{"": root}
+	for _, name := range SortedWorkspaceNames(workspaces) {
+		ws := workspaces[name]
+		rel, err := filepath.Rel(root.Dir, ws.Dir)
+		if err != nil {
+			continue
+		}
+		froms[filepath.ToSlash(rel)] = ws.Package
+	}
+
+	problems := []string{}
+	for from, pkg := range froms {
+		for _, deps := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.OptionalDependencies} {
+			for name, raw := range deps {
+				_, optional := pkg.OptionalDependencies[name]
+				problem := g.unsatisfied(from, name, raw, workspaces, optional)
+				if problem != "" {
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// unsatisfied describes why name@raw, required by the package at from, is not
+// satisfied by the graph, or returns "" when it is
+func (g *LockGraph) unsatisfied(from string, name string, raw string, workspaces map[string]*Workspace, optional bool) string {
+	spec, err := ParseSpec(name, raw)
+	if err != nil {
+		return fmt.Sprintf("%s@%s is not a valid dependency (%s)", name, raw, err.Error())
+	}
+
+	if ws, ok := workspaces[name]; ok && ws.Satisfies(spec) {
+		return ""
+	}
+
+	p, ok := g.Resolve(from, name)
+	if !ok {
+		if optional {
+			return ""
+		}
+		return fmt.Sprintf("%s@%s is missing", name, raw)
+	}
+
+	node := g.Packages[p]
+	if node.Link {
+		return ""
+	}
+
+	if spec.Type == AliasSpec {
+		if node.Name != spec.Alias.Name {
+			return fmt.Sprintf("%s@%s is locked to %s", name, raw, node.Name)
+		}
+		spec = spec.Alias
+	}
+
+	if (spec.Type == RangeSpec || spec.Type == VersionSpec) && !MatchesRange(node.Version, spec.Range) {
+		return fmt.Sprintf("%s@%s is locked at %s", name, raw, node.Version)
+	}
+	return ""
+}
+
+// BuildLockGraph records the packages installed in the node_modules tree of
+// the package in dir. Symlinked packages are recorded as links, and the
+// dependencies of linked workspaces are recorded as well.
+func BuildLockGraph(dir string) (*LockGraph, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, err := LoadPackageFromDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	g := NewLockGraph()
+	g.Packages[""] = NewLockNode(pkg)
+	g.Packages[""].Resolved = ""
+	g.Packages[""].Integrity = ""
+
+	err = g.addNodeModules(root, "")
+	if err != nil {
+		return nil, err
+	}
+
+	g.MarkFlags()
+	return g, nil
+}
+
+// addNodeModules records packages in the node_modules directory of parent
+func (g *LockGraph) addNodeModules(root string, parent string) error {
+	nodeModules := path.Join(root, parent, "node_modules")
+	entries, err := ioutil.ReadDir(nodeModules)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		names := []string{name}
+		if strings.HasPrefix(name, "@") {
+			scoped, err := ioutil.ReadDir(path.Join(nodeModules, name))
+			if err != nil {
+				return err
+			}
+			names = names[:0]
+			for _, s := range scoped {
+				names = append(names, name+"/"+s.Name())
+			}
+		}
+
+		for _, installName := range names {
+			err := g.addInstalled(root, LockPath(parent, installName), installName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addInstalled records the package installed at p
+func (g *LockGraph) addInstalled(root string, p string, installName string) error {
+	full := path.Join(root, p)
+	info, err := os.Lstat(full)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(full)
+		if err != nil {
+			GetContext().Debug("Skipping dangling link %s", full)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, target)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		pkg, err := LoadPackageFromDir(target)
+		if err != nil {
+			return err
+		}
+
+		g.Packages[p] = &LockNode{Name: pkg.Name, Version: pkg.Version, Resolved: rel, Link: true}
+
+		// linked workspaces are part of the tree, packages linked from
+		// outside of it (ex: frosty link) are not
+		if strings.HasPrefix(rel, "..") || g.Packages[rel] != nil {
+			return nil
+		}
+		g.Packages[rel] = NewLockNode(pkg)
+		return g.addNodeModules(root, rel)
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	pkg, err := LoadPackageFromDir(full)
+	if err != nil {
+		GetContext().Debug("Skipping %s (%s)", full, err.Error())
+		return nil
+	}
+
+	node := NewLockNode(pkg)
+	node.DevDependencies = nil
+	if node.Name == "" {
+		node.Name = installName
+	}
+	g.Packages[p] = node
+
+	return g.addNodeModules(root, p)
+}
+
+// FetchSpec returns the spec used to fetch the package at p. Packages are
+// fetched from where they were resolved, so the exact same contents are
+// installed.
+func (node *LockNode) FetchSpec(p string) (*Spec, error) {
+	name := node.Name
+	if name == "" {
+		name = LockPathName(p)
+	}
+
+	if node.Resolved != "" {
+		return ParseSpec(name, node.Resolved)
+	}
+	if node.Version == "" {
+		return nil, fmt.Errorf("%s has neither a version nor a resolved location", p)
+	}
+	return ParseSpec(name, node.Version)
+}
+
+// writeLockfileJSON writes v as indented JSON, with map keys sorted so that
+// lockfiles diff well. Unlike json.MarshalIndent, ranges such as >=1.0.0
+// are not escaped.
+func writeLockfileJSON(file string, v interface{}) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
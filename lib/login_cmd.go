@@ -0,0 +1,453 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// errWebLoginUnsupported is returned by registries without the web login endpoints
+var errWebLoginUnsupported = errors.New("Registry does not support web login")
+
+// authFlags are the flags shared by login, logout and whoami
+type authFlags struct {
+	cwd      *string
+	verbose  *bool
+	registry *string
+	scope    *string
+}
+
+func newAuthFlagSet(name string, cwd string) (*flag.FlagSet, *authFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, &authFlags{
+		cwd:      fs.String("C", cwd, "Set working directory"),
+		verbose:  fs.Bool("verbose", false, "Show verbose log output"),
+		registry: fs.String("registry", "", "Registry URL, overrides npmrc and env vars"),
+		scope:    fs.String("scope", "", "Use the registry of this scope (ex: @foo)"),
+	}
+}
+
+// configure loads npm configuration, and returns the selected registry and scope.
+// With -scope, the scope's registry is used, unless -registry is set as well.
+func (f *authFlags) configure(cwd string) (string, string, error) {
+	ctx := GetContext()
+	ctx.Cwd = ResolvePath(*f.cwd, cwd)
+	ctx.Verbose = *f.verbose
+
+	scope := *f.scope
+	if scope != "" && !strings.HasPrefix(scope, "@") {
+		scope = "@" + scope
+	}
+
+	npmFlags := make(map[string]string)
+	if *f.registry != "" {
+		registry := strings.TrimSuffix(*f.registry, "/")
+		npmFlags["registry"] = registry
+		if scope != "" {
+			npmFlags[scope+":registry"] = registry
+		}
+	}
+
+	err := ConfigureNpm(ctx, npmFlags, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	if scope != "" {
+		return ctx.Npmrc.ScopeRegistry(scope), scope, nil
+	}
+	return ctx.Npmrc.Registry(), "", nil
+}
+
+// WebLogin starts a web login, and waits for the user to complete it in a
+// browser. Returns the token issued by the registry.
+func (n *NpmRegistryClient) WebLogin(registry string, timeout time.Duration) (string, error) {
+	ctx := GetContext()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	res, err := n.RequestWithBody("POST", registry+"/-/v1/login", header, []byte("{}"))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed {
+		return "", errWebLoginUnsupported
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", &HTTPError{Method: "POST", URL: registry + "/-/v1/login", StatusCode: res.StatusCode, Attempts: 1}
+	}
+
+	login := struct {
+		LoginURL string `json:"loginUrl"`
+		DoneURL  string `json:"doneUrl"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&login)
+	if err != nil || login.LoginURL == "" || login.DoneURL == "" {
+		return "", fmt.Errorf("Invalid web login response from %s", registry)
+	}
+
+	ctx.Info("Open %s in a browser to log in", login.LoginURL)
+
+	// the registry answers 202 Accepted until the login is complete
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := n.Get(login.DoneURL)
+		if err != nil {
+			return "", err
+		}
+
+		if res.StatusCode == http.StatusAccepted {
+			delay, ok := retryAfter(res, n.MaxBackoff)
+			if !ok {
+				delay = time.Second
+			}
+			discard(res)
+
+			if time.Now().Add(delay).After(deadline) {
+				return "", fmt.Errorf("Timed out waiting for web login to %s", registry)
+			}
+			time.Sleep(delay)
+			continue
+		}
+
+		done := struct {
+			Token string `json:"token"`
+		}{}
+		err = json.NewDecoder(res.Body).Decode(&done)
+		res.Body.Close()
+		if err != nil || done.Token == "" {
+			return "", fmt.Errorf("Web login to %s did not return a token", registry)
+		}
+
+		RegisterSecret(done.Token)
+		return done.Token, nil
+	}
+}
+
+// LegacyLogin logs in with username and password, by creating (or updating)
+// the couchdb user document. otp is the one-time password of users with two
+// factor authentication, and may be empty. Returns the token issued by the
+// registry.
+func (n *NpmRegistryClient) LegacyLogin(registry string, username string, password string,
+	email string, otp string) (string, error) {
+	RegisterSecret(password)
+
+	userURL := registry + "/-/user/org.couchdb.user:" + url.PathEscape(username)
+	body, err := json.Marshal(map[string]interface{}{
+		"_id":      "org.couchdb.user:" + username,
+		"name":     username,
+		"password": password,
+		"email":    email,
+		"type":     "user",
+		"roles":    []string{},
+		"date":     time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if otp != "" {
+		header.Set("npm-otp", otp)
+	}
+
+	res, err := n.RequestWithBody("PUT", userURL, header, body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized &&
+		strings.Contains(strings.ToLower(res.Header.Get("WWW-Authenticate")), "otp"):
+		return "", fmt.Errorf("Login to %s requires a one-time password, pass it with -otp", registry)
+	case res.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("Incorrect username or password for %s", registry)
+	case res.StatusCode == http.StatusConflict:
+		return "", fmt.Errorf("User %s already exists on %s with a different password", username, registry)
+	case res.StatusCode < 200 || res.StatusCode >= 300:
+		return "", &HTTPError{Method: "PUT", URL: userURL, StatusCode: res.StatusCode, Attempts: 1}
+	}
+
+	login := struct {
+		Token string `json:"token"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&login)
+	if err != nil || login.Token == "" {
+		return "", fmt.Errorf("Login to %s did not return a token", registry)
+	}
+
+	RegisterSecret(login.Token)
+	return login.Token, nil
+}
+
+// Whoami returns the username the registry associates with our credentials
+func (n *NpmRegistryClient) Whoami(registry string) (string, error) {
+	whoamiURL := registry + "/-/whoami"
+	if n.Credentials.Lookup(whoamiURL) == nil {
+		return "", fmt.Errorf("Not logged in to %s, run frosty login", registry)
+	}
+
+	res, err := n.Get(whoamiURL)
+	if IsHTTPStatus(err, http.StatusUnauthorized) {
+		return "", fmt.Errorf("Not logged in to %s, the token was rejected", registry)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	whoami := struct {
+		Username string `json:"username"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&whoami)
+	if err != nil || whoami.Username == "" {
+		return "", fmt.Errorf("Invalid whoami response from %s", registry)
+	}
+
+	return whoami.Username, nil
+}
+
+// RevokeToken invalidates a token. Registries which cannot revoke tokens are
+// ignored.
+func (n *NpmRegistryClient) RevokeToken(registry string, token string) error {
+	tokenURL := registry + "/-/user/token/" + url.PathEscape(token)
+
+	res, err := n.Request("DELETE", tokenURL)
+	if err != nil {
+		return err
+	}
+	discard(res)
+
+	ok := res.StatusCode >= 200 && res.StatusCode < 300
+	if !ok && res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusMethodNotAllowed {
+		return &HTTPError{Method: "DELETE", URL: tokenURL, StatusCode: res.StatusCode, Attempts: 1}
+	}
+	return nil
+}
+
+// stdin is shared by prompts, so that input buffered by one prompt is not lost
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt reads a line from stdin
+func prompt(label string) (string, error) {
+	fmt.Print(label)
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("Cannot read %s", strings.TrimSuffix(label, ": "))
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptPassword reads a line from stdin like prompt, without echoing it when
+// stdin is a terminal. Input piped to stdin is read as is.
+func promptPassword(label string) (string, error) {
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Println()
+		}()
+	}
+	return prompt(label)
+}
+
+// stty changes settings of the terminal attached to stdin. Fails when stdin
+// is not a terminal.
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// LoginCmdRun runs the login command
+//
+//   frosty login [-registry <url>] [-scope @foo] [-auth-type web|legacy]
+//
+// The token is saved in the user npmrc, for the registry. With -scope, the
+// scope is set to use the registry as well. Legacy login reads the password
+// from the NPM_PASSWORD env var, or prompts for it.
+func LoginCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	loginCmd, flags := newAuthFlagSet("login", cwd)
+	authTypeFlag := loginCmd.String("auth-type", "web",
+		"web, or legacy to log in with username and password")
+	usernameFlag := loginCmd.String("username", "", "Username for legacy login (prompted when missing)")
+	emailFlag := loginCmd.String("email", "", "Email for legacy login")
+	otpFlag := loginCmd.String("otp", "", "One-time password for legacy login")
+	timeoutFlag := loginCmd.Duration("login-timeout", 5*time.Minute, "How long to wait for web login")
+
+	loginCmd.Parse(args)
+
+	if *authTypeFlag != "web" && *authTypeFlag != "legacy" {
+		return fmt.Errorf("Invalid auth type %s, use web or legacy", *authTypeFlag)
+	}
+
+	registry, scope, err := flags.configure(cwd)
+	if err != nil {
+		return err
+	}
+
+	var token string
+	if *authTypeFlag == "web" {
+		token, err = ctx.NpmRegistry.WebLogin(registry, *timeoutFlag)
+		if err == errWebLoginUnsupported {
+			ctx.Info("%s does not support web login, falling back to legacy login", registry)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if token == "" {
+		username, password := *usernameFlag, os.Getenv("NPM_PASSWORD")
+		if username == "" {
+			username, err = prompt("Username: ")
+			if err != nil {
+				return err
+			}
+		}
+		if password == "" {
+			password, err = promptPassword("Password: ")
+			if err != nil {
+				return err
+			}
+		}
+
+		token, err = ctx.NpmRegistry.LegacyLogin(registry, username, password, *emailFlag, *otpFlag)
+		if err != nil {
+			return err
+		}
+	}
+
+	values := map[string]string{NerfDart(registry) + ":_authToken": token}
+	if scope != "" {
+		values[scope+":registry"] = registry
+	}
+
+	userConfig := NpmrcPaths(ctx.Cwd)[1]
+	err = UpdateNpmrc(userConfig, values)
+	if err != nil {
+		return err
+	}
+
+	ctx.Info("Logged in to %s, token saved in %s", registry, userConfig)
+	return nil
+}
+
+// WhoamiCmdRun runs the whoami command, which prints the username of the
+// logged in user
+//
+//   frosty whoami [-registry <url>] [-scope @foo]
+func WhoamiCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	whoamiCmd, flags := newAuthFlagSet("whoami", cwd)
+	whoamiCmd.Parse(args)
+
+	registry, _, err := flags.configure(cwd)
+	if err != nil {
+		return err
+	}
+
+	username, err := ctx.NpmRegistry.Whoami(registry)
+	if err != nil {
+		return err
+	}
+
+	ctx.Print("%s", username)
+	return nil
+}
+
+// LogoutCmdRun runs the logout command. The token is revoked, and removed
+// from the npmrc files which hold it.
+//
+//   frosty logout [-registry <url>] [-scope @foo]
+func LogoutCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	logoutCmd, flags := newAuthFlagSet("logout", cwd)
+	logoutCmd.Parse(args)
+
+	registry, scope, err := flags.configure(cwd)
+	if err != nil {
+		return err
+	}
+
+	token := ctx.Npmrc.AuthToken(registry)
+	if token == "" {
+		return fmt.Errorf("Not logged in to %s", registry)
+	}
+
+	err = ctx.NpmRegistry.RevokeToken(registry, token)
+	if err != nil {
+		return err
+	}
+
+	// every file setting the token, whichever registry path it was set for
+	removals := make(map[string]map[string]string)
+	for key, value := range ctx.Npmrc.Values {
+		if !strings.HasSuffix(key, ":_authToken") || value != token {
+			continue
+		}
+
+		source := ctx.Npmrc.Sources[key]
+		if !IsFile(source) {
+			ctx.Info("The token for %s is set by %s, it must be removed there", registry, source)
+			continue
+		}
+
+		if removals[source] == nil {
+			removals[source] = make(map[string]string)
+		}
+		removals[source][key] = ""
+	}
+
+	if scope != "" {
+		userConfig := NpmrcPaths(ctx.Cwd)[1]
+		if removals[userConfig] == nil {
+			removals[userConfig] = make(map[string]string)
+		}
+		removals[userConfig][scope+":registry"] = ""
+	}
+
+	for file, values := range removals {
+		if !IsFile(file) {
+			continue
+		}
+
+		err = UpdateNpmrc(file, values)
+		if err != nil {
+			return err
+		}
+		ctx.Debug("Updated %s", file)
+	}
+
+	ctx.Info("Logged out of %s", registry)
+	return nil
+}
@@ -1,93 +1,441 @@
 package lib
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/sethmcl/gofrosty/vendor/nsemver"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"regexp"
+	neturl "net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
-// NpmRegistryClient interacts with a remote npm registry server
+// NpmRegistryClient interacts with a remote npm registry server. Packages of a
+// scope listed in Scopes are fetched from that scope's registry instead of RootURL.
+// Other packages which are missing from RootURL are looked up in Fallbacks.
 type NpmRegistryClient struct {
-	RootURL   string
-	AuthToken string
-}
+	RootURL        string
+	Scopes         map[string]string
+	Fallbacks      []string
+	Credentials    *Credentials
+	TagCache       *TagCache
+	PackumentCache *PackumentCache
+	HTTPClient     *http.Client
+	ReadTimeout    time.Duration
+	Retries        int
+	MinBackoff     time.Duration
+	MaxBackoff     time.Duration
 
-type npmInfo struct {
-	Versions map[string]interface{} `json:"versions"`
+	packuments flightGroup
 }
 
-// NewNpmRegistryClient create NpmRegistryClient
+// corgiAccept requests abbreviated packuments, which only contain the fields
+// needed to install a package
+const corgiAccept = "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*"
+
+// NewNpmRegistryClient create NpmRegistryClient. The token, if any, is only sent
+// to the registry at url.
 func NewNpmRegistryClient(url string, token string) *NpmRegistryClient {
+	credentials := NewCredentials()
+	if token != "" {
+		credentials.Add(url, &Credential{Token: token, Source: "NPM_TOKEN"})
+	}
+
 	return &NpmRegistryClient{
-		RootURL:   url,
-		AuthToken: token,
+		RootURL:     url,
+		Scopes:      make(map[string]string),
+		Credentials: credentials,
+		ReadTimeout: DefaultHTTPConfig().ReadTimeout,
+		Retries:     GetFetchRetries(),
+		MinBackoff:  250 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
 	}
 }
 
 // Get send GET request
 func (n *NpmRegistryClient) Get(url string) (*http.Response, error) {
-	res, err := n.Request("GET", url)
+	return n.GetWithHeader(url, nil)
+}
+
+// GetWithHeader send GET request with additional headers. Responses other than
+// 2xx and 304 Not Modified are returned as an *HTTPError.
+func (n *NpmRegistryClient) GetWithHeader(url string, header http.Header) (*http.Response, error) {
+	res, attempts, err := n.do("GET", url, header, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	if res.StatusCode >= 400 && res.StatusCode <= 500 {
-		return nil, fmt.Errorf("HTTP %d response", res.StatusCode)
+	ok := res.StatusCode >= 200 && res.StatusCode < 300
+	if !ok && res.StatusCode != http.StatusNotModified {
+		discard(res)
+		return nil, &HTTPError{
+			Method:     "GET",
+			URL:        url,
+			StatusCode: res.StatusCode,
+			Attempts:   attempts,
+		}
 	}
 
 	return res, nil
 }
 
+// Download sends GET request, and passes the response to read, which consumes
+// its body. When the body stalls (see ReadTimeoutError), the request is sent
+// again and read again, with the same backoff as failed requests.
+func (n *NpmRegistryClient) Download(url string, header http.Header, read func(*http.Response) error) error {
+	attempt := 0
+	for {
+		attempt++
+
+		res, err := n.GetWithHeader(url, header)
+		if err != nil {
+			return err
+		}
+
+		err = read(res)
+		res.Body.Close()
+		if _, stalled := err.(*ReadTimeoutError); !stalled {
+			return err
+		}
+
+		if attempt > n.Retries {
+			return &HTTPError{Method: "GET", URL: url, Attempts: attempt, Err: err}
+		}
+
+		delay := backoff(attempt, n.MinBackoff, n.MaxBackoff)
+		GetContext().Info("GET %s failed (%s), retrying in %s", url, err.Error(), delay)
+		time.Sleep(delay)
+	}
+}
+
 // Request send request
 func (n *NpmRegistryClient) Request(method string, url string) (*http.Response, error) {
-	GetContext().Info("%s %s", method, url)
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, err
+	return n.RequestWithHeader(method, url, nil)
+}
+
+// RequestWithHeader send request with additional headers. Network errors, 5xx and
+// 429 responses are retried; the last response is returned when retries run out.
+func (n *NpmRegistryClient) RequestWithHeader(method string, url string, header http.Header) (*http.Response, error) {
+	res, _, err := n.do(method, url, header, nil)
+	return res, err
+}
+
+// RequestWithBody send request with a body (ex: the document PUT by publish).
+// The request is only sent again when no connection could be made, since it
+// may not be safe to repeat once the registry received it.
+func (n *NpmRegistryClient) RequestWithBody(method string, url string, header http.Header, body []byte) (*http.Response, error) {
+	res, _, err := n.do(method, url, header, body)
+	return res, err
+}
+
+// do sends request, retrying with exponential backoff. Returns the response along
+// with the number of attempts made. body may be nil. Requests with a body
+// (ex: publish) may not be idempotent, so they are only sent again when no
+// connection could be made. Response bodies fail with a *ReadTimeoutError when
+// they stall for longer than ReadTimeout (see Download).
+func (n *NpmRegistryClient) do(method string, url string, header http.Header, body []byte) (*http.Response, int, error) {
+	ctx := GetContext()
+	ctx.Info("%s %s", method, url)
+
+	client := n.HTTPClient
+	if client == nil {
+		var err error
+		client, err = SharedHTTPClient(DefaultHTTPConfig())
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	attempt := 0
+	for {
+		attempt++
+
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+
+		reqCtx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequest(method, url, reader)
+		if err != nil {
+			cancel()
+			return nil, attempt, err
+		}
+		req = req.WithContext(reqCtx)
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		if cred := n.Credentials.Lookup(url); cred != nil {
+			ctx.Debug("Attaching credentials from %s to request", cred.Source)
+			req.Header.Set("authorization", cred.Header())
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			cancel()
+		} else {
+			res.Body = newIdleTimeoutBody(res.Body, n.ReadTimeout, cancel)
+		}
+
+		if err == nil && !isRetryableStatus(res.StatusCode) {
+			return res, attempt, nil
+		}
+
+		sent := err == nil || !isDialError(err)
+		if attempt > n.Retries || (body != nil && sent) {
+			if err != nil {
+				return nil, attempt, &HTTPError{Method: method, URL: url, Attempts: attempt, Err: err}
+			}
+			return res, attempt, nil
+		}
+
+		delay := backoff(attempt, n.MinBackoff, n.MaxBackoff)
+		if err != nil {
+			ctx.Info("%s %s failed (%s), retrying in %s", method, url, err.Error(), delay)
+		} else {
+			if d, ok := retryAfter(res, n.MaxBackoff); ok {
+				delay = d
+			}
+			ctx.Info("%s %s returned HTTP %d, retrying in %s", method, url, res.StatusCode, delay)
+			discard(res)
+		}
+		time.Sleep(delay)
 	}
+}
+
+// RegistryFor returns root url of the registry which hosts a module
+//
+//   @foo/bar => registry configured for @foo, or RootURL
+func (n *NpmRegistryClient) RegistryFor(name string) string {
+	return n.Registries(name)[0]
+}
 
-	if n.IsRegistryURL(url) && n.AuthToken != "" {
-		ctx := GetContext()
-		ctx.Debug("Attaching NPM token (%s) to request", ctx.NpmAuthToken)
-		auth := fmt.Sprintf("Bearer %s", n.AuthToken)
-		req.Header.Add("authorization", auth)
+// Registries returns the registries a module is looked up in, in order. Scopes
+// with a registry of their own do not fall back to other registries.
+func (n *NpmRegistryClient) Registries(name string) []string {
+	if strings.HasPrefix(name, "@") && strings.Contains(name, "/") {
+		if registry, ok := n.Scopes[name[:strings.Index(name, "/")]]; ok {
+			return []string{registry}
+		}
 	}
+	return append([]string{n.RootURL}, n.Fallbacks...)
+}
 
-	return client.Do(req)
+// PackumentURL returns url of the packument of a module
+func (n *NpmRegistryClient) PackumentURL(name string) string {
+	return packumentURL(n.RegistryFor(name), name)
 }
 
-// ListModuleVersions return slice of available versions for a given module
-func (n *NpmRegistryClient) ListModuleVersions(name string) ([]string, error) {
+func packumentURL(registry string, name string) string {
 	encodeName := strings.Replace(name, "/", "%2f", -1)
-	url := fmt.Sprintf("%s/%s", n.RootURL, encodeName)
-	res, err := n.Get(url)
+	return fmt.Sprintf("%s/%s", registry, encodeName)
+}
+
+// GetPackument fetches the abbreviated packument of a module from the registry.
+// This contains everything needed to install the module.
+func (n *NpmRegistryClient) GetPackument(name string) (*Packument, error) {
+	return n.fetchPackument(name, false)
+}
+
+// GetFullPackument fetches the complete packument of a module from the registry,
+// which includes fields such as maintainers and readme
+func (n *NpmRegistryClient) GetFullPackument(name string) (*Packument, error) {
+	return n.fetchPackument(name, true)
+}
+
+// fetchPackument returns packument from the first registry which has the module.
+// Registries which do not have it, or cannot be reached, are skipped.
+func (n *NpmRegistryClient) fetchPackument(name string, full bool) (*Packument, error) {
+	var lastErr error
+	for _, registry := range n.Registries(name) {
+		packument, err := n.fetchPackumentFrom(registry, name, full)
+		if err == nil {
+			return packument, nil
+		}
+		if !isFallthrough(err) {
+			return nil, err
+		}
+		lastErr = err
+		GetContext().Info("%s is not available from %s (%s)", name, registry, err.Error())
+	}
+	return nil, lastErr
+}
+
+// isFallthrough returns true for errors which mean the next registry should be
+// tried: the module was not found, or the registry could not be reached
+func isFallthrough(err error) bool {
+	httpErr, ok := err.(*HTTPError)
+	if !ok {
+		return false
+	}
+	return httpErr.Err != nil || httpErr.StatusCode == http.StatusNotFound ||
+		isRetryableStatus(httpErr.StatusCode)
+}
+
+// fetchPackumentFrom returns packument from PackumentCache when it is fresh.
+// Otherwise the cached packument is revalidated with the registry, or fetched
+// when missing. Concurrent fetches of the same packument share a single request.
+func (n *NpmRegistryClient) fetchPackumentFrom(registry string, name string, full bool) (*Packument, error) {
+	key := fmt.Sprintf("%s %s %t", registry, name, full)
+	packument, err := n.packuments.Do(key, func() (interface{}, error) {
+		return n.loadPackument(registry, name, full)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
+	return packument.(*Packument), nil
+}
+
+func (n *NpmRegistryClient) loadPackument(registry string, name string, full bool) (*Packument, error) {
+	ctx := GetContext()
+
+	decode := func(body []byte) (*Packument, error) {
+		packument, err := decodePackument(registry, name, body)
+		if err == nil && full {
+			packument.Raw = body
+		}
+		return packument, err
+	}
+
+	var cached *PackumentCacheEntry
+	if n.PackumentCache != nil {
+		cached = n.PackumentCache.Get(registry, name, full)
+		if cached != nil && n.PackumentCache.Fresh(cached) {
+			ctx.Debug("PACKUMENT CACHE HIT %s", name)
+			return decode(cached.Packument)
+		}
+	}
 
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return nil, fmt.Errorf("Unable to fetch module versions for %s", name)
+	header := http.Header{}
+	header.Set("Accept", corgiAccept)
+	if full {
+		header.Set("Accept", "application/json")
 	}
 
-	info := &npmInfo{}
-	err = json.NewDecoder(res.Body).Decode(info)
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	var res *http.Response
+	var body []byte
+	err := n.Download(packumentURL(registry, name), header, func(r *http.Response) error {
+		res = r
+		if r.StatusCode == http.StatusNotModified {
+			return nil
+		}
+
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var versionList []string
-	// GetContext().Info("%s versions: %s", name, info.Versions)
-	for version := range info.Versions {
-		versionList = append(versionList, version)
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		ctx.Debug("PACKUMENT NOT MODIFIED %s", name)
+		cached.FetchedAt = time.Now()
+		err = n.PackumentCache.Put(registry, name, full, cached)
+		if err != nil {
+			return nil, err
+		}
+		return decode(cached.Packument)
+	}
+
+	if res.StatusCode == http.StatusNotModified {
+		return nil, fmt.Errorf("Unexpected HTTP 304 response for %s", name)
 	}
 
-	return versionList, nil
+	packument, err := decode(body)
+	if err != nil {
+		return nil, err
+	}
 
+	if n.PackumentCache != nil {
+		err = n.PackumentCache.Put(registry, name, full, &PackumentCacheEntry{
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+			Packument:    body,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return packument, nil
+}
+
+func decodePackument(registry string, name string, body []byte) (*Packument, error) {
+	packument := &Packument{Registry: registry}
+	err := json.Unmarshal(body, packument)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid packument for %s :: %s", name, err.Error())
+	}
+
+	if packument.Name == "" {
+		packument.Name = name
+	}
+	packument.Normalize()
+
+	return packument, nil
+}
+
+// ResolveTag returns the version a dist-tag (ex: latest, next) points to.
+// Resolutions are remembered in TagCache, if one is configured, along with the
+// registry which served the packument.
+func (n *NpmRegistryClient) ResolveTag(name string, tag string) (string, error) {
+	if n.TagCache != nil {
+		for _, registry := range n.Registries(name) {
+			if version, ok := n.TagCache.Get(registry, name, tag); ok {
+				return version, nil
+			}
+		}
+	}
+
+	packument, err := n.GetPackument(name)
+	if err != nil {
+		return "", fmt.Errorf("Cannot resolve %s@%s :: %s", name, tag, err.Error())
+	}
+
+	version, ok := packument.DistTags[tag]
+	if !ok {
+		tags := make([]string, 0, len(packument.DistTags))
+		for t := range packument.DistTags {
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+		return "", fmt.Errorf("%s has no dist-tag %s (available: %s)",
+			name, tag, strings.Join(tags, ", "))
+	}
+
+	if n.TagCache != nil {
+		n.TagCache.Add(packument.Registry, name, tag, version)
+	}
+
+	return version, nil
+}
+
+// ListModuleVersions return slice of available versions for a given module
+func (n *NpmRegistryClient) ListModuleVersions(name string) ([]string, error) {
+	packument, err := n.GetPackument(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return packument.VersionList(), nil
 }
 
 // GetAPIURL returns API url
@@ -97,39 +445,98 @@ func (n *NpmRegistryClient) GetAPIURL(cmd string) string {
 
 // GenTarURL return url to tar file hosted by registry
 func (n *NpmRegistryClient) GenTarURL(name string, version string) string {
+	return genTarURL(n.RegistryFor(name), name, version)
+}
+
+func genTarURL(registry string, name string, version string) string {
 	// Scoped package
 	// Example: @foo/biz => https://registry.npmjs.org/@foo/biz/-/biz-1.0.0.tgz
 	if strings.Contains(name, "/") {
 		parts := strings.Split(name, "/")
-		return fmt.Sprintf("%s/%s/-/%s-%s.tgz", n.RootURL, name, parts[1], version)
+		return fmt.Sprintf("%s/%s/-/%s-%s.tgz", registry, name, parts[1], version)
 	}
 
 	// Global package
 	// Example: bar => https://registry.npmjs.org/bar/-/bar-1.0.0.tgz
-	return fmt.Sprintf("%s/%s/-/%s-%s.tgz", n.RootURL, name, name, version)
+	return fmt.Sprintf("%s/%s/-/%s-%s.tgz", registry, name, name, version)
 }
 
-// GetTarURL returns url to tar file hosted by registry. Will resolve version if specified as range.
-func (n *NpmRegistryClient) GetTarURL(name string, version string) (string, error) {
+// ResolveVersion returns manifest of the newest published version which satisfies
+// the version range. Registries are tried in order, so a mirror which lags
+// behind falls through to the next registry when it has no matching version.
+func (n *NpmRegistryClient) ResolveVersion(name string, version string) (*PackumentVersion, error) {
 	ctx := GetContext()
 
-	candidates, err := ctx.NpmRegistry.ListModuleVersions(name)
-	if err != nil {
-		ctx.DumpStack()
-		return "", fmt.Errorf("Cannot list module versions for %s :: %s", name, err.Error())
+	var firstErr error
+	for _, registry := range n.Registries(name) {
+		packument, err := n.fetchPackumentFrom(registry, name, false)
+		if err != nil && isFallthrough(err) {
+			ctx.Info("%s is not available from %s (%s)", name, registry, err.Error())
+			if firstErr == nil {
+				firstErr = fmt.Errorf("Cannot list module versions for %s :: %s", name, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			ctx.DumpStack()
+			return nil, fmt.Errorf("Cannot list module versions for %s :: %s", name, err.Error())
+		}
+
+		ver, err := nsemver.MatchLatest(version, packument.VersionList())
+		if err != nil {
+			ctx.Debug("%s has no version of %s matching %s", registry, name, version)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		return packument.Get(ver)
 	}
 
-	ver, err := nsemver.MatchLatest(version, candidates)
+	ctx.DumpStack()
+	return nil, firstErr
+}
+
+// GetTarURL returns url to tar file hosted by registry. Will resolve version if specified as range.
+// The tarball URL advertised by the registry is used, when there is one.
+func (n *NpmRegistryClient) GetTarURL(name string, version string) (string, error) {
+	manifest, err := n.ResolveVersion(name, version)
 	if err != nil {
-		ctx.DumpStack()
 		return "", err
 	}
 
-	return n.GenTarURL(name, ver), nil
+	if manifest.Dist.Tarball != "" {
+		return manifest.Dist.Tarball, nil
+	}
+
+	return genTarURL(manifest.Registry, name, manifest.Version), nil
 }
 
-// IsRegistryURL returns true if this URL points to the npm registry
-func (n *NpmRegistryClient) IsRegistryURL(url string) bool {
-	match, _ := regexp.MatchString(fmt.Sprintf("^%s", n.RootURL), url)
-	return match
+// IsRegistryURL returns true if this URL points to the default registry, or the
+// registry of a scope
+func (n *NpmRegistryClient) IsRegistryURL(rawURL string) bool {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	roots := append([]string{n.RootURL}, n.Fallbacks...)
+	for _, registry := range n.Scopes {
+		roots = append(roots, registry)
+	}
+
+	for _, root := range roots {
+		r, err := neturl.Parse(root)
+		if err != nil || !strings.EqualFold(u.Scheme, r.Scheme) || !strings.EqualFold(u.Host, r.Host) {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(r.Path, "/") + "/"
+		if strings.HasPrefix(u.Path+"/", prefix) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,443 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Npmrc is the merged npm configuration. Values are layered, with later layers
+// overriding earlier ones:
+//
+//   defaults < global npmrc < user npmrc < project npmrc < env vars < flags
+//
+// The global npmrc is $NPM_CONFIG_GLOBALCONFIG or /usr/local/etc/npmrc, the
+// user npmrc is $NPM_CONFIG_USERCONFIG or ~/.npmrc, and the project npmrc is
+// .npmrc in the working directory. Env vars are npm_config_<key> (ex:
+// npm_config_strict_ssl), along with NPM_REGISTRY_URL and NPM_TOKEN.
+type Npmrc struct {
+	Values  map[string]string
+	Sources map[string]string
+}
+
+var npmrcEnvRe = regexp.MustCompile(`(\\*)\$\{([^}]+)\}`)
+
+// npmrcDefaults are used when no layer sets a value
+var npmrcDefaults = map[string]string{
+	"registry":   "https://registry.npmjs.org/",
+	"strict-ssl": "true",
+}
+
+// ParseNpmrc parses the contents of an npmrc file. ${VAR} references are
+// replaced with environment variables; \${VAR} is kept as is. Array keys
+// (ex: ca[]) are joined with newlines.
+func ParseNpmrc(contents string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+
+		key, value := line, "true"
+		if i := strings.Index(line, "="); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+			value = strings.TrimSpace(line[i+1:])
+		}
+
+		key, err := expandNpmrcEnv(key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err = expandNpmrcEnv(unquoteNpmrc(value))
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasSuffix(key, "[]") {
+			key = strings.TrimSuffix(key, "[]")
+			if values[key] != "" {
+				value = values[key] + "\n" + value
+			}
+		}
+
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// unquoteNpmrc strips quotes from a value. Double quoted values are decoded
+// as JSON strings, like npm does.
+func unquoteNpmrc(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		var s string
+		if json.Unmarshal([]byte(value), &s) == nil {
+			return s
+		}
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
+
+// expandNpmrcEnv replaces ${VAR} with the value of the environment variable.
+// A reference to an unset variable is an error.
+func expandNpmrcEnv(s string) (string, error) {
+	var err error
+	s = npmrcEnvRe.ReplaceAllStringFunc(s, func(match string) string {
+		parts := npmrcEnvRe.FindStringSubmatch(match)
+		escapes, name := parts[1], parts[2]
+
+		// an odd number of backslashes escapes the reference
+		if len(escapes)%2 == 1 {
+			return escapes[1:] + "${" + name + "}"
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			err = fmt.Errorf("Failed to replace env in config: ${%s}", name)
+		}
+		return escapes + value
+	})
+	return s, err
+}
+
+// NpmrcPaths returns the global, user and project npmrc files, in that order
+func NpmrcPaths(cwd string) []string {
+	global := os.Getenv("NPM_CONFIG_GLOBALCONFIG")
+	if global == "" {
+		global = "/usr/local/etc/npmrc"
+	}
+
+	user := os.Getenv("NPM_CONFIG_USERCONFIG")
+	if user == "" {
+		user = path.Join(os.Getenv("HOME"), ".npmrc")
+	}
+
+	return []string{global, user, path.Join(cwd, ".npmrc")}
+}
+
+// UpdateNpmrc sets keys of an npmrc file, keeping its other lines (comments
+// included) as they are. Keys with an empty value are removed. The file is
+// created when missing, readable by its owner only since it may hold tokens.
+func UpdateNpmrc(file string, values map[string]string) error {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	written := make(map[string]bool)
+	lines := []string{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		key := strings.TrimSpace(strings.SplitN(line, "=", 2)[0])
+		value, ok := values[key]
+		if !ok || !strings.Contains(line, "=") {
+			lines = append(lines, line)
+			continue
+		}
+
+		if value != "" && !written[key] {
+			lines = append(lines, key+"="+value)
+		}
+		written[key] = true
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, key := range keys {
+		if !written[key] && values[key] != "" {
+			lines = append(lines, key+"="+values[key])
+		}
+	}
+
+	err = os.MkdirAll(path.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+
+	// WriteFile keeps the mode of existing files
+	return os.Chmod(file, 0600)
+}
+
+// LoadNpmrc loads npm configuration for the project in cwd. flags are applied
+// on top of every other layer.
+func LoadNpmrc(cwd string, flags map[string]string) (*Npmrc, error) {
+	c := &Npmrc{
+		Values:  make(map[string]string),
+		Sources: make(map[string]string),
+	}
+	c.merge(npmrcDefaults, "default")
+
+	for _, file := range NpmrcPaths(cwd) {
+		if !IsFile(file) {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := ParseNpmrc(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%s :: %s", file, err.Error())
+		}
+		c.merge(values, file)
+	}
+
+	c.merge(npmrcEnvValues(), "env")
+
+	// NPM_TOKEN belongs to whichever registry is in effect after env vars
+	if token := GetNpmAuthToken(); token != "" {
+		registry := c.Registry()
+		if flags["registry"] != "" {
+			registry = strings.TrimSuffix(flags["registry"], "/")
+		}
+		c.merge(map[string]string{NerfDart(registry) + ":_authToken": token}, "env")
+	}
+
+	c.merge(flags, "flag")
+	return c, nil
+}
+
+// npmrcEnvValues returns configuration set by env vars
+func npmrcEnvValues() map[string]string {
+	values := make(map[string]string)
+
+	for _, kv := range os.Environ() {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(strings.ToLower(kv[:i]), "npm_config_") {
+			continue
+		}
+
+		key := strings.ToLower(kv[len("npm_config_"):i])
+		if key == "userconfig" || key == "globalconfig" || kv[i+1:] == "" {
+			continue
+		}
+		values[strings.Replace(key, "_", "-", -1)] = kv[i+1:]
+	}
+
+	if registry := os.Getenv("NPM_REGISTRY_URL"); registry != "" {
+		values["registry"] = registry
+	}
+
+	return values
+}
+
+func (c *Npmrc) merge(values map[string]string, source string) {
+	for k, v := range values {
+		c.Values[k] = v
+		c.Sources[k] = source
+
+		// credentials are masked in logs, even those overridden by later layers
+		if isNpmrcSecret(k) {
+			RegisterSecret(v)
+		}
+	}
+}
+
+// isNpmrcSecret returns true for keys which hold credentials
+func isNpmrcSecret(key string) bool {
+	for _, suffix := range []string{"_authToken", "_auth", "_password"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns configuration value, or "" if it is not set
+func (c *Npmrc) Get(key string) string {
+	return c.Values[key]
+}
+
+// GetBool returns true unless the value is unset, "false" or "0"
+func (c *Npmrc) GetBool(key string) bool {
+	v := strings.ToLower(c.Values[key])
+	return v != "" && v != "false" && v != "0"
+}
+
+// Registry returns the default registry URL, without trailing slash
+func (c *Npmrc) Registry() string {
+	return strings.TrimSuffix(c.Get("registry"), "/")
+}
+
+// ScopeRegistry returns registry for a scope (ex: @foo), falling back to the
+// default registry when the scope has none configured
+func (c *Npmrc) ScopeRegistry(scope string) string {
+	if registry := c.Get(scope + ":registry"); registry != "" {
+		return strings.TrimSuffix(registry, "/")
+	}
+	return c.Registry()
+}
+
+// Fallbacks returns registries tried, in order, when a package is missing from
+// the default registry. fallback-registry is a comma separated list, or an
+// array (fallback-registry[]).
+func (c *Npmrc) Fallbacks() []string {
+	fallbacks := []string{}
+	for _, registry := range strings.FieldsFunc(c.Get("fallback-registry"), func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		registry = strings.TrimSuffix(strings.TrimSpace(registry), "/")
+		if registry != "" {
+			fallbacks = append(fallbacks, registry)
+		}
+	}
+	return fallbacks
+}
+
+// Scopes returns registry of every scope with one configured (ex: @foo:registry)
+func (c *Npmrc) Scopes() map[string]string {
+	scopes := make(map[string]string)
+	for key, value := range c.Values {
+		if strings.HasPrefix(key, "@") && strings.HasSuffix(key, ":registry") {
+			scopes[strings.TrimSuffix(key, ":registry")] = strings.TrimSuffix(value, "/")
+		}
+	}
+	return scopes
+}
+
+// AuthToken returns bearer token configured for a URL
+func (c *Npmrc) AuthToken(rawURL string) string {
+	credentials, _ := LoadCredentials(c, "")
+	cred := credentials.find(rawURL, func(cred *Credential) bool { return cred.Token != "" })
+	if cred != nil {
+		return cred.Token
+	}
+	return ""
+}
+
+// BasicAuth returns base64 encoded user:password configured for a URL
+func (c *Npmrc) BasicAuth(rawURL string) string {
+	credentials, _ := LoadCredentials(c, "")
+	cred := credentials.find(rawURL, func(cred *Credential) bool { return cred.Basic != "" })
+	if cred != nil {
+		return cred.Basic
+	}
+	return ""
+}
+
+// NerfDart returns the scheme-less form of a URL, which npmrc uses as the
+// prefix of per-registry keys. The path is treated as a directory, since
+// registry URLs are stored without trailing slash.
+//
+//   https://registry.npmjs.org  => //registry.npmjs.org/
+//   https://example.com/npm     => //example.com/npm/
+func NerfDart(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	p := u.Path
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+
+	return "//" + u.Host + p
+}
+
+// HTTPConfig returns transport settings from the configuration. Proxy env vars
+// (ex: HTTPS_PROXY) apply when the configuration has no proxy settings.
+func (c *Npmrc) HTTPConfig() *HTTPConfig {
+	config := DefaultHTTPConfig()
+	config.StrictSSL = c.GetBool("strict-ssl")
+
+	settings := map[string]*string{
+		"proxy":       &config.Proxy,
+		"https-proxy": &config.HTTPSProxy,
+		"noproxy":     &config.NoProxy,
+		"ca":          &config.CA,
+		"cafile":      &config.CAFile,
+		"cert":        &config.Cert,
+		"certfile":    &config.CertFile,
+		"key":         &config.Key,
+		"keyfile":     &config.KeyFile,
+	}
+	for key, field := range settings {
+		if value := c.Get(key); value != "" {
+			*field = value
+		}
+	}
+
+	return config
+}
+
+// NewRegistryClient creates client for the default and scoped registries, with
+// credentials from the configuration and ~/.netrc
+func (c *Npmrc) NewRegistryClient(httpConfig *HTTPConfig) (*NpmRegistryClient, error) {
+	credentials, err := LoadCredentials(c, GetNetrcPath())
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewNpmRegistryClient(c.Registry(), "")
+	client.Credentials = credentials
+	client.Scopes = c.Scopes()
+	client.Fallbacks = c.Fallbacks()
+	client.ReadTimeout = httpConfig.ReadTimeout
+
+	client.HTTPClient, err = SharedHTTPClient(httpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ConfigureNpm loads npmrc files for the project in ctx.Cwd, and replaces
+// ctx.NpmRegistry with a client configured from them. customize may adjust the
+// HTTP settings before the client is created.
+func ConfigureNpm(ctx *Context, flags map[string]string, customize func(*HTTPConfig)) error {
+	npmrc, err := LoadNpmrc(ctx.Cwd, flags)
+	if err != nil {
+		return err
+	}
+
+	httpConfig := npmrc.HTTPConfig()
+	if customize != nil {
+		customize(httpConfig)
+	}
+
+	registry, err := npmrc.NewRegistryClient(httpConfig)
+	if err != nil {
+		return err
+	}
+
+	ctx.Npmrc = npmrc
+	ctx.NpmRegistry = registry
+	ctx.NpmAuthToken = npmrc.AuthToken(registry.RootURL)
+	ctx.Debug("Using registry %s (from %s)", registry.RootURL, npmrc.Sources["registry"])
+	return nil
+}
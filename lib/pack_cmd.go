@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Tarball is a packed package, ready to be published
+type Tarball struct {
+	Name      string
+	Version   string
+	Filename  string
+	Files     []string
+	Data      []byte
+	Shasum    string
+	Integrity string
+}
+
+// TarballFilename returns name of the file npm pack writes for a version
+//
+//   foo, 1.0.0 => foo-1.0.0.tgz
+//   @scope/foo, 1.0.0 => scope-foo-1.0.0.tgz
+func TarballFilename(name string, version string) string {
+	name = strings.Replace(strings.TrimPrefix(name, "@"), "/", "-", -1)
+	return fmt.Sprintf("%s-%s.tgz", name, version)
+}
+
+// PackPackage packs the files of pkg selected by PackFiles. Files are stored
+// under package/ with fixed ordering and timestamps, so packing the same
+// files again produces the same bytes. Scripts are not run.
+func PackPackage(pkg *Package) (*Tarball, error) {
+	if pkg.Name == "" || pkg.Version == "" {
+		return nil, fmt.Errorf("Cannot pack %s, name and version are required", pkg.Filepath)
+	}
+
+	files, err := PackFiles(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = CreateTar(buf, pkg.Dir, files, "package")
+	if err != nil {
+		return nil, err
+	}
+
+	data := buf.Bytes()
+	sha1sum := sha1.Sum(data)
+	sha512sum := sha512.Sum512(data)
+
+	return &Tarball{
+		Name:      pkg.Name,
+		Version:   pkg.Version,
+		Filename:  TarballFilename(pkg.Name, pkg.Version),
+		Files:     files,
+		Data:      data,
+		Shasum:    hex.EncodeToString(sha1sum[:]),
+		Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sha512sum[:]),
+	}, nil
+}
+
+// packWithScripts runs the prepack and prepare scripts, packs the package in dir,
+// then runs postpack. package.json is loaded after prepack, which may change it.
+func packWithScripts(dir string, ignoreScripts bool) (*Tarball, error) {
+	pkg, err := LoadPackageFromDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ignoreScripts {
+		for _, script := range []string{"prepack", "prepare"} {
+			err = pkg.RunScript(script)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pkg, err = LoadPackageFromDir(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tarball, err := PackPackage(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ignoreScripts {
+		err = pkg.RunScript("postpack")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tarball, nil
+}
+
+// logTarball prints contents and checksums of a tarball, like npm pack does
+func logTarball(ctx *Context, tarball *Tarball) {
+	ctx.Info("package: %s@%s", tarball.Name, tarball.Version)
+	for _, file := range tarball.Files {
+		ctx.Info("  %s", file)
+	}
+	ctx.Info("filename:      %s", tarball.Filename)
+	ctx.Info("package size:  %d B", len(tarball.Data))
+	ctx.Info("shasum:        %s", tarball.Shasum)
+	ctx.Info("integrity:     %s", tarball.Integrity)
+	ctx.Info("total files:   %d", len(tarball.Files))
+}
+
+// PackCmdRun runs the pack command
+//
+//   frosty pack [-C <dir>] [-pack-destination <dir>] [-dry-run]
+//
+// Writes <name>-<version>.tgz of the package in the working directory
+func PackCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	packCmd := flag.NewFlagSet("pack", flag.ExitOnError)
+	cwdFlag := packCmd.String("C", cwd, "Set working directory")
+	verboseFlag := packCmd.Bool("verbose", false, "Show verbose log output")
+	destFlag := packCmd.String("pack-destination", "", "Directory the tarball is written to")
+	dryRunFlag := packCmd.Bool("dry-run", false, "List packed files without writing the tarball")
+	ignoreScriptsFlag := packCmd.Bool("ignore-scripts", false, "Do not run prepack, prepare and postpack")
+
+	packCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+	ctx.PackagePath = path.Join(ctx.Cwd, "package.json")
+
+	tarball, err := packWithScripts(ctx.Cwd, *ignoreScriptsFlag)
+	if err != nil {
+		return err
+	}
+
+	logTarball(ctx, tarball)
+	if *dryRunFlag {
+		return nil
+	}
+
+	dest := ctx.Cwd
+	if *destFlag != "" {
+		dest = ResolvePath(*destFlag, cwd)
+	}
+
+	err = os.MkdirAll(dest, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(dest, tarball.Filename), tarball.Data, 0644)
+}
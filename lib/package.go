@@ -7,25 +7,45 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"sort"
 	"strings"
 )
 
 // Package represents a single package.json file
 type Package struct {
-	RawBin             interface{} `json:"bin"`
-	RawDependencies    interface{} `json:"dependencies"`
-	RawDevDependencies interface{} `json:"devDependencies"`
-	Name               string      `json:"name"`
-	Resolved           string      `json:"_resolved"`
-	Scripts            Scripts     `json:"scripts"`
-	Version            string      `json:"version"`
-	Main               string      `json:"main"`
-
-	Bin             map[string]string `json:"-"`
-	DevDependencies map[string]string `json:"-"`
-	Dependencies    map[string]string `json:"-"`
-	Filepath        string            `json:"-"`
-	Dir             string            `json:"-"`
+	RawBin                  interface{} `json:"bin"`
+	RawDependencies         interface{} `json:"dependencies"`
+	RawDevDependencies      interface{} `json:"devDependencies"`
+	RawOptionalDependencies interface{} `json:"optionalDependencies,omitempty"`
+	RawPeerDependencies     interface{} `json:"peerDependencies,omitempty"`
+	RawWorkspaces           interface{} `json:"workspaces,omitempty"`
+	RawBundled              interface{} `json:"bundledDependencies,omitempty"`
+	RawBundle               interface{} `json:"bundleDependencies,omitempty"`
+	Files                   []string    `json:"files,omitempty"`
+	Name                    string      `json:"name"`
+	Resolved                string      `json:"_resolved"`
+	Integrity               string      `json:"_integrity,omitempty"`
+	Shasum                  string      `json:"_shasum,omitempty"`
+	Registry                string      `json:"_registry,omitempty"`
+	Deprecated              string      `json:"_deprecated,omitempty"`
+	Scripts                 Scripts     `json:"scripts"`
+	Version                 string      `json:"version"`
+	Main                    string      `json:"main"`
+
+	Bin                  map[string]string `json:"-"`
+	DevDependencies      map[string]string `json:"-"`
+	Dependencies         map[string]string `json:"-"`
+	OptionalDependencies map[string]string `json:"-"`
+	PeerDependencies     map[string]string `json:"-"`
+	ScriptMap            map[string]string `json:"-"`
+	Workspaces           []string          `json:"-"`
+	Bundled              []string          `json:"-"`
+	Filepath             string            `json:"-"`
+	Dir                  string            `json:"-"`
+
+	// Tarball is the file a downloaded package was extracted from, until the
+	// package is added to the cache
+	Tarball string `json:"-"`
 }
 
 // Scripts represents a scripts property from a package.json file
@@ -101,30 +121,69 @@ func (p *Package) Load(filePath string) error {
 
 	// This is needed because some people think it is entertaining to specify
 	// dependencies in their package.json as an array instead of as a map
-	p.Dependencies = make(map[string]string)
-	deps, ok := p.RawDependencies.(map[string]interface{})
+	p.Dependencies = ToStringMap(p.RawDependencies)
+
+	// This is needed because some people think it is entertaining to specify
+	// devDependencies in their package.json as an array instead of as a map
+	p.DevDependencies = ToStringMap(p.RawDevDependencies)
+	p.OptionalDependencies = ToStringMap(p.RawOptionalDependencies)
+	p.PeerDependencies = ToStringMap(p.RawPeerDependencies)
+
+	// workspaces can be either a list of globs, or an object with a packages
+	// property containing the list of globs (yarn style)
+	p.Workspaces = make([]string, 0)
+	workspaces, ok := p.RawWorkspaces.([]interface{})
+	if !ok {
+		wsMap, isMap := p.RawWorkspaces.(map[string]interface{})
+		if isMap {
+			workspaces, ok = wsMap["packages"].([]interface{})
+		}
+	}
 	if ok {
-		for k, v := range deps {
+		for _, v := range workspaces {
 			sv, ok := v.(string)
 			if ok {
-				p.Dependencies[k] = sv
+				p.Workspaces = append(p.Workspaces, sv)
 			}
 		}
 	}
 
-	// This is needed because some people think it is entertaining to specify
-	// devDependencies in their package.json as an array instead of as a map
-	p.DevDependencies = make(map[string]string)
-	devDeps, ok := p.RawDevDependencies.(map[string]interface{})
-	if ok {
-		for k, v := range devDeps {
+	// bundledDependencies (or bundleDependencies) is a list of names, or true
+	// to bundle every dependency
+	p.Bundled = make([]string, 0)
+	rawBundled := p.RawBundled
+	if rawBundled == nil {
+		rawBundled = p.RawBundle
+	}
+	if all, ok := rawBundled.(bool); ok && all {
+		for name := range p.Dependencies {
+			p.Bundled = append(p.Bundled, name)
+		}
+		sort.Strings(p.Bundled)
+	}
+	if bundled, ok := rawBundled.([]interface{}); ok {
+		for _, v := range bundled {
 			sv, ok := v.(string)
 			if ok {
-				p.DevDependencies[k] = sv
+				p.Bundled = append(p.Bundled, sv)
 			}
 		}
 	}
 
+	// Scripts only holds lifecycle scripts which frosty runs during install,
+	// ScriptMap holds every script so they can be started with frosty run
+	raw := struct {
+		Scripts map[string]interface{} `json:"scripts"`
+	}{}
+	json.Unmarshal(jsonstr, &raw)
+	p.ScriptMap = make(map[string]string)
+	for k, v := range raw.Scripts {
+		sv, ok := v.(string)
+		if ok {
+			p.ScriptMap[k] = sv
+		}
+	}
+
 	p.Filepath = filePath
 	p.Dir = path.Dir(filePath)
 	return nil
@@ -156,6 +215,8 @@ func (p *Package) RunScript(script string) error {
 		src = p.Scripts.Install
 	case "postinstall":
 		src = p.Scripts.PostInstall
+	case "prepack", "prepare", "postpack", "prepublishOnly", "publish", "postpublish":
+		src = p.ScriptMap[script]
 	default:
 		return fmt.Errorf("Do not know how to npm run-script %s", script)
 	}
@@ -164,10 +225,7 @@ func (p *Package) RunScript(script string) error {
 		ctx.Info("Running %s script from %s: `%s`", script, p.Filepath, src)
 		ctx.Debug(src)
 
-		parts := strings.Split(src, " ")
-		cmd := exec.Command(parts[0], parts[1:]...)
-		cmd.Dir = p.Dir
-		out, err := cmd.CombinedOutput()
+		out, err := p.ScriptCommand(src).CombinedOutput()
 
 		if err != nil {
 			ctx.Info("ERROR running `%s`", src)
@@ -179,6 +237,30 @@ func (p *Package) RunScript(script string) error {
 	return nil
 }
 
+// ScriptCommand returns command which runs a script from package.json. Scripts are
+// run by the shell from the package directory, with node_modules/.bin in PATH.
+func (p *Package) ScriptCommand(src string) *exec.Cmd {
+	binDir := path.Join(p.Dir, "node_modules", ".bin")
+	cmd := exec.Command("sh", "-c", src)
+	cmd.Dir = p.Dir
+	cmd.Env = append(os.Environ(), "PATH="+binDir+":"+os.Getenv("PATH"))
+	return cmd
+}
+
+// BinLinkPaths returns the paths passed to LinkBin for a package installed in
+// node_modules/<installName>. The install name is the alias name for aliased
+// packages, and may be scoped.
+//
+//   "foo" => "../.bin", "../foo"
+//   "@scope/foo" => "../../.bin", "../@scope/foo"
+func BinLinkPaths(installName string) (string, string) {
+	relBin := path.Join("..", ".bin")
+	if strings.HasPrefix(installName, "@") {
+		relBin = path.Join("..", relBin)
+	}
+	return relBin, path.Join("..", installName)
+}
+
 // LinkBin creates symlink for {bin: '..'} entries
 func (p *Package) LinkBin(relBin string, relModule string) error {
 	if len(p.Bin) == 0 {
@@ -201,7 +283,9 @@ func (p *Package) LinkBin(relBin string, relModule string) error {
 		symlinkFile := path.Join(target, binName)
 		targetFile := path.Join(relModule, relPath)
 
-		if IsFile(symlinkFile) {
+		// Lstat, so that dangling links left by another version of this
+		// package (ex: installed under an alias) are replaced as well
+		if _, err := os.Lstat(symlinkFile); err == nil {
 			err := os.RemoveAll(symlinkFile)
 			if err != nil {
 				return err
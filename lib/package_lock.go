@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// PackageLock represents a package-lock.json or npm-shrinkwrap.json file. From
+// lockfileVersion 2 (npm 7), packages are listed in a flat map keyed by their
+// location (see LockGraph). Version 2 also keeps the nested dependencies of
+// version 1 for older npm clients, version 3 only has the packages map.
+type PackageLock struct {
+	Name            string                       `json:"name"`
+	Version         string                       `json:"version,omitempty"`
+	LockfileVersion int                          `json:"lockfileVersion"`
+	Requires        bool                         `json:"requires,omitempty"`
+	Packages        map[string]*PackageLockEntry `json:"packages,omitempty"`
+	Dependencies    map[string]*Dependency       `json:"dependencies,omitempty"`
+}
+
+// PackageLockEntry is a package in the packages map of a lockfile
+type PackageLockEntry struct {
+	Name                 string            `json:"name,omitempty"`
+	Version              string            `json:"version,omitempty"`
+	Resolved             string            `json:"resolved,omitempty"`
+	Integrity            string            `json:"integrity,omitempty"`
+	Link                 bool              `json:"link,omitempty"`
+	Dev                  bool              `json:"dev,omitempty"`
+	Optional             bool              `json:"optional,omitempty"`
+	Peer                 bool              `json:"peer,omitempty"`
+	Dependencies         map[string]string `json:"dependencies,omitempty"`
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"`
+	PeerDependencies     map[string]string `json:"peerDependencies,omitempty"`
+	DevDependencies      map[string]string `json:"devDependencies,omitempty"`
+}
+
+// FindLockfile returns the lockfile of the package in dir, or "" when it has
+// none. npm-shrinkwrap.json takes precedence over package-lock.json, which
+// takes precedence over yarn.lock.
+func FindLockfile(dir string) string {
+	for _, name := range []string{"npm-shrinkwrap.json", "package-lock.json", "yarn.lock"} {
+		file := path.Join(dir, name)
+		if IsFile(file) {
+			return file
+		}
+	}
+	return ""
+}
+
+// LoadLockfile reads a lockfile of any version, and returns the resolved graph
+// it describes along with its lockfileVersion
+func LoadLockfile(file string) (*LockGraph, int, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lock := &PackageLock{}
+	err = json.Unmarshal(bytes, lock)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid lockfile %s :: %s", file, err.Error())
+	}
+
+	// lockfiles written before npm 5 have no lockfileVersion
+	version := lock.LockfileVersion
+	if version == 0 {
+		version = 1
+	}
+
+	if version >= 2 && lock.Packages != nil {
+		return lock.Graph(), version, nil
+	}
+
+	shrinkwrap := &Shrinkwrap{Name: lock.Name, Version: lock.Version, Dependencies: lock.Dependencies}
+	return shrinkwrap.Graph(), version, nil
+}
+
+// LoadLockGraph reads a lockfile of any format, including yarn.lock, and
+// returns the resolved graph it describes along with its lockfileVersion,
+// which is 0 for yarn.lock. Requirements of the root package and workspaces
+// are taken from the package.json next to the lockfile when the lockfile does
+// not record them.
+func LoadLockGraph(file string) (*LockGraph, int, error) {
+	var pkg *Package
+	var workspaces map[string]*Workspace
+
+	packagePath := path.Join(path.Dir(file), "package.json")
+	if IsFile(packagePath) {
+		var err error
+		pkg, err = LoadPackage(packagePath)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		workspaces, err = LoadWorkspaces(pkg)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if path.Base(file) == "yarn.lock" {
+		if pkg == nil {
+			return nil, 0, fmt.Errorf("%s has no package.json next to it", file)
+		}
+
+		lock, err := LoadYarnLock(file)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if missing := lock.Missing(pkg, workspaces); len(missing) > 0 {
+			return nil, 0, fmt.Errorf("%s is out of date with package.json (missing %s)",
+				file, strings.Join(missing, ", "))
+		}
+
+		graph, err := lock.Graph(pkg, workspaces)
+		if err != nil {
+			return nil, 0, err
+		}
+		return graph, 0, graph.CheckPaths(path.Dir(file), workspaces)
+	}
+
+	graph, version, err := LoadLockfile(file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = graph.CheckPaths(path.Dir(file), workspaces)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	root := graph.Root()
+	if pkg != nil && root.Dependencies == nil && root.DevDependencies == nil && root.OptionalDependencies == nil {
+		root.Dependencies = pkg.Dependencies
+		root.DevDependencies = pkg.DevDependencies
+		root.OptionalDependencies = pkg.OptionalDependencies
+	}
+
+	return graph, version, nil
+}
+
+// NewPackageLock converts a resolved graph to a lockfile of version 2 or 3
+func NewPackageLock(g *LockGraph, version int) *PackageLock {
+	root := g.Root()
+	lock := &PackageLock{
+		Name:            root.Name,
+		Version:         root.Version,
+		LockfileVersion: version,
+		Requires:        true,
+		Packages:        make(map[string]*PackageLockEntry),
+	}
+
+	for p, node := range g.Packages {
+		entry := &PackageLockEntry{
+			Version:              node.Version,
+			Resolved:             node.Resolved,
+			Integrity:            node.Integrity,
+			Link:                 node.Link,
+			Dev:                  node.Dev,
+			Optional:             node.Optional,
+			Peer:                 node.Peer,
+			Dependencies:         node.Dependencies,
+			OptionalDependencies: node.OptionalDependencies,
+			PeerDependencies:     node.PeerDependencies,
+			DevDependencies:      node.DevDependencies,
+		}
+
+		// names are implied by the location, except for aliases, the root
+		// package and workspaces
+		if !IsInstallPath(p) || node.Name != LockPathName(p) {
+			entry.Name = node.Name
+		}
+
+		// links only point to the linked package, which has its own entry
+		if node.Link {
+			entry = &PackageLockEntry{Resolved: node.Resolved, Link: true}
+		}
+
+		lock.Packages[p] = entry
+	}
+
+	if version == 2 {
+		lock.Dependencies = NewShrinkwrap(g).Dependencies
+	}
+
+	return lock
+}
+
+// Graph converts the packages map to a resolved graph
+func (l *PackageLock) Graph() *LockGraph {
+	g := NewLockGraph()
+	for p, entry := range l.Packages {
+		node := &LockNode{
+			Name:                 entry.Name,
+			Version:              entry.Version,
+			Resolved:             entry.Resolved,
+			Integrity:            entry.Integrity,
+			Link:                 entry.Link,
+			Dev:                  entry.Dev,
+			Optional:             entry.Optional,
+			Peer:                 entry.Peer,
+			Dependencies:         entry.Dependencies,
+			OptionalDependencies: entry.OptionalDependencies,
+			PeerDependencies:     entry.PeerDependencies,
+			DevDependencies:      entry.DevDependencies,
+		}
+		if node.Name == "" && IsInstallPath(p) {
+			node.Name = LockPathName(p)
+		}
+		g.Packages[p] = node
+	}
+
+	root := g.Root()
+	if root.Name == "" {
+		root.Name = l.Name
+	}
+	if root.Version == "" {
+		root.Version = l.Version
+	}
+	return g
+}
+
+// WriteLockfile saves a resolved graph to file, in the format of lockfileVersion
+func WriteLockfile(file string, g *LockGraph, version int) error {
+	switch version {
+	case 1:
+		return NewShrinkwrap(g).Write(file)
+	case 2, 3:
+		return writeLockfileJSON(file, NewPackageLock(g, version))
+	}
+	return fmt.Errorf("Unsupported lockfileVersion %d, expected 1, 2 or 3", version)
+}
+
+// LockfileVersionOf returns the lockfileVersion of an existing lockfile, or
+// fallback when there is no readable lockfile at file
+func LockfileVersionOf(file string, fallback int) int {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fallback
+	}
+
+	lock := struct {
+		LockfileVersion int `json:"lockfileVersion"`
+	}{}
+	if json.Unmarshal(bytes, &lock) != nil {
+		return fallback
+	}
+	if lock.LockfileVersion == 0 {
+		return 1
+	}
+	return lock.LockfileVersion
+}
@@ -0,0 +1,321 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// packIgnoreDefaults are never packed, whatever files, .npmignore or
+// .gitignore say
+var packIgnoreDefaults = []string{
+	".npmignore",
+	".gitignore",
+	".git",
+	".svn",
+	".hg",
+	"CVS",
+	".DS_Store",
+	"._*",
+	".*.swp",
+	"*.orig",
+	".npmrc",
+	"npm-debug.log",
+	"/.lock-wscript",
+	"/.wafpickle-*",
+	"/build/config.gypi",
+	"/package-lock.json",
+	"/yarn.lock",
+	"/pnpm-lock.yaml",
+	"/archived-packages",
+}
+
+// packAlwaysInclude matches files at the top level of a package which are
+// packed even when files, .npmignore or .gitignore exclude them
+var packAlwaysInclude = regexp.MustCompile(`(?i)^(package\.json|readme(\..*)?|licen[cs]e(\..*)?)$`)
+
+// ignorePattern is a single line of a .gitignore style file. Patterns are
+// matched against paths relative to base.
+type ignorePattern struct {
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// parseIgnorePatterns parses .gitignore style contents. Blank lines and
+// comments are skipped.
+//
+//   dist/       -- directories named dist, at any depth
+//   /index.js   -- index.js next to the ignore file only
+//   *.log       -- files ending with .log, at any depth
+//   !keep.log   -- re-include keep.log
+//   docs/**/*.md
+func parseIgnorePatterns(base string, contents string) []*ignorePattern {
+	patterns := []*ignorePattern{}
+
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := &ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// patterns without a slash match at any depth
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		expr := globToRegexp(line)
+		if !anchored {
+			expr = "(?:.*/)?" + expr
+		}
+
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			continue
+		}
+		pattern.re = re
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns
+}
+
+// globToRegexp converts glob to regular expression. * and ? do not match
+// slashes, ** matches any number of directories.
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return expr.String()
+}
+
+// match returns true if pattern matches rel, a slash separated path relative
+// to the package root
+func (p *ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, p.base+"/")
+	}
+
+	return p.re.MatchString(rel)
+}
+
+// isIgnored applies patterns in order. The last matching pattern decides.
+func isIgnored(patterns []*ignorePattern, rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// PackFiles returns files which are packed when pkg is published, relative to
+// pkg.Dir and sorted. The selection follows npm:
+//
+//   - when package.json has files, only the files and directories it lists
+//   - otherwise everything, except what .npmignore (or .gitignore, when there
+//     is no .npmignore) excludes. Ignore files apply to their own directory.
+//   - package.json, README, LICENSE and the main file are always included
+//   - node_modules is only included for bundledDependencies
+//   - VCS directories, lockfiles, .npmrc and editor leftovers are never included
+func PackFiles(pkg *Package) ([]string, error) {
+	var files []*ignorePattern
+	if len(pkg.Files) > 0 {
+		files = make([]*ignorePattern, 0)
+		for _, entry := range pkg.Files {
+			// entries are relative to the package root, and include directory contents
+			negate := strings.HasPrefix(entry, "!")
+			entry = "/" + strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(entry, "!"), "./"), "/")
+			if negate {
+				entry = "!" + entry
+			}
+			files = append(files, parseIgnorePatterns("", entry)...)
+		}
+	}
+
+	defaults := parseIgnorePatterns("", strings.Join(packIgnoreDefaults, "\n"))
+
+	list := []string{}
+	err := walkPackDir(pkg.Dir, "", files, []*ignorePattern{}, defaults, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range pkg.Bundled {
+		dir := path.Join("node_modules", name)
+		if !IsDir(path.Join(pkg.Dir, dir)) {
+			return nil, fmt.Errorf("Bundled dependency %s is not installed in %s", name, pkg.Dir)
+		}
+
+		// bundled dependencies are packed whole, as installed
+		err := walkPackDir(pkg.Dir, dir, nil, []*ignorePattern{}, defaults, &list)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if pkg.Main != "" {
+		main := path.Clean(strings.TrimPrefix(pkg.Main, "./"))
+		if IsFile(path.Join(pkg.Dir, main)) && !StringSliceContains(list, main) {
+			list = append(list, main)
+		}
+	}
+
+	sort.Strings(list)
+	return list, nil
+}
+
+// walkPackDir adds files under rel which are packed to list. files is nil when
+// every file is packed unless ignored.
+func walkPackDir(root string, rel string, files []*ignorePattern,
+	ignores []*ignorePattern, defaults []*ignorePattern, list *[]string) error {
+	dir := path.Join(root, rel)
+
+	// .npmignore wins over .gitignore. When package.json has files, ignore
+	// files at the top level do not apply.
+	if rel != "" || files == nil {
+		for _, name := range []string{".npmignore", ".gitignore"} {
+			contents, err := ioutil.ReadFile(path.Join(dir, name))
+			if err == nil {
+				ignores = append(ignores, parseIgnorePatterns(rel, string(contents))...)
+				break
+			}
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+
+		info, err := os.Lstat(path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		// symlinked files are packed with their contents. Symlinked directories
+		// are skipped, they may point anywhere, including back up the tree.
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(path.Join(dir, entry.Name()))
+			if err != nil || info.IsDir() {
+				continue
+			}
+		}
+
+		if isIgnored(defaults, entryRel, info.IsDir()) {
+			continue
+		}
+
+		if info.IsDir() {
+			// node_modules is only packed within bundled dependencies, which are
+			// walked from node_modules/<name>
+			if entry.Name() == "node_modules" && !strings.HasPrefix(rel, "node_modules/") {
+				continue
+			}
+			if isIgnored(ignores, entryRel, true) {
+				continue
+			}
+			err := walkPackDir(root, entryRel, files, ignores, defaults, list)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if rel == "" && packAlwaysInclude.MatchString(entry.Name()) {
+			*list = append(*list, entryRel)
+			continue
+		}
+
+		if files != nil && !isListedInFiles(files, entryRel) {
+			continue
+		}
+
+		if isIgnored(ignores, entryRel, false) {
+			continue
+		}
+
+		*list = append(*list, entryRel)
+	}
+
+	return nil
+}
+
+// isListedInFiles returns true if rel, or one of its parent directories, is
+// matched by the files field of package.json. Like ignore files, the last
+// matching entry decides, so "!lib/test.js" excludes a file of a listed "lib".
+func isListedInFiles(files []*ignorePattern, rel string) bool {
+	listed := false
+	for _, pattern := range files {
+		isDir := false
+		for p := rel; p != "."; p = path.Dir(p) {
+			if pattern.match(p, isDir) {
+				listed = !pattern.negate
+				break
+			}
+			isDir = true
+		}
+	}
+	return listed
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"fmt"
+)
+
+// Packument is the registry document describing every published version of a
+// package. Registry is the registry which served it. Raw is the document as
+// served, and is only kept for full packuments (see GetFullPackument).
+type Packument struct {
+	Name     string                       `json:"name"`
+	DistTags map[string]string            `json:"dist-tags"`
+	Versions map[string]*PackumentVersion `json:"versions"`
+	Registry string                       `json:"-"`
+	Raw      []byte                       `json:"-"`
+}
+
+// PackumentVersion is the manifest of a single published version
+type PackumentVersion struct {
+	Name                    string      `json:"name"`
+	Version                 string      `json:"version"`
+	Dist                    *Dist       `json:"dist"`
+	RawDeprecated           interface{} `json:"deprecated"`
+	RawEngines              interface{} `json:"engines"`
+	OS                      []string    `json:"os"`
+	CPU                     []string    `json:"cpu"`
+	RawBin                  interface{} `json:"bin"`
+	RawDependencies         interface{} `json:"dependencies"`
+	RawOptionalDependencies interface{} `json:"optionalDependencies"`
+	RawPeerDependencies     interface{} `json:"peerDependencies"`
+
+	Deprecated           string            `json:"-"`
+	Engines              map[string]string `json:"-"`
+	Bin                  map[string]string `json:"-"`
+	Dependencies         map[string]string `json:"-"`
+	OptionalDependencies map[string]string `json:"-"`
+	PeerDependencies     map[string]string `json:"-"`
+	Registry             string            `json:"-"`
+}
+
+// Dist describes the published tarball of a version. Registry and Deprecated
+// are set for tarballs resolved through a registry.
+type Dist struct {
+	Tarball    string `json:"tarball"`
+	Shasum     string `json:"shasum"`
+	Integrity  string `json:"integrity"`
+	Registry   string `json:"-"`
+	Deprecated string `json:"-"`
+	File       string `json:"-"`
+}
+
+// Normalize fills in the typed fields of every version from their raw values.
+// Must be called after a packument is decoded.
+func (p *Packument) Normalize() {
+	if p.DistTags == nil {
+		p.DistTags = make(map[string]string)
+	}
+
+	if p.Versions == nil {
+		p.Versions = make(map[string]*PackumentVersion)
+	}
+
+	for version, v := range p.Versions {
+		if v == nil {
+			v = &PackumentVersion{}
+			p.Versions[version] = v
+		}
+		if v.Version == "" {
+			v.Version = version
+		}
+		if v.Name == "" {
+			v.Name = p.Name
+		}
+		if v.Dist == nil {
+			v.Dist = &Dist{}
+		}
+		v.Registry = p.Registry
+		v.normalize()
+	}
+}
+
+func (v *PackumentVersion) normalize() {
+	// deprecated is usually a message, but some registries publish true/false
+	switch d := v.RawDeprecated.(type) {
+	case string:
+		v.Deprecated = d
+	case bool:
+		if d {
+			v.Deprecated = "This version has been deprecated"
+		}
+	}
+
+	v.Engines = ToStringMap(v.RawEngines)
+	v.Dependencies = ToStringMap(v.RawDependencies)
+	v.OptionalDependencies = ToStringMap(v.RawOptionalDependencies)
+	v.PeerDependencies = ToStringMap(v.RawPeerDependencies)
+
+	v.Bin = make(map[string]string)
+	if bin, ok := v.RawBin.(string); ok {
+		v.Bin[v.Name] = bin
+	} else {
+		v.Bin = ToStringMap(v.RawBin)
+	}
+}
+
+// VersionList returns the versions keys of the packument
+func (p *Packument) VersionList() []string {
+	versions := make([]string, 0, len(p.Versions))
+	for version := range p.Versions {
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// Get returns manifest of a published version
+func (p *Packument) Get(version string) (*PackumentVersion, error) {
+	v, ok := p.Versions[version]
+	if !ok {
+		return nil, fmt.Errorf("%s@%s has not been published", p.Name, version)
+	}
+	return v, nil
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"time"
+)
+
+// PackumentCache stores packuments fetched from registries on disk, along with
+// the validators (ETag, Last-Modified) needed to revalidate them
+type PackumentCache struct {
+	RootDir string
+	MaxAge  time.Duration
+}
+
+// PackumentCacheEntry is a single cached packument
+type PackumentCacheEntry struct {
+	ETag         string          `json:"etag"`
+	LastModified string          `json:"lastModified"`
+	FetchedAt    time.Time       `json:"fetchedAt"`
+	Packument    json.RawMessage `json:"packument"`
+}
+
+var unsafePathRe = regexp.MustCompile("[^A-Za-z0-9._-]+")
+
+// NewPackumentCache creates a packument cache rooted at dir. Entries younger
+// than maxAge are used without contacting the registry.
+func NewPackumentCache(dir string, maxAge time.Duration) *PackumentCache {
+	return &PackumentCache{
+		RootDir: dir,
+		MaxAge:  maxAge,
+	}
+}
+
+// Get returns cached packument, or nil if there is none
+func (c *PackumentCache) Get(registry string, name string, full bool) *PackumentCacheEntry {
+	bytes, err := ioutil.ReadFile(c.entryPath(registry, name, full))
+	if err != nil {
+		return nil
+	}
+
+	entry := &PackumentCacheEntry{}
+	err = json.Unmarshal(bytes, entry)
+	if err != nil || len(entry.Packument) == 0 {
+		return nil
+	}
+
+	return entry
+}
+
+// Put saves packument to the cache
+func (c *PackumentCache) Put(registry string, name string, full bool, entry *PackumentCacheEntry) error {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	filePath := c.entryPath(registry, name, full)
+	err = os.MkdirAll(path.Dir(filePath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filePath, bytes, os.ModePerm)
+}
+
+// Fresh returns true if entry can be used without revalidating it
+func (c *PackumentCache) Fresh(entry *PackumentCacheEntry) bool {
+	return time.Since(entry.FetchedAt) < c.MaxAge
+}
+
+// entryPath returns location of a cached packument. Each registry has its own
+// directory, and abbreviated (corgi) and full documents are stored separately.
+//
+//   ("https://registry.npmjs.org", "@foo/bar", false) => <root>/https_registry.npmjs.org/@foo/bar.json
+func (c *PackumentCache) entryPath(registry string, name string, full bool) string {
+	// cleaning against / keeps names like ../foo inside the cache directory
+	file := path.Clean("/"+name) + ".json"
+	if full {
+		file = path.Clean("/"+name) + ".full.json"
+	}
+	return path.Join(c.RootDir, unsafePathRe.ReplaceAllString(registry, "_"), file)
+}
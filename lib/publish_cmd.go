@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// PublishDocument is the body of the request which publishes a version. It
+// holds the manifest of the new version, and the tarball as an attachment.
+type PublishDocument struct {
+	ID          string                        `json:"_id"`
+	Name        string                        `json:"name"`
+	Description string                        `json:"description,omitempty"`
+	DistTags    map[string]string             `json:"dist-tags"`
+	Versions    map[string]interface{}        `json:"versions"`
+	Access      string                        `json:"access,omitempty"`
+	Attachments map[string]*PublishAttachment `json:"_attachments"`
+}
+
+// PublishAttachment is a base64 encoded tarball
+type PublishAttachment struct {
+	ContentType string `json:"content_type"`
+	Data        string `json:"data"`
+	Length      int    `json:"length"`
+}
+
+// NewPublishDocument builds the publish document of a packed package. Fields
+// of package.json starting with _ are dropped, and dist describes the tarball
+// as it will be hosted by registry.
+func NewPublishDocument(pkg *Package, tarball *Tarball, registry string, tag string, access string) (*PublishDocument, error) {
+	contents, err := ioutil.ReadFile(pkg.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]interface{})
+	err = json.Unmarshal(contents, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range manifest {
+		if strings.HasPrefix(key, "_") {
+			delete(manifest, key)
+		}
+	}
+
+	manifest["_id"] = fmt.Sprintf("%s@%s", tarball.Name, tarball.Version)
+	manifest["dist"] = &Dist{
+		Tarball:   genTarURL(registry, tarball.Name, tarball.Version),
+		Shasum:    tarball.Shasum,
+		Integrity: tarball.Integrity,
+	}
+
+	description, _ := manifest["description"].(string)
+
+	return &PublishDocument{
+		ID:          tarball.Name,
+		Name:        tarball.Name,
+		Description: description,
+		DistTags:    map[string]string{tag: tarball.Version},
+		Versions:    map[string]interface{}{tarball.Version: manifest},
+		Access:      access,
+		Attachments: map[string]*PublishAttachment{
+			fmt.Sprintf("%s-%s.tgz", tarball.Name, tarball.Version): &PublishAttachment{
+				ContentType: "application/octet-stream",
+				Data:        base64.StdEncoding.EncodeToString(tarball.Data),
+				Length:      len(tarball.Data),
+			},
+		},
+	}, nil
+}
+
+// Publish sends a publish document to the registry which hosts the package,
+// chosen by scope. Versions which were already published are refused.
+func (n *NpmRegistryClient) Publish(doc *PublishDocument) error {
+	registry := n.RegistryFor(doc.Name)
+	url := packumentURL(registry, doc.Name)
+
+	if n.Credentials.Lookup(url) == nil {
+		return fmt.Errorf("Cannot publish %s, no credentials are configured for %s", doc.Name, registry)
+	}
+
+	// only the registry published to matters here, so fallbacks are not used
+	packument, err := n.fetchPackumentFrom(registry, doc.Name, true)
+	if err != nil && !IsHTTPStatus(err, http.StatusNotFound) {
+		return err
+	}
+	if err == nil {
+		for version := range doc.Versions {
+			if _, ok := packument.Versions[version]; ok {
+				return fmt.Errorf("Cannot publish over previously published version %s@%s", doc.Name, version)
+			}
+		}
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	res, attempts, err := n.do("PUT", url, header, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		reason := fmt.Errorf("HTTP %d response", res.StatusCode)
+
+		message := struct {
+			Error  string `json:"error"`
+			Reason string `json:"reason"`
+		}{}
+		contents, _ := ioutil.ReadAll(res.Body)
+		if json.Unmarshal(contents, &message) == nil && (message.Error != "" || message.Reason != "") {
+			reason = fmt.Errorf("HTTP %d response: %s", res.StatusCode,
+				strings.TrimSpace(message.Error+" "+message.Reason))
+		}
+
+		if res.StatusCode == http.StatusConflict {
+			reason = fmt.Errorf("%s (the version already exists)", reason.Error())
+		}
+
+		return &HTTPError{Method: "PUT", URL: url, StatusCode: res.StatusCode, Attempts: attempts, Err: reason}
+	}
+
+	return nil
+}
+
+// PublishCmdRun runs the publish command
+//
+//   frosty publish [-C <dir>] [-tag <tag>] [-access public|restricted] [-dry-run]
+//
+// Packs the package in the working directory (see PackCmdRun), and publishes it
+func PublishCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	publishCmd := flag.NewFlagSet("publish", flag.ExitOnError)
+	cwdFlag := publishCmd.String("C", cwd, "Set working directory")
+	verboseFlag := publishCmd.Bool("verbose", false, "Show verbose log output")
+	tagFlag := publishCmd.String("tag", "latest", "Dist-tag which points to the published version")
+	accessFlag := publishCmd.String("access", "", "Access of a scoped package: public or restricted")
+	dryRunFlag := publishCmd.Bool("dry-run", false, "Pack and report what would be published, without publishing")
+	registryFlag := publishCmd.String("registry", "", "Registry URL, overrides npmrc and env vars")
+	ignoreScriptsFlag := publishCmd.Bool("ignore-scripts", false, "Do not run lifecycle scripts")
+
+	publishCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+	ctx.PackagePath = path.Join(ctx.Cwd, "package.json")
+
+	if *accessFlag != "" && *accessFlag != "public" && *accessFlag != "restricted" {
+		return fmt.Errorf("Invalid access %s, use public or restricted", *accessFlag)
+	}
+
+	// a tag which parses as a version or range could not be installed by name
+	if spec, err := ParseSpec("", *tagFlag); err != nil || spec.Type != TagSpec {
+		return fmt.Errorf("Invalid tag %s, tags must not look like versions or ranges", *tagFlag)
+	}
+
+	npmFlags := make(map[string]string)
+	if *registryFlag != "" {
+		npmFlags["registry"] = *registryFlag
+	}
+	err = ConfigureNpm(ctx, npmFlags, nil)
+	if err != nil {
+		return err
+	}
+
+	pkg, err := LoadPackage(ctx.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	if *accessFlag == "restricted" && !strings.HasPrefix(pkg.Name, "@") {
+		return fmt.Errorf("Cannot publish %s as restricted, only scoped packages can be restricted", pkg.Name)
+	}
+
+	if !*ignoreScriptsFlag {
+		err = pkg.RunScript("prepublishOnly")
+		if err != nil {
+			return err
+		}
+	}
+
+	tarball, err := packWithScripts(ctx.Cwd, *ignoreScriptsFlag)
+	if err != nil {
+		return err
+	}
+
+	// prepack may have changed package.json
+	pkg, err = LoadPackage(ctx.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	registry := ctx.NpmRegistry.RegistryFor(tarball.Name)
+	doc, err := NewPublishDocument(pkg, tarball, registry, *tagFlag, *accessFlag)
+	if err != nil {
+		return err
+	}
+
+	logTarball(ctx, tarball)
+
+	if *dryRunFlag {
+		ctx.Info("Would publish %s@%s to %s with tag %s (dry run)",
+			tarball.Name, tarball.Version, registry, *tagFlag)
+		return nil
+	}
+
+	err = ctx.NpmRegistry.Publish(doc)
+	if err != nil {
+		return err
+	}
+	ctx.Info("+ %s@%s (%s, tag %s)", tarball.Name, tarball.Version, registry, *tagFlag)
+
+	if !*ignoreScriptsFlag {
+		for _, script := range []string{"publish", "postpublish"} {
+			err = pkg.RunScript(script)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9_/:=.,+%@-]+$`)
+
+// RunCmdRun runs a script from package.json
+//
+//   frosty run [-w <workspace>] <script> [args...]
+//
+// When no script is specified, the available scripts are listed
+func RunCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+	cwdFlag := runCmd.String("C", cwd, "Set working directory")
+	verboseFlag := runCmd.Bool("verbose", false, "Show verbose log output")
+	workspaceFlag := runCmd.String("w", "", "Run script of this workspace")
+
+	runCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+	ctx.Workspace = *workspaceFlag
+	ctx.PackagePath = path.Join(ctx.Cwd, "package.json")
+
+	pkg, err := LoadPackage(ctx.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Workspace != "" {
+		ctx.Workspaces, err = LoadWorkspaces(pkg)
+		if err != nil {
+			return err
+		}
+
+		ws, err := FindWorkspace(ctx.Workspaces, pkg.Dir, ctx.Workspace)
+		if err != nil {
+			return err
+		}
+		pkg = ws.Package
+	}
+
+	if runCmd.NArg() == 0 {
+		listScripts(ctx, pkg)
+		return nil
+	}
+
+	script := runCmd.Arg(0)
+	src, ok := pkg.ScriptMap[script]
+	if !ok {
+		return fmt.Errorf("Missing script %s in %s", script, pkg.Filepath)
+	}
+
+	// extra args are passed to the script as they are, never interpreted by the shell
+	for _, arg := range runCmd.Args()[1:] {
+		src = src + " " + ShellQuote(arg)
+	}
+
+	ctx.Info("> %s@%s %s %s", pkg.Name, pkg.Version, script, pkg.Dir)
+	ctx.Info("> %s", src)
+
+	cmd := pkg.ScriptCommand(src)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Script %s failed: %s", script, err)
+	}
+
+	return nil
+}
+
+// ShellQuote quotes s for sh, like npm quotes args passed to scripts
+//
+//   --grep  =>  --grep
+//   a b     =>  'a b'
+//   it's    =>  'it'\''s'
+func ShellQuote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func listScripts(ctx *Context, pkg *Package) {
+	names := make([]string, 0, len(pkg.ScriptMap))
+	for name := range pkg.ScriptMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx.Info("Scripts available in %s:", pkg.Filepath)
+	for _, name := range names {
+		ctx.Info("  %s: %s", name, pkg.ScriptMap[name])
+	}
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// SearchPackage is a package found by search
+type SearchPackage struct {
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Keywords    []string          `json:"keywords,omitempty"`
+	Date        string            `json:"date,omitempty"`
+	Links       map[string]string `json:"links,omitempty"`
+	Publisher   *struct {
+		Username string `json:"username"`
+	} `json:"publisher,omitempty"`
+}
+
+// Search finds packages matching text on the default registry
+func (n *NpmRegistryClient) Search(text string, size int) ([]*SearchPackage, error) {
+	searchURL := n.GetAPIURL(fmt.Sprintf("v1/search?text=%s&size=%d", url.QueryEscape(text), size))
+
+	res, err := n.Get(searchURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	results := struct {
+		Objects []struct {
+			Package *SearchPackage `json:"package"`
+		} `json:"objects"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&results)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid search response from %s :: %s", n.RootURL, err.Error())
+	}
+
+	packages := make([]*SearchPackage, 0, len(results.Objects))
+	for _, object := range results.Objects {
+		if object.Package != nil {
+			packages = append(packages, object.Package)
+		}
+	}
+	return packages, nil
+}
+
+// SearchCmdRun runs the search command
+//
+//   frosty search [-json] [-size 20] <terms...>
+func SearchCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
+	cwdFlag := searchCmd.String("C", cwd, "Set working directory")
+	verboseFlag := searchCmd.Bool("verbose", false, "Show verbose log output")
+	jsonFlag := searchCmd.Bool("json", false, "Print results as JSON")
+	sizeFlag := searchCmd.Int("size", 20, "How many results to show")
+	registryFlag := searchCmd.String("registry", "", "Registry URL, overrides npmrc and env vars")
+
+	searchCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+
+	if searchCmd.NArg() == 0 {
+		return fmt.Errorf("Please specify search terms (ex: frosty search react router)")
+	}
+
+	npmFlags := make(map[string]string)
+	if *registryFlag != "" {
+		npmFlags["registry"] = *registryFlag
+	}
+	err = ConfigureNpm(ctx, npmFlags, nil)
+	if err != nil {
+		return err
+	}
+
+	// results are printed to stdout, so they can be piped
+	ctx.SetLogOutput(os.Stderr)
+
+	packages, err := ctx.NpmRegistry.Search(strings.Join(searchCmd.Args(), " "), *sizeFlag)
+	if err != nil {
+		return err
+	}
+
+	if *jsonFlag {
+		bytes, err := json.MarshalIndent(packages, "", "  ")
+		if err != nil {
+			return err
+		}
+		ctx.Print("%s", string(bytes))
+		return nil
+	}
+
+	if len(packages) == 0 {
+		ctx.Print("No matches found for \"%s\"", strings.Join(searchCmd.Args(), " "))
+		return nil
+	}
+
+	ctx.Print("%s", formatSearchTable(packages))
+	return nil
+}
+
+// formatSearchTable formats packages as a table, one package per line
+func formatSearchTable(packages []*SearchPackage) string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tDATE\tPUBLISHER\tDESCRIPTION")
+
+	for _, pkg := range packages {
+		date := pkg.Date
+		if len(date) > 10 {
+			date = date[:10]
+		}
+
+		publisher := ""
+		if pkg.Publisher != nil {
+			publisher = pkg.Publisher.Username
+		}
+
+		description := []rune(strings.Join(strings.Fields(pkg.Description), " "))
+		if len(description) > 60 {
+			description = append(description[:57], []rune("...")...)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pkg.Name, pkg.Version, date, publisher, string(description))
+	}
+
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+)
+
+// ServeCmdRun runs the serve command, which serves the frosty cache as a
+// read-only npm registry
+//
+//   frosty serve [-port 4873] [-upstream https://registry.npmjs.org]
+//
+// With -upstream, packages missing from the cache are fetched from upstream
+// and added to the cache.
+func ServeCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	cwdFlag := serveCmd.String("C", cwd, "Set working directory")
+	verboseFlag := serveCmd.Bool("verbose", false, "Show verbose log output")
+	frostyHomeFlag := serveCmd.String("frosty-home", GetFrostyHome(),
+		"Location of frosty home directory")
+	hostFlag := serveCmd.String("host", "127.0.0.1", "Address to listen on")
+	portFlag := serveCmd.Int("port", 4873, "Port to listen on")
+	upstreamFlag := serveCmd.String("upstream", "",
+		"Registry to fetch packages missing from the cache from")
+
+	serveCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+	ctx.FrostyHome = ResolvePath(*frostyHomeFlag, cwd)
+
+	cache, err := LoadCache(path.Join(ctx.FrostyHome, "cache"))
+	if err != nil {
+		return err
+	}
+	ctx.Cache = cache
+
+	var upstream *NpmRegistryClient
+	if *upstreamFlag != "" {
+		// npmrc still applies, for upstream credentials, proxies and TLS settings
+		err = ConfigureNpm(ctx, map[string]string{"registry": *upstreamFlag}, nil)
+		if err != nil {
+			return err
+		}
+
+		upstream = ctx.NpmRegistry
+		upstream.PackumentCache = NewPackumentCache(
+			path.Join(ctx.FrostyHome, "packuments"), GetPackumentMaxAge())
+		upstream.Retries = GetFetchRetries()
+	}
+
+	addr := fmt.Sprintf("%s:%d", *hostFlag, *portFlag)
+	ctx.Info("Serving %s at http://%s", cache.RootDir, addr)
+	if upstream != nil {
+		ctx.Info("Fetching cache misses from %s", upstream.RootURL)
+	}
+
+	return http.ListenAndServe(addr, NewCacheRegistry(cache, upstream))
+}
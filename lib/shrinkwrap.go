@@ -2,28 +2,38 @@ package lib
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/sethmcl/gofrosty/vendor/nsemver"
 	"io/ioutil"
 	"path"
+	"strings"
 )
 
 // Dependency represents a dependency specification inside an npm-shrinkwrap.json file
 type Dependency struct {
 	Version        string                 `json:"version"`
-	From           string                 `json:"from"`
-	Resolved       string                 `json:"resolved"`
-	Dependencies   map[string]*Dependency `json:"dependencies"`
-	Name           string
-	ShrinkwrapDir  string
-	ShrinkwrapPath string
+	From           string                 `json:"from,omitempty"`
+	Resolved       string                 `json:"resolved,omitempty"`
+	Integrity      string                 `json:"integrity,omitempty"`
+	Dev            bool                   `json:"dev,omitempty"`
+	Optional       bool                   `json:"optional,omitempty"`
+	Requires       map[string]string      `json:"requires,omitempty"`
+	Dependencies   map[string]*Dependency `json:"dependencies,omitempty"`
+	Name           string                 `json:"-"`
+	ShrinkwrapDir  string                 `json:"-"`
+	ShrinkwrapPath string                 `json:"-"`
 }
 
-// Shrinkwrap represents a single npm-shrinkwrap.json file
+// Shrinkwrap represents a single npm-shrinkwrap.json file, in the nested
+// format of lockfileVersion 1 (npm 5 and 6) and older
 type Shrinkwrap struct {
-	Path         string
-	Dir          string
-	Name         string                 `json:"name"`
-	Version      string                 `json:"version"`
-	Dependencies map[string]*Dependency `json:"dependencies"`
+	Path            string                 `json:"-"`
+	Dir             string                 `json:"-"`
+	Name            string                 `json:"name"`
+	Version         string                 `json:"version"`
+	LockfileVersion int                    `json:"lockfileVersion,omitempty"`
+	Requires        bool                   `json:"requires,omitempty"`
+	Dependencies    map[string]*Dependency `json:"dependencies"`
 }
 
 // LoadShrinkwrapFile returns Shrinkwrap object
@@ -34,19 +44,118 @@ func LoadShrinkwrapFile(filePath string) (*Shrinkwrap, error) {
 		return nil, err
 	}
 
-	shrink := &Shrinkwrap{Path: filePath, Dir: path.Dir(filePath)}
-	root := &Dependency{}
-	err = json.Unmarshal(jsonstr, &root)
+	shrink := &Shrinkwrap{}
+	err = json.Unmarshal(jsonstr, shrink)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Invalid lockfile %s :: %s", filePath, err.Error())
 	}
 
-	shrink.Name = root.Name
-	shrink.Version = root.Version
-	shrink.Dependencies = root.Dependencies
+	shrink.Path = filePath
+	shrink.Dir = path.Dir(filePath)
 	return shrink, nil
 }
 
+// NewShrinkwrap converts a resolved graph to the nested lockfileVersion 1
+// format. Workspaces and their node_modules have no place in this format, so
+// only links to them are recorded.
+func NewShrinkwrap(g *LockGraph) *Shrinkwrap {
+	root := g.Root()
+	return &Shrinkwrap{
+		Name:            root.Name,
+		Version:         root.Version,
+		LockfileVersion: 1,
+		Requires:        true,
+		Dependencies:    shrinkwrapDeps(g, ""),
+	}
+}
+
+func shrinkwrapDeps(g *LockGraph, parent string) map[string]*Dependency {
+	deps := make(map[string]*Dependency)
+	for name, p := range g.Children(parent) {
+		node := g.Packages[p]
+		dep := &Dependency{
+			Version:   node.Version,
+			Resolved:  node.Resolved,
+			Integrity: node.Integrity,
+			Dev:       node.Dev,
+			Optional:  node.Optional,
+		}
+
+		// packages which are not fetched from a registry are versioned by
+		// where they were resolved from
+		switch {
+		case node.Link:
+			dep.Version = "file:" + node.Resolved
+			dep.Resolved = ""
+		case node.Name != "" && node.Name != name:
+			dep.Version = "npm:" + node.Name + "@" + node.Version
+		case node.Resolved != "" && !httpPrefixRe.MatchString(node.Resolved):
+			dep.Version = node.Resolved
+			dep.Resolved = ""
+		}
+
+		requires := make(map[string]string)
+		for _, m := range []map[string]string{node.Dependencies, node.OptionalDependencies} {
+			for k, v := range m {
+				requires[k] = v
+			}
+		}
+		if len(requires) > 0 {
+			dep.Requires = requires
+		}
+
+		if children := shrinkwrapDeps(g, p); len(children) > 0 {
+			dep.Dependencies = children
+		}
+		deps[name] = dep
+	}
+	return deps
+}
+
+// Graph converts the shrinkwrap to a resolved graph
+func (n *Shrinkwrap) Graph() *LockGraph {
+	g := NewLockGraph()
+	g.Packages[""] = &LockNode{Name: n.Name, Version: n.Version}
+	addShrinkwrapDeps(g, "", n.Dependencies)
+	return g
+}
+
+func addShrinkwrapDeps(g *LockGraph, parent string, deps map[string]*Dependency) {
+	for name, dep := range deps {
+		p := LockPath(parent, name)
+		node := &LockNode{
+			Name:         name,
+			Version:      dep.Version,
+			Resolved:     dep.Resolved,
+			Integrity:    dep.Integrity,
+			Dev:          dep.Dev,
+			Optional:     dep.Optional,
+			Dependencies: dep.Requires,
+		}
+
+		if strings.HasPrefix(dep.Version, "npm:") {
+			node.Name, node.Version = SplitNameSpec(strings.TrimPrefix(dep.Version, "npm:"))
+		} else if _, err := nsemver.ParseVersion(dep.Version); err != nil {
+			// git and file dependencies are versioned by where they were resolved from
+			if node.Resolved == "" {
+				node.Resolved = dep.Version
+			}
+			node.Version = ""
+		}
+
+		g.Packages[p] = node
+		addShrinkwrapDeps(g, p, dep.Dependencies)
+	}
+}
+
+// Write saves the shrinkwrap to file
+func (n *Shrinkwrap) Write(file string) error {
+	if n.Dependencies == nil {
+		n.Dependencies = make(map[string]*Dependency)
+	}
+	return writeLockfileJSON(file, n)
+}
+
 func addDeps(
 	deps map[string]*Dependency,
 	result *[]*Dependency,
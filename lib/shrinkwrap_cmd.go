@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ShrinkwrapCmdRun writes npm-shrinkwrap.json from the installed node_modules tree
+//
+//   frosty shrinkwrap [-package-lock] [-lockfile-version 1|2|3]
+func ShrinkwrapCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	shrinkwrapCmd := flag.NewFlagSet("shrinkwrap", flag.ExitOnError)
+	cwdFlag := shrinkwrapCmd.String("C", cwd, "Set working directory")
+	verboseFlag := shrinkwrapCmd.Bool("verbose", false, "Show verbose log output")
+	packageLockFlag := shrinkwrapCmd.Bool("package-lock", false,
+		"Write package-lock.json instead of npm-shrinkwrap.json")
+	lockfileVersionFlag := shrinkwrapCmd.Int("lockfile-version", 0,
+		"lockfileVersion (1, 2 or 3), defaults to the version of the existing lockfile or 1")
+
+	shrinkwrapCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+
+	if !IsDir(path.Join(ctx.Cwd, "node_modules")) {
+		return fmt.Errorf("%s has no node_modules, run frosty install first", ctx.Cwd)
+	}
+
+	graph, err := BuildLockGraph(ctx.Cwd)
+	if err != nil {
+		return err
+	}
+
+	file := path.Join(ctx.Cwd, "npm-shrinkwrap.json")
+	if *packageLockFlag {
+		file = path.Join(ctx.Cwd, "package-lock.json")
+	}
+
+	version := *lockfileVersionFlag
+	if version == 0 {
+		version = LockfileVersionOf(file, 1)
+	}
+
+	err = WriteLockfile(file, graph, version)
+	if err != nil {
+		return err
+	}
+
+	ctx.Info("Wrote %s", file)
+	return nil
+}
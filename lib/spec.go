@@ -0,0 +1,279 @@
+package lib
+
+import (
+	"fmt"
+	"github.com/sethmcl/gofrosty/vendor/nsemver"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SpecType classifies a dependency specifier
+type SpecType string
+
+const (
+	// VersionSpec is an explicit version (ex: 1.0.0)
+	VersionSpec SpecType = "VERSION"
+	// RangeSpec is a semver range (ex: ^1.0.0)
+	RangeSpec SpecType = "RANGE"
+	// TagSpec is a registry dist-tag (ex: latest)
+	TagSpec SpecType = "TAG"
+	// TarballSpec is a URL to a remote tar file (ex: https://foo.com/foo.tgz)
+	TarballSpec SpecType = "TARBALL"
+	// GitSpec is a git repository URL (ex: git+ssh://git@foo.com/foo.git#v1.0.0)
+	GitSpec SpecType = "GIT"
+	// HostedGitSpec is a hosted git shorthand (ex: github:user/repo)
+	HostedGitSpec SpecType = "HOSTED_GIT"
+	// FileSpec is a path to a local tar file (ex: file:../foo.tgz)
+	FileSpec SpecType = "FILE"
+	// DirectorySpec is a path to a local package directory (ex: file:../foo)
+	DirectorySpec SpecType = "DIRECTORY"
+	// AliasSpec installs a package under a different name (ex: npm:foo@^1.0.0)
+	AliasSpec SpecType = "ALIAS"
+	// WorkspaceSpec refers to a package in the same workspace (ex: workspace:*)
+	WorkspaceSpec SpecType = "WORKSPACE"
+)
+
+// Spec represents a parsed dependency specifier, which is the name/value pair
+// found in the dependencies section of a package.json file
+type Spec struct {
+	Name string
+	Raw  string
+	Type SpecType
+
+	// Range is set for VersionSpec, RangeSpec and WorkspaceSpec
+	Range *nsemver.Range
+	// Version is set for VersionSpec
+	Version string
+	// Tag is set for TagSpec
+	Tag string
+	// URL is set for TarballSpec and GitSpec
+	URL string
+	// Committish is set for GitSpec and HostedGitSpec
+	Committish string
+	// Hosted is set for HostedGitSpec
+	Hosted *HostedGit
+	// Path is set for FileSpec and DirectorySpec
+	Path string
+	// Alias is the spec of the real package, and is set for AliasSpec
+	Alias *Spec
+}
+
+var (
+	tagRe        = regexp.MustCompile("^[A-Za-z][A-Za-z0-9._-]*$")
+	notTagRe     = regexp.MustCompile("^([vV]\\d|[xX*](\\.|$))")
+	tarSuffixRe  = regexp.MustCompile("\\.(tgz|tar|tar\\.gz)$")
+	gitPrefixRe  = regexp.MustCompile("^(git\\+[a-z]+://|git://|git@)")
+	httpPrefixRe = regexp.MustCompile("^https?://")
+	commitSHARe  = regexp.MustCompile("^[0-9a-f]{40}$")
+)
+
+// ParseSpec classifies the dependency specifier for a named package
+func ParseSpec(name string, raw string) (*Spec, error) {
+	raw = strings.TrimSpace(raw)
+	spec := &Spec{Name: name, Raw: raw}
+
+	switch {
+	case strings.HasPrefix(raw, "npm:"):
+		return parseAliasSpec(spec)
+	case strings.HasPrefix(raw, "workspace:"):
+		return parseWorkspaceSpec(spec)
+	case strings.HasPrefix(raw, "file:"):
+		return parsePathSpec(spec, strings.TrimPrefix(raw, "file:"))
+	case isPathSpec(raw):
+		return parsePathSpec(spec, raw)
+	case gitPrefixRe.MatchString(raw):
+		return parseGitSpec(spec)
+	case httpPrefixRe.MatchString(raw):
+		spec.Type = TarballSpec
+		spec.URL = raw
+		return spec, nil
+	}
+
+	if hosted, ok := ParseHostedGit(raw, GetContext().GitHosts); ok {
+		spec.Type = HostedGitSpec
+		spec.Hosted = hosted
+		spec.Committish = hosted.Committish
+		return spec, nil
+	}
+
+	return parseRegistrySpec(spec)
+}
+
+// parseRegistrySpec parses a version, range or dist-tag
+func parseRegistrySpec(spec *Spec) (*Spec, error) {
+	raw := spec.Raw
+	if raw == "" {
+		raw = "*"
+	}
+
+	if tagRe.MatchString(raw) && !notTagRe.MatchString(raw) {
+		spec.Type = TagSpec
+		spec.Tag = raw
+		return spec, nil
+	}
+
+	ver, err := nsemver.ParseVersion(nsemver.Clean(raw))
+	if err == nil {
+		spec.Type = VersionSpec
+		spec.Version = ver.String()
+		spec.Range, err = nsemver.ParseRange(spec.Version)
+		if err != nil {
+			return nil, err
+		}
+		return spec, nil
+	}
+
+	rang, err := nsemver.ParseRange(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid dependency specifier %s@%s: %s", spec.Name, spec.Raw, err)
+	}
+
+	spec.Type = RangeSpec
+	spec.Range = rang
+	return spec, nil
+}
+
+// parseAliasSpec parses npm:<name>@<spec>
+func parseAliasSpec(spec *Spec) (*Spec, error) {
+	rest := strings.TrimPrefix(spec.Raw, "npm:")
+	realName, realRaw := SplitNameSpec(rest)
+	if realName == "" {
+		return nil, fmt.Errorf("Invalid alias specifier %s@%s", spec.Name, spec.Raw)
+	}
+
+	alias, err := parseRegistrySpec(&Spec{Name: realName, Raw: realRaw})
+	if err != nil {
+		return nil, err
+	}
+
+	spec.Type = AliasSpec
+	spec.Alias = alias
+	return spec, nil
+}
+
+// parseWorkspaceSpec parses workspace:<range>
+func parseWorkspaceSpec(spec *Spec) (*Spec, error) {
+	raw := strings.TrimPrefix(spec.Raw, "workspace:")
+	if raw == "" || raw == "^" || raw == "~" {
+		raw = "*"
+	}
+
+	rang, err := nsemver.ParseRange(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid workspace specifier %s@%s: %s", spec.Name, spec.Raw, err)
+	}
+
+	spec.Type = WorkspaceSpec
+	spec.Range = rang
+	return spec, nil
+}
+
+// parseGitSpec parses git URL, with optional #committish
+func parseGitSpec(spec *Spec) (*Spec, error) {
+	url := strings.TrimPrefix(spec.Raw, "git+")
+	parts := strings.SplitN(url, "#", 2)
+
+	spec.Type = GitSpec
+	spec.URL = parts[0]
+	if len(parts) > 1 {
+		spec.Committish = parts[1]
+	}
+
+	if strings.HasPrefix(spec.Committish, "-") {
+		return nil, fmt.Errorf("Invalid git committish %s@%s", spec.Name, spec.Raw)
+	}
+	return spec, nil
+}
+
+// parsePathSpec parses a local path to either a tar file or a directory
+func parsePathSpec(spec *Spec, p string) (*Spec, error) {
+	if p == "" {
+		return nil, fmt.Errorf("Invalid path specifier %s@%s", spec.Name, spec.Raw)
+	}
+
+	if strings.HasPrefix(p, "~/") {
+		p = path.Join(os.Getenv("HOME"), p[2:])
+	}
+
+	spec.Path = p
+	spec.Type = DirectorySpec
+	if tarSuffixRe.MatchString(p) {
+		spec.Type = FileSpec
+	}
+	return spec, nil
+}
+
+// isPathSpec returns true if specifier looks like a path on disk
+func isPathSpec(raw string) bool {
+	for _, prefix := range []string{"./", "../", "/", "~/"} {
+		if strings.HasPrefix(raw, prefix) {
+			return true
+		}
+	}
+	return raw == "." || raw == ".."
+}
+
+// SplitNameSpec splits name@spec into its parts, taking care of scoped names
+//
+//   "foo@^1.0.0" => "foo", "^1.0.0"
+//   "@scope/foo@1.0.0" => "@scope/foo", "1.0.0"
+//   "foo" => "foo", ""
+func SplitNameSpec(s string) (string, string) {
+	idx := strings.LastIndex(s, "@")
+	if idx <= 0 {
+		return s, ""
+	}
+	return s[:idx], s[idx+1:]
+}
+
+// IsRegistry returns true if spec is resolved against the npm registry
+func (s *Spec) IsRegistry() bool {
+	return s.Type == VersionSpec || s.Type == RangeSpec || s.Type == TagSpec
+}
+
+// FetchSpec returns the version, range or tag which is sent to the registry
+func (s *Spec) FetchSpec() string {
+	switch s.Type {
+	case TagSpec:
+		return s.Tag
+	case VersionSpec:
+		return s.Version
+	case RangeSpec:
+		return s.Range.Raw
+	}
+	return s.Raw
+}
+
+// Cacheable returns true if spec will always resolve to the same contents,
+// and so can be added to the cache index
+func (s *Spec) Cacheable() bool {
+	switch s.Type {
+	case DirectorySpec, FileSpec, WorkspaceSpec:
+		return false
+	case GitSpec, HostedGitSpec:
+		// branches and tags move, only commits always have the same contents
+		return commitSHARe.MatchString(s.Committish)
+	}
+	return true
+}
+
+// String returns name@raw
+func (s *Spec) String() string {
+	return fmt.Sprintf("%s@%s", s.Name, s.Raw)
+}
+
+// MatchesRange returns true if version satisfies range
+func MatchesRange(version string, rang *nsemver.Range) bool {
+	if rang == nil {
+		return false
+	}
+
+	ver, err := nsemver.ParseVersion(nsemver.Clean(version))
+	if err != nil {
+		return false
+	}
+
+	return rang.SatisfiedBy(ver)
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// TagCache remembers which version a dist-tag pointed to. Entries expire after
+// TTL, since tags are moved whenever a new version is published.
+type TagCache struct {
+	Filepath string                    `json:"-"`
+	TTL      time.Duration             `json:"-"`
+	Entries  map[string]*TagCacheEntry `json:"entries"`
+}
+
+// TagCacheEntry is a single dist-tag resolution
+type TagCacheEntry struct {
+	Version    string    `json:"version"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// LoadTagCache loads tag cache from disk. A missing or corrupt file results in
+// an empty cache.
+func LoadTagCache(filePath string, ttl time.Duration) *TagCache {
+	t := &TagCache{
+		Filepath: filePath,
+		TTL:      ttl,
+		Entries:  make(map[string]*TagCacheEntry),
+	}
+
+	bytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return t
+	}
+
+	err = json.Unmarshal(bytes, t)
+	if err != nil || t.Entries == nil {
+		t.Entries = make(map[string]*TagCacheEntry)
+	}
+
+	return t
+}
+
+// Get returns version which tag resolved to on registry, if the entry has not
+// expired
+func (t *TagCache) Get(registry string, name string, tag string) (string, bool) {
+	entry, ok := t.Entries[tagCacheKey(registry, name, tag)]
+	if !ok || time.Since(entry.ResolvedAt) >= t.TTL {
+		return "", false
+	}
+	return entry.Version, true
+}
+
+// Add records the version a tag resolved to on registry
+func (t *TagCache) Add(registry string, name string, tag string, version string) {
+	t.Entries[tagCacheKey(registry, name, tag)] = &TagCacheEntry{
+		Version:    version,
+		ResolvedAt: time.Now(),
+	}
+}
+
+// tagCacheKey returns key of a tag entry. Registries may point the same tag
+// of a module to different versions, so entries are kept apart by registry.
+//
+//   https://registry.npmjs.org foo@latest
+func tagCacheKey(registry string, name string, tag string) string {
+	return registry + " " + name + "@" + tag
+}
+
+// Commit saves to disk
+func (t *TagCache) Commit() error {
+	bytes, err := json.MarshalIndent(t, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path.Dir(t.Filepath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(t.Filepath, bytes, os.ModePerm)
+}
@@ -7,8 +7,14 @@ import (
 	"io"
 	"os"
 	"path"
+	"sort"
+	"time"
 )
 
+// tarEpoch is the modification time of every entry written by CreateTar. A fixed
+// time keeps archives of the same files byte-identical; npm uses the same value.
+var tarEpoch = time.Date(1985, time.October, 26, 8, 15, 0, 0, time.UTC)
+
 // ExtractTar extracts tar archive
 func ExtractTar(f io.Reader, target string, truncate int) error {
 	ctx := GetContext()
@@ -67,6 +73,9 @@ func ExtractTar(f io.Reader, target string, truncate int) error {
 
 			io.Copy(writer, tarReader)
 			writer.Close()
+		case tar.TypeXGlobalHeader:
+			// archives generated by git hosts carry the commit id in a global header
+			continue
 		default:
 			err := fmt.Errorf("untar failed type: %c in file %s", header.Typeflag, absPath)
 			return cleanup(target, err)
@@ -82,3 +91,62 @@ func cleanup(target string, err error) error {
 	os.RemoveAll(target)
 	return err
 }
+
+// CreateTar writes a gzipped tar archive of files, which are relative to root.
+// Entries are stored under prefix (ex: package/) in sorted order, with fixed
+// timestamps and ownership, so the same files always produce the same archive.
+func CreateTar(w io.Writer, root string, files []string, prefix string) error {
+	sorted := make([]string, len(files))
+	copy(sorted, files)
+	sort.Strings(sorted)
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	for _, file := range sorted {
+		absPath := path.Join(root, file)
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		mode := int64(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Name:     path.Join(prefix, file),
+			Mode:     mode,
+			Size:     info.Size(),
+			ModTime:  tarEpoch,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(absPath)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return gzw.Close()
+}
@@ -21,3 +21,20 @@ func StringSliceContains(haystack []string, needle string) bool {
 
 	return false
 }
+
+// ToStringMap converts a decoded JSON object to a map of strings. Values which
+// are not strings are skipped, and anything other than an object results in an
+// empty map.
+func ToStringMap(raw interface{}) map[string]string {
+	result := make(map[string]string)
+	m, ok := raw.(map[string]interface{})
+	if ok {
+		for k, v := range m {
+			sv, ok := v.(string)
+			if ok {
+				result[k] = sv
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sethmcl/gofrosty/vendor/nsemver"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ViewPackage returns the manifest of the version of name matching spec (a
+// version, range or dist-tag; latest when empty), along with the packument
+// fields npm view shows: dist-tags, versions, time and maintainers.
+func (n *NpmRegistryClient) ViewPackage(name string, raw string) (map[string]interface{}, error) {
+	packument, err := n.GetFullPackument(name)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := resolveViewVersion(packument, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := struct {
+		Versions    map[string]map[string]interface{} `json:"versions"`
+		Time        map[string]interface{}            `json:"time"`
+		Maintainers interface{}                       `json:"maintainers"`
+	}{}
+	err = json.Unmarshal(packument.Raw, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid packument for %s :: %s", name, err.Error())
+	}
+
+	view := make(map[string]interface{})
+	for key, value := range doc.Versions[version] {
+		view[key] = value
+	}
+
+	versions, err := nsemver.NewVersions(packument.VersionList())
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(versions))
+	list := make([]string, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, v.Raw)
+	}
+
+	view["dist-tags"] = packument.DistTags
+	view["versions"] = list
+	if doc.Time != nil {
+		view["time"] = doc.Time
+	}
+	if _, ok := view["maintainers"]; !ok && doc.Maintainers != nil {
+		view["maintainers"] = doc.Maintainers
+	}
+
+	return view, nil
+}
+
+// resolveViewVersion returns the newest version matching a version, range or
+// dist-tag. No spec means the latest dist-tag.
+func resolveViewVersion(packument *Packument, raw string) (string, error) {
+	if raw == "" {
+		raw = "latest"
+	}
+
+	spec, err := ParseSpec(packument.Name, raw)
+	if err != nil {
+		return "", err
+	}
+
+	switch spec.Type {
+	case TagSpec:
+		version, ok := packument.DistTags[spec.Tag]
+		if !ok {
+			return "", fmt.Errorf("%s has no dist-tag %s", packument.Name, spec.Tag)
+		}
+		return version, nil
+	case VersionSpec, RangeSpec:
+		version, err := nsemver.MatchLatest(spec.FetchSpec(), packument.VersionList())
+		if err != nil {
+			return "", fmt.Errorf("%s has no version matching %s", packument.Name, raw)
+		}
+		return version, nil
+	}
+
+	return "", fmt.Errorf("Cannot view %s, only versions, ranges and dist-tags are supported", spec)
+}
+
+// lookupViewField returns value at a dotted path (ex: dist.tarball)
+func lookupViewField(view map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = view
+	for _, key := range strings.Split(field, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			if tags, isTags := value.(map[string]string); isTags {
+				v, found := tags[key]
+				return v, found
+			}
+			return nil, false
+		}
+		value, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// formatViewValue formats strings as they are, and other values as JSON
+func formatViewValue(value interface{}, asJSON bool) (string, error) {
+	if s, ok := value.(string); ok && !asJSON {
+		return s, nil
+	}
+
+	bytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// ViewCmdRun runs the view command
+//
+//   frosty view [-json] <name>[@<version|range|tag>] [field...]
+//
+//   frosty view foo                 -- summary of the latest version
+//   frosty view foo@^1.2 dependencies
+//   frosty view @scope/foo dist.tarball
+func ViewCmdRun(args []string) error {
+	ctx := GetContext()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	viewCmd := flag.NewFlagSet("view", flag.ExitOnError)
+	cwdFlag := viewCmd.String("C", cwd, "Set working directory")
+	verboseFlag := viewCmd.Bool("verbose", false, "Show verbose log output")
+	jsonFlag := viewCmd.Bool("json", false, "Print as JSON")
+	registryFlag := viewCmd.String("registry", "", "Registry URL, overrides npmrc and env vars")
+
+	viewCmd.Parse(args)
+
+	ctx.Cwd = ResolvePath(*cwdFlag, cwd)
+	ctx.Verbose = *verboseFlag
+
+	if viewCmd.NArg() == 0 {
+		return fmt.Errorf("Please specify a package (ex: frosty view foo@^1.0.0)")
+	}
+
+	npmFlags := make(map[string]string)
+	if *registryFlag != "" {
+		npmFlags["registry"] = *registryFlag
+	}
+	err = ConfigureNpm(ctx, npmFlags, nil)
+	if err != nil {
+		return err
+	}
+
+	// package data is printed to stdout, so it can be piped
+	ctx.SetLogOutput(os.Stderr)
+
+	name, raw := SplitNameSpec(viewCmd.Arg(0))
+	view, err := ctx.NpmRegistry.ViewPackage(name, raw)
+	if err != nil {
+		return err
+	}
+
+	fields := viewCmd.Args()[1:]
+	if len(fields) == 0 {
+		if *jsonFlag {
+			out, err := formatViewValue(view, true)
+			if err != nil {
+				return err
+			}
+			ctx.Print("%s", out)
+			return nil
+		}
+
+		printViewSummary(ctx, view)
+		return nil
+	}
+
+	for _, field := range fields {
+		value, ok := lookupViewField(view, field)
+		if !ok {
+			continue
+		}
+
+		out, err := formatViewValue(value, *jsonFlag)
+		if err != nil {
+			return err
+		}
+
+		// the field name is only needed to tell several fields apart
+		if len(fields) > 1 {
+			out = field + " = " + out
+		}
+		ctx.Print("%s", out)
+	}
+
+	return nil
+}
+
+// printViewSummary prints the overview of a version shown by frosty view
+func printViewSummary(ctx *Context, view map[string]interface{}) {
+	str := func(key string) string {
+		s, _ := view[key].(string)
+		return s
+	}
+
+	dependencies := ToStringMap(view["dependencies"])
+	versions, _ := view["versions"].([]string)
+	license := str("license")
+	if license == "" {
+		license = "Proprietary"
+	}
+
+	ctx.Print("%s@%s | %s | deps: %d | versions: %d",
+		str("name"), str("version"), license, len(dependencies), len(versions))
+
+	if description := str("description"); description != "" {
+		ctx.Print("%s", description)
+	}
+	if homepage := str("homepage"); homepage != "" {
+		ctx.Print("%s", homepage)
+	}
+
+	switch deprecated := view["deprecated"].(type) {
+	case string:
+		ctx.Print("\nDEPRECATED: %s", deprecated)
+	case bool:
+		if deprecated {
+			ctx.Print("\nDEPRECATED")
+		}
+	}
+
+	if dist, ok := view["dist"].(map[string]interface{}); ok {
+		ctx.Print("\ndist")
+		for _, key := range []string{"tarball", "shasum", "integrity"} {
+			if value, ok := dist[key].(string); ok && value != "" {
+				ctx.Print(".%s: %s", key, value)
+			}
+		}
+	}
+
+	if len(dependencies) > 0 {
+		ctx.Print("\ndependencies:")
+		for _, dep := range sortedKeys(dependencies) {
+			ctx.Print("%s: %s", dep, dependencies[dep])
+		}
+	}
+
+	if maintainers, ok := view["maintainers"].([]interface{}); ok && len(maintainers) > 0 {
+		ctx.Print("\nmaintainers:")
+		for _, maintainer := range maintainers {
+			switch m := maintainer.(type) {
+			case string:
+				ctx.Print("- %s", m)
+			case map[string]interface{}:
+				name, _ := m["name"].(string)
+				if email, _ := m["email"].(string); email != "" {
+					name = fmt.Sprintf("%s <%s>", name, email)
+				}
+				ctx.Print("- %s", name)
+			}
+		}
+	}
+
+	if tags, ok := view["dist-tags"].(map[string]string); ok && len(tags) > 0 {
+		ctx.Print("\ndist-tags:")
+		for _, tag := range sortedKeys(tags) {
+			ctx.Print("%s: %s", tag, tags[tag])
+		}
+	}
+
+	if times, ok := view["time"].(map[string]interface{}); ok {
+		if published, ok := times[str("version")].(string); ok {
+			ctx.Print("\npublished %s", published)
+		}
+	}
+}
+
+// sortedKeys returns keys of a map, sorted
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
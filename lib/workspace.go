@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Workspace is a package which lives inside the root package of a monorepo,
+// and is matched by one of the globs in the root package.json workspaces list
+type Workspace struct {
+	Name    string
+	Dir     string
+	Package *Package
+}
+
+// LoadWorkspaces finds every package matched by the workspaces globs of the
+// root package. Globs prefixed with ! exclude packages.
+func LoadWorkspaces(root *Package) (map[string]*Workspace, error) {
+	workspaces := make(map[string]*Workspace)
+	excluded := make(map[string]bool)
+
+	for _, pattern := range root.Workspaces {
+		if strings.HasPrefix(pattern, "!") {
+			matches, err := filepath.Glob(path.Join(root.Dir, pattern[1:]))
+			if err != nil {
+				return nil, err
+			}
+			for _, match := range matches {
+				excluded[match] = true
+			}
+		}
+	}
+
+	for _, pattern := range root.Workspaces {
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		matches, err := filepath.Glob(path.Join(root.Dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range matches {
+			if excluded[dir] || !IsFile(path.Join(dir, "package.json")) {
+				continue
+			}
+
+			pkg, err := LoadPackageFromDir(dir)
+			if err != nil {
+				return nil, err
+			}
+
+			if pkg.Name == "" {
+				return nil, fmt.Errorf("Workspace %s has no name in package.json", dir)
+			}
+
+			if other, ok := workspaces[pkg.Name]; ok && other.Dir != dir {
+				return nil, fmt.Errorf(
+					"Workspace name %s is used by both %s and %s", pkg.Name, other.Dir, dir)
+			}
+
+			workspaces[pkg.Name] = &Workspace{
+				Name:    pkg.Name,
+				Dir:     dir,
+				Package: pkg,
+			}
+		}
+	}
+
+	return workspaces, nil
+}
+
+// FindWorkspace returns workspace by package name, or by path relative to the root
+func FindWorkspace(workspaces map[string]*Workspace, root string, name string) (*Workspace, error) {
+	if ws, ok := workspaces[name]; ok {
+		return ws, nil
+	}
+
+	dir := ResolvePath(name, root)
+	for _, ws := range workspaces {
+		if ws.Dir == dir {
+			return ws, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No workspace named %s", name)
+}
+
+// SortedWorkspaceNames returns workspace names in a stable order
+func SortedWorkspaceNames(workspaces map[string]*Workspace) []string {
+	names := make([]string, 0, len(workspaces))
+	for name := range workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Satisfies returns true if this workspace can be used for the dependency spec
+func (ws *Workspace) Satisfies(spec *Spec) bool {
+	switch spec.Type {
+	case WorkspaceSpec, RangeSpec, VersionSpec:
+		return ws.Package.Version == "" || MatchesRange(ws.Package.Version, spec.Range)
+	case TagSpec:
+		return spec.Tag == "latest"
+	}
+	return false
+}
+
+// Link symlinks the workspace to installDir, and links its bin entries
+func (ws *Workspace) Link(installDir string) error {
+	rel, err := filepath.Rel(path.Dir(installDir), ws.Dir)
+	if err != nil {
+		return err
+	}
+
+	err = replaceSymlink(rel, installDir)
+	if err != nil {
+		return err
+	}
+	GetContext().Debug("Linked workspace %s => %s", installDir, rel)
+
+	// LinkBin resolves paths relative to the package directory, so bins are
+	// linked from a package rooted at the symlink rather than the workspace itself
+	linked, err := LoadPackageFromDir(installDir)
+	if err != nil {
+		return err
+	}
+
+	relBin, relModule := BinLinkPaths(ws.Name)
+	return linked.LinkBin(relBin, relModule)
+}
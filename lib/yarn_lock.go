@@ -0,0 +1,597 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// YarnLock represents a yarn.lock file of yarn classic (v1). Entries are keyed
+// by every name@spec pattern of their header, so entries which satisfy several
+// patterns appear several times.
+type YarnLock struct {
+	Path    string
+	Entries map[string]*YarnLockEntry
+}
+
+// YarnLockEntry is a resolved package in a yarn.lock file. Patterns are the
+// name@spec patterns it was resolved for (ex: lodash@^4.17.15). Name is the
+// name of the package, which differs from the pattern names for aliases.
+type YarnLockEntry struct {
+	Name                 string
+	Patterns             []string
+	Version              string
+	Resolved             string
+	Integrity            string
+	Dependencies         map[string]string
+	OptionalDependencies map[string]string
+}
+
+var (
+	// yarn quotes keys and values which could be mistaken for other types
+	yarnPlainRe   = regexp.MustCompile(`^[a-zA-Z]`)
+	yarnSpecialRe = regexp.MustCompile(`[:\s\\",\[\]]`)
+)
+
+// LoadYarnLock reads a yarn.lock file
+func LoadYarnLock(file string) (*YarnLock, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := ParseYarnLock(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid yarn.lock %s :: %s", file, err.Error())
+	}
+
+	lock.Path = file
+	return lock, nil
+}
+
+// ParseYarnLock parses the contents of a yarn.lock v1 file
+//
+//   "@scope/foo@^1.0.0", "@scope/foo@^1.1.0":
+//     version "1.2.0"
+//     resolved "https://registry.yarnpkg.com/@scope/foo/-/foo-1.2.0.tgz#<sha1>"
+//     integrity sha512-...
+//     dependencies:
+//       bar "~2.0.0"
+func ParseYarnLock(data []byte) (*YarnLock, error) {
+	lock := &YarnLock{Entries: make(map[string]*YarnLockEntry)}
+
+	var entry *YarnLockEntry
+	var section map[string]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(line) - len(trimmed)
+		switch {
+		case indent == 0:
+			if strings.HasPrefix(trimmed, "__metadata:") {
+				return nil, fmt.Errorf("only yarn.lock v1 (yarn classic) is supported")
+			}
+			if !strings.HasSuffix(trimmed, ":") {
+				return nil, fmt.Errorf("line %d: expected a package header", lineNumber)
+			}
+
+			entry = &YarnLockEntry{
+				Dependencies:         make(map[string]string),
+				OptionalDependencies: make(map[string]string),
+			}
+			section = nil
+
+			for _, pattern := range strings.Split(strings.TrimSuffix(trimmed, ":"), ", ") {
+				pattern = unquoteYarnValue(strings.TrimSpace(pattern))
+				entry.Name = yarnPackageName(pattern)
+				entry.Patterns = append(entry.Patterns, pattern)
+				lock.Entries[pattern] = entry
+			}
+
+		case entry == nil:
+			return nil, fmt.Errorf("line %d: expected a package header", lineNumber)
+
+		case indent == 2:
+			key, value := splitYarnLine(trimmed)
+			section = nil
+			switch key {
+			case "version":
+				entry.Version = value
+			case "resolved":
+				entry.Resolved = value
+			case "integrity":
+				entry.Integrity = value
+			case "dependencies:":
+				section = entry.Dependencies
+			case "optionalDependencies:":
+				section = entry.OptionalDependencies
+			}
+
+		case section != nil:
+			key, value := splitYarnLine(trimmed)
+			section[key] = value
+		}
+	}
+
+	return lock, scanner.Err()
+}
+
+// splitYarnLine splits a line into its key and value, which may both be quoted
+func splitYarnLine(line string) (string, string) {
+	key, rest := line, ""
+	if strings.HasPrefix(line, "\"") {
+		if end := strings.Index(line[1:], "\""); end >= 0 {
+			key, rest = line[:end+2], line[end+2:]
+		}
+	} else if i := strings.Index(line, " "); i >= 0 {
+		key, rest = line[:i], line[i:]
+	}
+	return unquoteYarnValue(key), unquoteYarnValue(strings.TrimSpace(rest))
+}
+
+// splitYarnPattern splits name@spec, where spec may itself contain @ for aliases
+//
+//   "@scope/foo@^1.0.0"  =>  "@scope/foo", "^1.0.0"
+//   "baz@npm:bar@^2.0.0"  =>  "baz", "npm:bar@^2.0.0"
+func splitYarnPattern(pattern string) (string, string) {
+	if pattern == "" {
+		return "", ""
+	}
+	idx := strings.Index(pattern[1:], "@")
+	if idx < 0 {
+		return pattern, ""
+	}
+	return pattern[:idx+1], pattern[idx+2:]
+}
+
+// yarnPackageName returns the name of the package resolved for pattern
+//
+//   "baz@npm:bar@^2.0.0"  =>  "bar"
+func yarnPackageName(pattern string) string {
+	name, spec := splitYarnPattern(pattern)
+	if strings.HasPrefix(spec, "npm:") {
+		name, _ = SplitNameSpec(strings.TrimPrefix(spec, "npm:"))
+	}
+	return name
+}
+
+func unquoteYarnValue(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"") {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ResolvedIntegrity returns the tarball URL and integrity of the entry. yarn
+// appends the sha1 hex digest of tarballs to resolved URLs, which is used as
+// the integrity of entries written before yarn recorded integrity.
+//
+//   https://r.yarnpkg.com/foo/-/foo-1.0.0.tgz#<hex>  =>  https://r.yarnpkg.com/foo/-/foo-1.0.0.tgz, sha1-<base64>
+func (e *YarnLockEntry) ResolvedIntegrity() (string, string) {
+	resolved, integrity := e.Resolved, e.Integrity
+	if !httpPrefixRe.MatchString(resolved) {
+		return resolved, integrity
+	}
+
+	parts := strings.SplitN(resolved, "#", 2)
+	resolved = parts[0]
+	if integrity == "" && len(parts) == 2 {
+		sum, err := hex.DecodeString(parts[1])
+		if err == nil {
+			integrity = "sha1-" + base64.StdEncoding.EncodeToString(sum)
+		}
+	}
+	return resolved, integrity
+}
+
+// Find returns the entry resolved for name@spec
+func (y *YarnLock) Find(name string, spec string) (*YarnLockEntry, bool) {
+	entry, ok := y.Entries[name+"@"+spec]
+	return entry, ok
+}
+
+// Missing returns name@spec patterns of dependencies declared by the root
+// package or by workspaces which have no entry in yarn.lock. yarn.lock is out
+// of date with package.json when any pattern is missing.
+func (y *YarnLock) Missing(root *Package, workspaces map[string]*Workspace) []string {
+	packages := []*Package{root}
+	for _, name := range SortedWorkspaceNames(workspaces) {
+		packages = append(packages, workspaces[name].Package)
+	}
+
+	missing := []string{}
+	for _, pkg := range packages {
+		for _, deps := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.OptionalDependencies} {
+			for name, spec := range deps {
+				if isYarnWorkspaceDep(workspaces, name, spec) {
+					continue
+				}
+				if _, ok := y.Find(name, spec); !ok {
+					missing = append(missing, name+"@"+spec)
+				}
+			}
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
+
+// isYarnWorkspaceDep returns true if name@spec is satisfied by a workspace,
+// which yarn links rather than records in yarn.lock
+func isYarnWorkspaceDep(workspaces map[string]*Workspace, name string, spec string) bool {
+	ws, ok := workspaces[name]
+	if !ok {
+		return false
+	}
+
+	parsed, err := ParseSpec(name, spec)
+	return err == nil && ws.Satisfies(parsed)
+}
+
+// Graph lays out the packages of yarn.lock as a node_modules tree. yarn.lock
+// only records which version each pattern resolved to, so packages are
+// hoisted as high in the tree as possible, and are nested where versions
+// conflict. Workspaces are linked into the root node_modules.
+func (y *YarnLock) Graph(root *Package, workspaces map[string]*Workspace) (*LockGraph, error) {
+	g := NewLockGraph()
+	g.Packages[""] = NewLockNode(root)
+	g.Packages[""].Resolved = ""
+	g.Packages[""].Integrity = ""
+
+	h := &yarnHoister{lock: y, graph: g, workspaces: workspaces}
+	h.enqueue("", g.Packages[""], true)
+
+	for _, name := range SortedWorkspaceNames(workspaces) {
+		ws := workspaces[name]
+		rel, err := filepath.Rel(root.Dir, ws.Dir)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		g.Packages[LockPath("", name)] = &LockNode{Name: name, Version: ws.Package.Version, Resolved: rel, Link: true}
+		g.Packages[rel] = NewLockNode(ws.Package)
+		g.Packages[rel].Resolved = ""
+		g.Packages[rel].Integrity = ""
+		h.enqueue(rel, g.Packages[rel], true)
+	}
+
+	err := h.run()
+	if err != nil {
+		return nil, err
+	}
+
+	g.MarkFlags()
+	return g, nil
+}
+
+// yarnHoister places the packages of a yarn.lock in a node_modules tree,
+// breadth first so that shallow packages get the highest spots
+type yarnHoister struct {
+	lock       *YarnLock
+	graph      *LockGraph
+	workspaces map[string]*Workspace
+	queue      []yarnRequest
+	edges      []yarnEdge
+}
+
+// yarnRequest is a dependency of the package at from
+type yarnRequest struct {
+	from string
+	name string
+	spec string
+}
+
+// yarnEdge records which package a dependency was resolved to
+type yarnEdge struct {
+	from     string
+	name     string
+	resolved string
+}
+
+// enqueue adds the dependencies of the package at p, sorted so that layouts are stable
+func (h *yarnHoister) enqueue(p string, node *LockNode, withDev bool) {
+	deps := make(map[string]string)
+	maps := []map[string]string{node.Dependencies, node.OptionalDependencies}
+	if withDev {
+		maps = append(maps, node.DevDependencies)
+	}
+	for _, m := range maps {
+		for name, spec := range m {
+			deps[name] = spec
+		}
+	}
+
+	for _, name := range sortedKeys(deps) {
+		h.queue = append(h.queue, yarnRequest{from: p, name: name, spec: deps[name]})
+	}
+}
+
+func (h *yarnHoister) run() error {
+	for len(h.queue) > 0 {
+		req := h.queue[0]
+		h.queue = h.queue[1:]
+
+		if isYarnWorkspaceDep(h.workspaces, req.name, req.spec) {
+			continue
+		}
+
+		entry, ok := h.lock.Find(req.name, req.spec)
+		if !ok {
+			return fmt.Errorf("yarn.lock has no entry for %s@%s (required by %s)",
+				req.name, req.spec, describeLockPath(req.from))
+		}
+
+		// reuse the package the dependency already resolves to, if it is the same
+		if p, ok := h.graph.Resolve(req.from, req.name); ok {
+			existing := h.graph.Packages[p]
+			if existing.Name == entry.Name && existing.Version == entry.Version {
+				h.edges = append(h.edges, yarnEdge{req.from, req.name, p})
+				continue
+			}
+		}
+
+		resolved, integrity := entry.ResolvedIntegrity()
+		p := h.place(req.from, req.name)
+		node := &LockNode{
+			Name:                 entry.Name,
+			Version:              entry.Version,
+			Resolved:             resolved,
+			Integrity:            integrity,
+			Dependencies:         entry.Dependencies,
+			OptionalDependencies: entry.OptionalDependencies,
+		}
+		h.graph.Packages[p] = node
+		h.edges = append(h.edges, yarnEdge{req.from, req.name, p})
+		h.enqueue(p, node, false)
+	}
+
+	return nil
+}
+
+// place returns the highest location for name, as seen from the package at
+// from. The location must be free, and must not hide another version of name
+// from packages which already depend on it.
+func (h *yarnHoister) place(from string, name string) string {
+	ancestors := []string{from}
+	for dir := from; dir != ""; {
+		dir = lockParentPath(dir)
+		ancestors = append(ancestors, dir)
+	}
+
+	// the highest free spot, below any conflicting version
+	highest := 0
+	for i := range ancestors {
+		if _, taken := h.graph.Packages[LockPath(ancestors[i], name)]; taken {
+			break
+		}
+		highest = i
+	}
+
+	for i := highest; i > 0; i-- {
+		if !h.hides(ancestors[i], name) {
+			return LockPath(ancestors[i], name)
+		}
+	}
+	return LockPath(from, name)
+}
+
+// hides returns true if installing name in the node_modules of dir would
+// change what packages below dir resolve name to
+func (h *yarnHoister) hides(dir string, name string) bool {
+	spot := LockPath(dir, name)
+	for _, edge := range h.edges {
+		if edge.name != name || edge.resolved == spot {
+			continue
+		}
+		if dir == "" || edge.from == dir || strings.HasPrefix(edge.from, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// describeLockPath returns a readable name for a location in the tree
+func describeLockPath(p string) string {
+	if p == "" {
+		return "package.json"
+	}
+	return TreePath("", p)
+}
+
+// NewYarnLock converts a resolved graph to a yarn.lock. Each dependency
+// declared in the graph becomes a pattern of the entry it resolves to, and
+// packages at different locations with the same version share an entry, even
+// when installed under an alias.
+// yarn.lock maps each pattern to a single version, so patterns which resolve
+// to several versions are returned as conflicts, and keep the version of the
+// shallowest dependent. Linked packages, such as workspaces, are not recorded.
+func NewYarnLock(g *LockGraph) (*YarnLock, []string) {
+	lock := &YarnLock{Entries: make(map[string]*YarnLockEntry)}
+	entries := make(map[string]*YarnLockEntry)
+	conflicts := []string{}
+
+	entryFor := func(p string) *YarnLockEntry {
+		node := g.Packages[p]
+		name := node.Name
+		if name == "" {
+			name = LockPathName(p)
+		}
+		key := name + "@" + node.Version + " " + node.Resolved
+		if entry, ok := entries[key]; ok {
+			return entry
+		}
+
+		entry := &YarnLockEntry{
+			Name:                 name,
+			Version:              node.Version,
+			Resolved:             node.Resolved,
+			Integrity:            node.Integrity,
+			Dependencies:         make(map[string]string),
+			OptionalDependencies: make(map[string]string),
+		}
+		for dep, spec := range node.Dependencies {
+			if _, optional := node.OptionalDependencies[dep]; !optional {
+				entry.Dependencies[dep] = spec
+			}
+		}
+		for dep, spec := range node.OptionalDependencies {
+			entry.OptionalDependencies[dep] = spec
+		}
+
+		// yarn records the sha1 of tarballs in their URL
+		if strings.HasPrefix(node.Integrity, "sha1-") && httpPrefixRe.MatchString(node.Resolved) {
+			sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(node.Integrity, "sha1-"))
+			if err == nil {
+				entry.Resolved += "#" + hex.EncodeToString(sum)
+				entry.Integrity = ""
+			}
+		}
+
+		entries[key] = entry
+		return entry
+	}
+
+	addPattern := func(pattern string, p string) {
+		entry := entryFor(p)
+		if existing, ok := lock.Entries[pattern]; ok {
+			if existing != entry {
+				conflicts = append(conflicts, fmt.Sprintf("%s resolves to %s and %s", pattern, existing.Version, entry.Version))
+			}
+			return
+		}
+		entry.Patterns = append(entry.Patterns, pattern)
+		lock.Entries[pattern] = entry
+	}
+
+	referenced := make(map[string]bool)
+	for _, from := range g.SortedPaths() {
+		node := g.Packages[from]
+		if node.Link {
+			continue
+		}
+
+		// a package may require the same dependency with different specs (ex:
+		// in dependencies and devDependencies), and each spec is a pattern
+		maps := []map[string]string{node.Dependencies, node.OptionalDependencies}
+		if !IsInstallPath(from) {
+			maps = append(maps, node.DevDependencies)
+		}
+		for _, deps := range maps {
+			for _, name := range sortedKeys(deps) {
+				p, ok := g.Resolve(from, name)
+				if !ok || !isYarnLockable(g.Packages[p]) {
+					continue
+				}
+				referenced[p] = true
+				addPattern(name+"@"+deps[name], p)
+			}
+		}
+	}
+
+	// lockfiles without requirements (ex: npm-shrinkwrap.json from npm 2)
+	// only tell which version is installed
+	for _, p := range g.SortedPaths() {
+		node := g.Packages[p]
+		if referenced[p] || !IsInstallPath(p) || !isYarnLockable(node) {
+			continue
+		}
+
+		spec := node.Version
+		if node.Name != "" && node.Name != LockPathName(p) {
+			spec = "npm:" + node.Name + "@" + node.Version
+		} else if spec == "" {
+			spec = node.Resolved
+		}
+		addPattern(LockPathName(p)+"@"+spec, p)
+	}
+
+	return lock, conflicts
+}
+
+// isYarnLockable returns true if node is recorded in yarn.lock
+func isYarnLockable(node *LockNode) bool {
+	return !node.Link && !strings.HasPrefix(node.Resolved, "file:")
+}
+
+// Write saves the yarn.lock to file, in the format written by yarn
+func (y *YarnLock) Write(file string) error {
+	entries := []*YarnLockEntry{}
+	seen := make(map[*YarnLockEntry]bool)
+	for _, entry := range y.Entries {
+		if !seen[entry] {
+			seen[entry] = true
+			sort.Strings(entry.Patterns)
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Patterns[0] < entries[j].Patterns[0]
+	})
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.\n")
+	buf.WriteString("# yarn lockfile v1\n\n")
+
+	for _, entry := range entries {
+		patterns := make([]string, len(entry.Patterns))
+		for i, pattern := range entry.Patterns {
+			patterns[i] = quoteYarnValue(pattern)
+		}
+
+		fmt.Fprintf(buf, "\n%s:\n", strings.Join(patterns, ", "))
+		fmt.Fprintf(buf, "  version %s\n", quoteYarnValue(entry.Version))
+		if entry.Resolved != "" {
+			fmt.Fprintf(buf, "  resolved %s\n", quoteYarnValue(entry.Resolved))
+		}
+		if entry.Integrity != "" {
+			fmt.Fprintf(buf, "  integrity %s\n", quoteYarnValue(entry.Integrity))
+		}
+
+		for _, section := range []struct {
+			key  string
+			deps map[string]string
+		}{{"dependencies", entry.Dependencies}, {"optionalDependencies", entry.OptionalDependencies}} {
+			if len(section.deps) == 0 {
+				continue
+			}
+			fmt.Fprintf(buf, "  %s:\n", section.key)
+			for _, name := range sortedKeys(section.deps) {
+				fmt.Fprintf(buf, "    %s %s\n", quoteYarnValue(name), quoteYarnValue(section.deps[name]))
+			}
+		}
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// quoteYarnValue quotes s the way yarn does
+func quoteYarnValue(s string) string {
+	if !yarnPlainRe.MatchString(s) || yarnSpecialRe.MatchString(s) ||
+		strings.HasPrefix(s, "true") || strings.HasPrefix(s, "false") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseAliasSpec(t *testing.T) {
+	test := testutil.New(t)
+
+	spec, err := lib.ParseSpec("lodash4", "npm:lodash@^4.17.0")
+	test.Assert(err, nil)
+	test.Assert(spec.Type, lib.AliasSpec)
+	test.Assert(spec.Name, "lodash4")
+	test.Assert(spec.Alias.Name, "lodash")
+	test.Assert(spec.Alias.Raw, "^4.17.0")
+	test.Assert(spec.Alias.Type, lib.RangeSpec)
+	test.Assert(spec.Alias.Cacheable(), true)
+
+	spec, err = lib.ParseSpec("old-foo", "npm:@scope/foo@1.0.0")
+	test.Assert(err, nil)
+	test.Assert(spec.Alias.Name, "@scope/foo")
+	test.Assert(spec.Alias.Type, lib.VersionSpec)
+
+	_, err = lib.ParseSpec("bad", "npm:lodash@github:user/repo")
+	test.Assert(err != nil, true)
+}
+
+func TestBinLinkPaths(t *testing.T) {
+	test := testutil.New(t)
+
+	relBin, relModule := lib.BinLinkPaths("lodash4")
+	test.Assert(relBin, "../.bin")
+	test.Assert(relModule, "../lodash4")
+
+	relBin, relModule = lib.BinLinkPaths("@scope/foo")
+	test.Assert(relBin, "../../.bin")
+	test.Assert(relModule, "../@scope/foo")
+}
+
+func TestLinkBinAlias(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	nodeModules := path.Join(dir, "node_modules")
+	for _, name := range []string{"tool", "tool1"} {
+		installDir := path.Join(nodeModules, name)
+		os.MkdirAll(path.Join(installDir, "bin"), os.ModePerm)
+		ioutil.WriteFile(
+			path.Join(installDir, "package.json"),
+			[]byte(`{"name": "tool", "version": "1.0.0", "bin": "./bin/tool"}`),
+			os.ModePerm)
+		ioutil.WriteFile(path.Join(installDir, "bin", "tool"), []byte(""), os.ModePerm)
+
+		pkg, err := lib.LoadPackageFromDir(installDir)
+		test.Assert(err, nil)
+
+		relBin, relModule := lib.BinLinkPaths(name)
+		err = pkg.LinkBin(relBin, relModule)
+		test.Assert(err, nil)
+	}
+
+	// the bin name comes from the real package name, and the link points at
+	// whichever install was linked last
+	target, err := os.Readlink(path.Join(nodeModules, ".bin", "tool"))
+	test.Assert(err, nil)
+	test.Assert(target, "../tool1/bin/tool")
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"path"
+	"testing"
+)
+
+func TestCacheIndexScopedModules(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	index, err := lib.LoadCacheIndex(dir)
+	test.Assert(err, nil)
+
+	// a scoped module must not share the index file of the unscoped module
+	// with the same base name
+	test.Assert(index.Add("@scope/foo", "1.0.0", "/cache/@scope/foo/1.0.0"), nil)
+	test.Assert(index.Add("foo", "1.0.0", "/cache/foo/1.0.0"), nil)
+	test.Assert(index.Commit(), nil)
+
+	test.Assert(test.IsFile(path.Join(dir, "@scope", "foo.json")), true)
+	test.Assert(test.IsFile(path.Join(dir, "foo.json")), true)
+
+	reloaded, err := lib.LoadCacheIndex(dir)
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		name string
+		dir  string
+	}
+
+	table := []TableEntry{
+		TableEntry{"@scope/foo", "/cache/@scope/foo/1.0.0"},
+		TableEntry{"foo", "/cache/foo/1.0.0"},
+	}
+
+	for _, entry := range table {
+		dir, err := reloaded.Get(entry.name, "1.0.0")
+		test.Assert(err, nil, entry.name)
+		test.Assert(dir, entry.dir, entry.name)
+	}
+}
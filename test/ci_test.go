@@ -0,0 +1,127 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCI(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+	reg.Publish("foo", "1.1.0", nil)
+	reg.Publish("bar", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	app := path.Join(dir, "app")
+	home := path.Join(dir, "home")
+	args := []string{"-C", app, "-frosty-home", home, "-registry", reg.URL}
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0"}, "devDependencies": {"bar": "1.0.0"}}`)
+
+	err := lib.CICmdRun(args)
+	test.Assert(err != nil && strings.Contains(err.Error(), "package-lock.json"), true, err)
+
+	lockfile := path.Join(app, "package-lock.json")
+	writePackageLock(test, lockfile, reg, 3, map[string]map[string]interface{}{
+		"": map[string]interface{}{"name": "app", "version": "1.0.0",
+			"dependencies": map[string]string{"foo": "^1.0.0"}, "devDependencies": map[string]string{"bar": "1.0.0"}},
+		"node_modules/foo": map[string]interface{}{"version": "1.0.0"},
+		"node_modules/bar": map[string]interface{}{"version": "1.0.0", "dev": true},
+	})
+	contents, err := ioutil.ReadFile(lockfile)
+	test.Assert(err, nil)
+
+	// packages left in node_modules are not trusted, even with the right name
+	writeJSON(test, path.Join(app, "node_modules", "foo", "package.json"), `{"name": "foo", "version": "0.9.0"}`)
+	writeJSON(test, path.Join(app, "node_modules", "stale", "package.json"), `{"name": "stale", "version": "1.0.0"}`)
+
+	err = lib.CICmdRun(args)
+	test.Assert(err, nil)
+
+	for name, version := range map[string]string{"foo": "1.0.0", "bar": "1.0.0"} {
+		pkg, err := lib.LoadPackageFromDir(path.Join(app, "node_modules", name))
+		test.Assert(err, nil, name)
+		test.Assert(pkg.Version, version, name)
+	}
+	test.Assert(test.IsFile(path.Join(app, "node_modules", "stale", "package.json")), false)
+	test.Assert(test.IsFile(path.Join(app, "npm-shrinkwrap.json")), false)
+
+	after, err := ioutil.ReadFile(lockfile)
+	test.Assert(err, nil)
+	test.Assert(string(after), string(contents))
+
+	// the lockfile is left as it is whatever the other arguments
+	for _, extra := range [][]string{{"-save=true", "-save-package-lock"}, {"foo"}, {"-shrinkwrap=false"}} {
+		err = lib.CICmdRun(append(append([]string{}, args...), extra...))
+		test.Assert(err, nil, extra)
+		after, err = ioutil.ReadFile(lockfile)
+		test.Assert(err, nil)
+		test.Assert(string(after), string(contents), extra)
+		test.Assert(test.IsFile(path.Join(app, "npm-shrinkwrap.json")), false, extra)
+	}
+
+	// cached packages which do not match the integrity of the lockfile are
+	// downloaded again
+	integrity := reg.Manifests["foo"]["1.0.0"]["dist"].(map[string]interface{})["integrity"]
+	writeJSON(test, path.Join(home, "cache", "modules", "foo", "1.0.0", "package.json"),
+		`{"name": "foo", "version": "1.0.0", "_integrity": "sha512-dGFtcGVyZWQ="}`)
+	err = lib.CICmdRun(args)
+	test.Assert(err, nil)
+	pkg, err := lib.LoadPackageFromDir(path.Join(app, "node_modules", "foo"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Integrity, integrity)
+
+	// every dependency in package.json must be locked at a satisfying version
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.1.0", "baz": "^1.0.0"}, "devDependencies": {"bar": "1.0.0"}}`)
+	err = lib.CICmdRun(args)
+	test.Assert(err != nil, true)
+	test.Assert(strings.Contains(err.Error(), "foo@^1.1.0 is locked at 1.0.0"), true, err)
+	test.Assert(strings.Contains(err.Error(), "baz@^1.0.0 is missing"), true, err)
+
+	// packages which fail to install fail the run, --force or not
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0"}, "devDependencies": {"bar": "1.0.0"}}`)
+	delete(reg.Tarballs, reg.TarballPrefix+"/foo/-/foo-1.0.0.tgz")
+	err = lib.CICmdRun([]string{"-C", app, "-frosty-home", path.Join(dir, "empty-home"), "-registry", reg.URL, "-force"})
+	test.Assert(err != nil, true)
+}
+
+func TestCITamperedTarball(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	app := path.Join(dir, "app")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0"}}`)
+	writePackageLock(test, path.Join(app, "package-lock.json"), reg, 3, map[string]map[string]interface{}{
+		"":                 map[string]interface{}{"name": "app", "version": "1.0.0", "dependencies": map[string]string{"foo": "^1.0.0"}},
+		"node_modules/foo": map[string]interface{}{"version": "1.0.0"},
+	})
+
+	// the tarball is fetched by its resolved URL, so only the lockfile knows
+	// what it should contain
+	reg.Tamper("foo", "1.0.0")
+
+	err := lib.CICmdRun([]string{"-C", app, "-frosty-home", path.Join(dir, "home"), "-registry", reg.URL})
+	integrityErr, ok := err.(*lib.IntegrityError)
+	test.Assert(ok, true, err)
+	test.Assert(integrityErr.URL, reg.URL+"/files/foo/-/foo-1.0.0.tgz")
+	test.Assert(test.IsFile(path.Join(app, "node_modules", "foo", "package.json")), false)
+	test.Assert(test.IsDir(path.Join(dir, "home", "cache", "modules", "foo")), false)
+}
@@ -0,0 +1,209 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestScopedRegistryInstall(t *testing.T) {
+	test := testutil.New(t)
+
+	public := newFakeRegistry()
+	defer public.Close()
+	public.Publish("foo", "1.0.0", nil)
+
+	internal := newFakeRegistry()
+	defer internal.Close()
+	internal.Publish("@ourco/lib", "2.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NETRC":                   path.Join(dir, "none"),
+		"NPM_TOKEN":               "",
+		"NPM_REGISTRY_URL":        "",
+		"INTERNAL_TOKEN":          "internal-secret",
+	})
+	defer restore()
+
+	app := path.Join(dir, "app")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0", "@ourco/lib": "^2.0.0"}}`)
+	err := ioutil.WriteFile(path.Join(app, ".npmrc"), []byte(
+		"registry="+public.URL+"/\n"+
+			"@ourco:registry="+internal.URL+"/\n"+
+			"//"+internal.Listener.Addr().String()+"/:_authToken=${INTERNAL_TOKEN}\n"), os.ModePerm)
+	test.Assert(err, nil)
+
+	err = lib.InstallCmdRun([]string{"-C", app, "-frosty-home", path.Join(dir, "home"), "-package"})
+	test.Assert(err, nil)
+
+	pkg, err := lib.LoadPackageFromDir(path.Join(app, "node_modules", "@ourco", "lib"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "2.0.0")
+	test.Assert(pkg.Resolved, internal.URL+"/files/@ourco/lib/-/lib-2.0.0.tgz")
+
+	pkg, err = lib.LoadPackageFromDir(path.Join(app, "node_modules", "foo"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Resolved, public.URL+"/files/foo/-/foo-1.0.0.tgz")
+
+	// the token is sent to the internal registry only
+	test.Assert(public.HitCount("/@ourco/lib"), 0)
+	test.Assert(internal.Auth["/@ourco/lib"], "Bearer internal-secret")
+	test.Assert(internal.Auth["/files/@ourco/lib/-/lib-2.0.0.tgz"], "Bearer internal-secret")
+	test.Assert(public.Auth["/foo"], "")
+	test.Assert(public.Auth["/files/foo/-/foo-1.0.0.tgz"], "")
+}
+
+func TestCredentialsLookup(t *testing.T) {
+	test := testutil.New(t)
+
+	credentials := lib.NewCredentials()
+	credentials.Add("https://registry.example.com/npm", &lib.Credential{Token: "npm"})
+	credentials.Add("https://registry.example.com/npm/private", &lib.Credential{Token: "private"})
+	credentials.Add("https://files.example.com:8443", &lib.Credential{Basic: "ZmlsZXM="})
+	credentials.Add("https://git.example.com", &lib.Credential{Basic: "Z2l0", AnyPort: true})
+
+	type TableEntry struct {
+		url      string
+		expected string
+	}
+
+	table := []TableEntry{
+		TableEntry{"https://registry.example.com/npm", "Bearer npm"},
+		TableEntry{"https://registry.example.com/npm/foo/-/foo-1.0.0.tgz", "Bearer npm"},
+		TableEntry{"https://registry.example.com:443/npm/foo", "Bearer npm"},
+		TableEntry{"https://registry.example.com:8443/npm/foo", ""},
+		TableEntry{"https://registry.example.com/npm/private/foo", "Bearer private"},
+		TableEntry{"https://registry.example.com/npmx/foo", ""},
+		TableEntry{"https://registry.example.com/other", ""},
+		TableEntry{"https://registry.example.com.evil.com/npm/foo", ""},
+		TableEntry{"https://files.example.com:8443/foo.tgz", "Basic ZmlsZXM="},
+		TableEntry{"https://files.example.com/foo.tgz", ""},
+		TableEntry{"https://files.example.com:9443/foo.tgz", ""},
+		TableEntry{"https://git.example.com:8080/foo.tgz", "Basic Z2l0"},
+		TableEntry{"https://evil.com/?https://registry.example.com/npm", ""},
+	}
+
+	for _, entry := range table {
+		header := ""
+		if cred := credentials.Lookup(entry.url); cred != nil {
+			header = cred.Header()
+		}
+		test.Assert(header, entry.expected, entry.url)
+	}
+
+}
+
+func TestLoadCredentials(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	netrc := path.Join(dir, "netrc")
+	err := ioutil.WriteFile(netrc, []byte("machine git.example.com login alice password s3cret\n"), os.ModePerm)
+	test.Assert(err, nil)
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	writeFiles(test, dir, map[string]string{".npmrc": "always-auth=true\n" +
+		"//registry.example.com/npm/:_authToken=npm\n" +
+		"//files.example.com:8443/:_authToken=files\n" +
+		"//git.example.com/:_authToken=git\n"})
+	npmrc, err := lib.LoadNpmrc(dir, nil)
+	test.Assert(err, nil)
+
+	credentials, err := lib.LoadCredentials(npmrc, netrc)
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		url      string
+		expected string
+	}
+
+	// npmrc keys apply to their own port, or the default one; netrc machines
+	// to any port. always-auth does not extend credentials to other paths.
+	table := []TableEntry{
+		TableEntry{"https://registry.example.com/npm/foo", "Bearer npm"},
+		TableEntry{"https://registry.example.com:4873/npm/foo", ""},
+		TableEntry{"https://registry.example.com/other/foo", ""},
+		TableEntry{"https://files.example.com:8443/foo.tgz", "Bearer files"},
+		TableEntry{"https://files.example.com/foo.tgz", ""},
+		TableEntry{"https://git.example.com/foo.tgz", "Bearer git"},
+		TableEntry{"https://git.example.com:8080/foo.tgz", "Basic YWxpY2U6czNjcmV0"},
+	}
+
+	for _, entry := range table {
+		header := ""
+		if cred := credentials.Lookup(entry.url); cred != nil {
+			header = cred.Header()
+		}
+		test.Assert(header, entry.expected, entry.url)
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	test := testutil.New(t)
+
+	machines := lib.ParseNetrc(`
+# comment
+machine git.example.com login alice password s3cret
+machine Files.Example.com
+  login bob
+  account ignored
+  password hunter2
+
+macdef init
+machine not.a.machine login x password y
+
+default login anon password anon
+`)
+
+	test.Assert(len(machines), 2)
+	test.Assert(machines["git.example.com"], [2]string{"alice", "s3cret"})
+	test.Assert(machines["files.example.com"], [2]string{"bob", "hunter2"})
+}
+
+func TestIsRegistryURL(t *testing.T) {
+	test := testutil.New(t)
+
+	client := lib.NewNpmRegistryClient("https://r.example.com/npm", "")
+	client.Scopes["@foo"] = "https://foo.example.com"
+
+	type TableEntry struct {
+		url      string
+		expected bool
+	}
+
+	table := []TableEntry{
+		TableEntry{"https://r.example.com/npm", true},
+		TableEntry{"https://r.example.com/npm/foo", true},
+		TableEntry{"https://r.example.com/npmfoo", false},
+		TableEntry{"https://rXexample.com/npm/foo", false},
+		TableEntry{"http://r.example.com/npm/foo", false},
+		TableEntry{"https://foo.example.com/@foo/bar", true},
+		TableEntry{"https://evil.com/https://r.example.com/npm", false},
+	}
+
+	for _, entry := range table {
+		test.Assert(client.IsRegistryURL(entry.url), entry.expected, entry.url)
+	}
+
+	test.Assert(client.RegistryFor("@foo/bar"), "https://foo.example.com")
+	test.Assert(client.RegistryFor("@bar/baz"), "https://r.example.com/npm")
+	test.Assert(client.PackumentURL("@foo/bar"), "https://foo.example.com/@foo%2fbar")
+}
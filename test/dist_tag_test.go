@@ -0,0 +1,124 @@
+package test
+
+import (
+	"fmt"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+)
+
+func fakeTagRegistry(hits *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		fmt.Fprint(w, `{
+			"name": "foo",
+			"dist-tags": {"latest": "1.0.0", "next": "2.0.0-beta.1", "beta": "2.0.0-beta.1"},
+			"versions": {"0.9.0": {}, "1.0.0": {}, "2.0.0-beta.1": {}}
+		}`)
+	}))
+}
+
+func TestResolveTag(t *testing.T) {
+	test := testutil.New(t)
+
+	hits := 0
+	server := fakeTagRegistry(&hits)
+	defer server.Close()
+
+	reg := lib.NewNpmRegistryClient(server.URL, "")
+
+	version, err := reg.ResolveTag("foo", "latest")
+	test.Assert(err, nil)
+	test.Assert(version, "1.0.0")
+
+	version, err = reg.ResolveTag("foo", "next")
+	test.Assert(err, nil)
+	test.Assert(version, "2.0.0-beta.1")
+
+	_, err = reg.ResolveTag("foo", "canary")
+	test.Assert(err != nil, true)
+	test.Assert(hits, 3)
+}
+
+func TestResolveTagCached(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	hits := 0
+	server := fakeTagRegistry(&hits)
+	defer server.Close()
+
+	cacheFile := path.Join(dir, "tags.json")
+	reg := lib.NewNpmRegistryClient(server.URL, "")
+	reg.TagCache = lib.LoadTagCache(cacheFile, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		version, err := reg.ResolveTag("foo", "beta")
+		test.Assert(err, nil)
+		test.Assert(version, "2.0.0-beta.1")
+	}
+	test.Assert(hits, 1)
+
+	err := reg.TagCache.Commit()
+	test.Assert(err, nil)
+
+	// resolutions survive a reload
+	reg.TagCache = lib.LoadTagCache(cacheFile, time.Hour)
+	version, err := reg.ResolveTag("foo", "beta")
+	test.Assert(err, nil)
+	test.Assert(version, "2.0.0-beta.1")
+	test.Assert(hits, 1)
+
+	// expired resolutions are fetched again
+	reg.TagCache = lib.LoadTagCache(cacheFile, 0)
+	_, err = reg.ResolveTag("foo", "beta")
+	test.Assert(err, nil)
+	test.Assert(hits, 2)
+}
+
+func TestResolveTagCachedPerRegistry(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	hits := 0
+	server := fakeTagRegistry(&hits)
+	defer server.Close()
+
+	otherHits := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHits++
+		fmt.Fprint(w, `{"name": "foo", "dist-tags": {"beta": "3.0.0-beta.1"}, "versions": {"3.0.0-beta.1": {}}}`)
+	}))
+	defer other.Close()
+
+	tags := lib.LoadTagCache(path.Join(dir, "tags.json"), time.Hour)
+
+	reg := lib.NewNpmRegistryClient(server.URL, "")
+	reg.TagCache = tags
+	version, err := reg.ResolveTag("foo", "beta")
+	test.Assert(err, nil)
+	test.Assert(version, "2.0.0-beta.1")
+
+	// the same tag of another registry is not taken from the cache
+	otherReg := lib.NewNpmRegistryClient(other.URL, "")
+	otherReg.TagCache = tags
+	for i := 0; i < 2; i++ {
+		version, err = otherReg.ResolveTag("foo", "beta")
+		test.Assert(err, nil)
+		test.Assert(version, "3.0.0-beta.1")
+	}
+	test.Assert(otherHits, 1)
+
+	version, err = reg.ResolveTag("foo", "beta")
+	test.Assert(err, nil)
+	test.Assert(version, "2.0.0-beta.1")
+	test.Assert(hits, 1)
+}
@@ -0,0 +1,234 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// fakeRegistry is a minimal npm registry used by tests. Tarballs are served
+// from TarballPrefix, so that tests notice when tarball URLs are synthesized
+// instead of read from the packument.
+type fakeRegistry struct {
+	*httptest.Server
+	TarballPrefix string
+	Manifests     map[string]map[string]map[string]interface{}
+	DistTags      map[string]map[string]string
+	Tarballs      map[string][]byte
+	Hits          map[string]int
+	Auth          map[string]string
+	Accepts       []string
+	NotModified   int
+	Published     map[string]map[string]interface{}
+
+	mu sync.Mutex
+}
+
+func newFakeRegistry() *fakeRegistry {
+	r := newUnstartedFakeRegistry()
+	r.Server.Start()
+	return r
+}
+
+// newFakeTLSRegistry returns a registry served over https, with a self-signed
+// certificate (see Server.Certificate)
+func newFakeTLSRegistry() *fakeRegistry {
+	r := newUnstartedFakeRegistry()
+	r.Server.StartTLS()
+	return r
+}
+
+func newUnstartedFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{
+		TarballPrefix: "/files",
+		Manifests:     make(map[string]map[string]map[string]interface{}),
+		DistTags:      make(map[string]map[string]string),
+		Tarballs:      make(map[string][]byte),
+		Hits:          make(map[string]int),
+		Auth:          make(map[string]string),
+		Published:     make(map[string]map[string]interface{}),
+	}
+	r.Server = httptest.NewUnstartedServer(http.HandlerFunc(r.serveHTTP))
+	return r
+}
+
+// Publish adds a version. Extra manifest fields (ex: dependencies, deprecated)
+// are merged into the generated manifest.
+func (r *fakeRegistry) Publish(name string, version string, extra map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	manifest := map[string]interface{}{"name": name, "version": version}
+	for k, v := range extra {
+		manifest[k] = v
+	}
+
+	pkgJSON, _ := json.Marshal(manifest)
+	tarball := makeTarball(map[string]string{"package/package.json": string(pkgJSON)})
+
+	base := name[strings.LastIndex(name, "/")+1:]
+	tarPath := r.TarballPrefix + "/" + name + "/-/" + base + "-" + version + ".tgz"
+	r.Tarballs[tarPath] = tarball
+
+	sha1sum := sha1.Sum(tarball)
+	sha512sum := sha512.Sum512(tarball)
+	manifest["dist"] = map[string]interface{}{
+		"tarball":   r.URL + tarPath,
+		"shasum":    hex.EncodeToString(sha1sum[:]),
+		"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sha512sum[:]),
+	}
+
+	if r.Manifests[name] == nil {
+		r.Manifests[name] = make(map[string]map[string]interface{})
+		r.DistTags[name] = make(map[string]string)
+	}
+	r.Manifests[name][version] = manifest
+	r.DistTags[name]["latest"] = version
+}
+
+// Tamper replaces the tarball of a version with different contents, leaving
+// the published checksums as they are
+func (r *fakeRegistry) Tamper(name string, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pkgJSON := fmt.Sprintf(`{"name": %q, "version": %q, "scripts": {"tampered": "true"}}`, name, version)
+	base := name[strings.LastIndex(name, "/")+1:]
+	r.Tarballs[r.TarballPrefix+"/"+name+"/-/"+base+"-"+version+".tgz"] =
+		makeTarball(map[string]string{"package/package.json": pkgJSON})
+}
+
+func (r *fakeRegistry) HitCount(p string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Hits[p]
+}
+
+func (r *fakeRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, _ := url.PathUnescape(req.URL.EscapedPath())
+	r.Hits[p]++
+	r.Auth[p] = req.Header.Get("Authorization")
+
+	if req.Method == "PUT" {
+		r.publish(w, req, strings.TrimPrefix(p, "/"))
+		return
+	}
+
+	if tarball, ok := r.Tarballs[p]; ok {
+		w.Write(tarball)
+		return
+	}
+
+	name := strings.TrimPrefix(p, "/")
+	versions, ok := r.Manifests[name]
+	if !ok {
+		http.Error(w, `{"error":"Not found"}`, http.StatusNotFound)
+		return
+	}
+
+	r.Accepts = append(r.Accepts, req.Header.Get("Accept"))
+	body, _ := json.Marshal(map[string]interface{}{
+		"name":      name,
+		"dist-tags": r.DistTags[name],
+		"versions":  versions,
+	})
+
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if req.Header.Get("If-None-Match") == etag {
+		r.NotModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Write(body)
+}
+
+// publish handles the document PUT by npm publish. Authorization is required,
+// and published versions cannot be overwritten.
+func (r *fakeRegistry) publish(w http.ResponseWriter, req *http.Request, name string) {
+	if req.Header.Get("Authorization") == "" {
+		http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	doc := struct {
+		Name        string                            `json:"name"`
+		DistTags    map[string]string                 `json:"dist-tags"`
+		Versions    map[string]map[string]interface{} `json:"versions"`
+		Attachments map[string]struct {
+			Data string `json:"data"`
+		} `json:"_attachments"`
+	}{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if json.Unmarshal(body, &doc) != nil || doc.Name != name {
+		http.Error(w, `{"error":"Bad request"}`, http.StatusBadRequest)
+		return
+	}
+
+	for version := range doc.Versions {
+		if _, ok := r.Manifests[name][version]; ok {
+			http.Error(w, `{"error":"Conflict"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	if r.Manifests[name] == nil {
+		r.Manifests[name] = make(map[string]map[string]interface{})
+		r.DistTags[name] = make(map[string]string)
+	}
+
+	base := name[strings.LastIndex(name, "/")+1:]
+	for version, manifest := range doc.Versions {
+		tarball, _ := base64.StdEncoding.DecodeString(doc.Attachments[name+"-"+version+".tgz"].Data)
+		tarPath := r.TarballPrefix + "/" + name + "/-/" + base + "-" + version + ".tgz"
+		r.Tarballs[tarPath] = tarball
+		manifest["dist"].(map[string]interface{})["tarball"] = r.URL + tarPath
+		r.Manifests[name][version] = manifest
+	}
+	for tag, version := range doc.DistTags {
+		r.DistTags[name][tag] = version
+	}
+
+	published := make(map[string]interface{})
+	json.Unmarshal(body, &published)
+	r.Published[name] = published
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// makeTarball returns gzipped tar archive containing the files
+func makeTarball(files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+		})
+		tw.Write([]byte(contents))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestFallbackRegistryInstall(t *testing.T) {
+	test := testutil.New(t)
+
+	mirror := newFakeRegistry()
+	defer mirror.Close()
+	mirror.Publish("bar", "1.0.0", nil)
+	mirror.Publish("baz", "1.0.0", nil)
+
+	public := newFakeRegistry()
+	defer public.Close()
+	public.Publish("foo", "1.0.0", nil)
+	public.Publish("bar", "1.0.0", nil)
+	public.Publish("bar", "1.1.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	app := path.Join(dir, "app")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0", "bar": "^1.1.0", "baz": "1.0.0"}}`)
+
+	err := lib.InstallCmdRun([]string{"-C", app, "-frosty-home", path.Join(dir, "home"),
+		"-registry", mirror.URL, "-fallback-registry", public.URL, "-package"})
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		name     string
+		version  string
+		registry string
+	}
+
+	// foo is missing from the mirror, and the mirror lags behind for bar
+	table := []TableEntry{
+		TableEntry{"foo", "1.0.0", public.URL},
+		TableEntry{"bar", "1.1.0", public.URL},
+		TableEntry{"baz", "1.0.0", mirror.URL},
+	}
+
+	for _, entry := range table {
+		pkg, err := lib.LoadPackageFromDir(path.Join(app, "node_modules", entry.name))
+		test.Assert(err, nil, entry.name)
+		test.Assert(pkg.Version, entry.version, entry.name)
+		test.Assert(pkg.Registry, entry.registry, entry.name)
+		test.Assert(pkg.Resolved, entry.registry+"/files/"+entry.name+"/-/"+
+			entry.name+"-"+entry.version+".tgz", entry.name)
+	}
+
+	test.Assert(mirror.HitCount("/foo"), 1)
+	test.Assert(public.HitCount("/baz"), 0)
+}
+
+func TestFallbackRegistryUnreachable(t *testing.T) {
+	test := testutil.New(t)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer broken.Close()
+
+	public := newFakeRegistry()
+	defer public.Close()
+	public.Publish("foo", "1.0.0", nil)
+
+	client := lib.NewNpmRegistryClient(down.URL, "")
+	client.Fallbacks = []string{public.URL}
+	client.MinBackoff = time.Millisecond
+	client.MaxBackoff = time.Millisecond
+
+	manifest, err := client.ResolveVersion("foo", "^1.0.0")
+	test.Assert(err, nil)
+	test.Assert(manifest.Registry, public.URL)
+
+	packument, err := client.GetPackument("foo")
+	test.Assert(err, nil)
+	test.Assert(packument.Registry, public.URL)
+
+	// errors other than not found or unreachable are not skipped
+	client = lib.NewNpmRegistryClient(broken.URL, "")
+	client.Fallbacks = []string{public.URL}
+	_, err = client.GetPackument("foo")
+	test.Assert(lib.IsHTTPStatus(err, http.StatusForbidden), true, err)
+
+	// missing everywhere
+	client = lib.NewNpmRegistryClient(public.URL, "")
+	client.Fallbacks = []string{public.URL}
+	_, err = client.GetPackument("nope")
+	test.Assert(lib.IsHTTPStatus(err, http.StatusNotFound), true, err)
+	test.Assert(public.HitCount("/nope"), 2)
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"testing"
+)
+
+func TestParseHostedGit(t *testing.T) {
+	test := testutil.New(t)
+	hosts := lib.NewGitHosts()
+
+	type TableEntry struct {
+		Spec       string
+		Host       string
+		User       string
+		Project    string
+		Committish string
+	}
+	table := []TableEntry{
+		TableEntry{"user/repo", "github", "user", "repo", ""},
+		TableEntry{"user/repo#v1.2.0", "github", "user", "repo", "v1.2.0"},
+		TableEntry{"github:user/repo#v1.2.0", "github", "user", "repo", "v1.2.0"},
+		TableEntry{"github:user/repo.git", "github", "user", "repo", ""},
+		TableEntry{"gitlab:group/proj", "gitlab", "group", "proj", ""},
+		TableEntry{"bitbucket:team/lib#main", "bitbucket", "team", "lib", "main"},
+	}
+
+	for _, entry := range table {
+		hosted, ok := lib.ParseHostedGit(entry.Spec, hosts)
+		test.Assert(ok, true, entry.Spec)
+		if !ok {
+			continue
+		}
+		test.Assert(hosted.Host.Name, entry.Host, entry.Spec)
+		test.Assert(hosted.User, entry.User, entry.Spec)
+		test.Assert(hosted.Project, entry.Project, entry.Spec)
+		test.Assert(hosted.Committish, entry.Committish, entry.Spec)
+	}
+
+	invalid := []string{
+		"1.0.0",
+		"^1.0.0",
+		"@scope/pkg",
+		"file:../lib",
+		"./lib",
+		"https://example.com/foo.tgz",
+		"git+ssh://git@github.com/user/repo.git",
+		"unknown:user/repo",
+		"github:-x/y",
+		"-x/y#main",
+		"github:user/repo#--orphan",
+	}
+
+	for _, spec := range invalid {
+		_, ok := lib.ParseHostedGit(spec, hosts)
+		test.Assert(ok, false, spec)
+	}
+}
+
+func TestHostedGitURLs(t *testing.T) {
+	test := testutil.New(t)
+	hosts := map[string]*lib.GitHost{
+		"github":    &lib.GitHost{Name: "github", BaseURL: "https://ghe.example.com/"},
+		"gitlab":    &lib.GitHost{Name: "gitlab", BaseURL: "https://gitlab.com"},
+		"bitbucket": &lib.GitHost{Name: "bitbucket", BaseURL: "https://bitbucket.org"},
+	}
+
+	table := map[string]string{
+		"user/repo#v1.2.0":  "https://ghe.example.com/user/repo/archive/v1.2.0.tar.gz",
+		"github:user/repo":  "https://ghe.example.com/user/repo/archive/HEAD.tar.gz",
+		"gitlab:group/proj": "https://gitlab.com/group/proj/-/archive/HEAD/proj-HEAD.tar.gz",
+		"bitbucket:u/r#abc": "https://bitbucket.org/u/r/get/abc.tar.gz",
+	}
+
+	for spec, expected := range table {
+		hosted, ok := lib.ParseHostedGit(spec, hosts)
+		test.Assert(ok, true, spec)
+		test.Assert(hosted.TarballURL(), expected, spec)
+	}
+
+	hosted, _ := lib.ParseHostedGit("user/repo", hosts)
+	test.Assert(hosted.GitURL(), "git@ghe.example.com:user/repo.git")
+}
@@ -0,0 +1,230 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer responds with the given status codes in order, then 200 OK
+func flakyServer(header http.Header, codes ...int) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&hits, 1))
+		if n <= len(codes) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(codes[n-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return server, &hits
+}
+
+func newRetryClient(url string, retries int) *lib.NpmRegistryClient {
+	client := lib.NewNpmRegistryClient(url, "")
+	client.Retries = retries
+	client.MinBackoff = time.Millisecond
+	client.MaxBackoff = 5 * time.Millisecond
+	return client
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	test := testutil.New(t)
+
+	type TableEntry struct {
+		codes    []int
+		header   http.Header
+		retries  int
+		status   int
+		attempts int32
+	}
+
+	table := []TableEntry{
+		TableEntry{[]int{503, 502}, nil, 3, 0, 3},
+		TableEntry{[]int{429}, http.Header{"Retry-After": {"0"}}, 3, 0, 2},
+		TableEntry{[]int{500, 500, 500}, nil, 2, 500, 3},
+		TableEntry{[]int{404}, nil, 3, 404, 1},
+		TableEntry{[]int{403}, nil, 3, 403, 1},
+	}
+
+	for _, entry := range table {
+		server, hits := flakyServer(entry.header, entry.codes...)
+		client := newRetryClient(server.URL, entry.retries)
+
+		res, err := client.Get(server.URL + "/foo")
+		test.Assert(atomic.LoadInt32(hits), entry.attempts, entry.codes)
+
+		if entry.status == 0 {
+			test.Assert(err, nil, entry.codes)
+			test.Assert(res.StatusCode, 200, entry.codes)
+			res.Body.Close()
+		} else {
+			httpErr, ok := err.(*lib.HTTPError)
+			test.Assert(ok, true, entry.codes)
+			test.Assert(httpErr.StatusCode, entry.status, entry.codes)
+			test.Assert(httpErr.Attempts, int(entry.attempts), entry.codes)
+			test.Assert(strings.Contains(err.Error(), server.URL+"/foo"), true, err.Error())
+			test.Assert(lib.IsHTTPStatus(err, entry.status), true, entry.codes)
+		}
+
+		server.Close()
+	}
+}
+
+func TestHTTPClientNetworkError(t *testing.T) {
+	test := testutil.New(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	client := newRetryClient(url, 2)
+	_, err := client.Get(url + "/foo")
+
+	httpErr, ok := err.(*lib.HTTPError)
+	test.Assert(ok, true, err)
+	test.Assert(httpErr.Attempts, 3)
+	test.Assert(httpErr.StatusCode, 0)
+	test.Assert(httpErr.Err != nil, true)
+	test.Assert(strings.Contains(err.Error(), "after 3 attempts"), true, err.Error())
+}
+
+func TestHTTPClientStalledBody(t *testing.T) {
+	test := testutil.New(t)
+
+	// the first response stalls halfway, and is retried; the second one is
+	// slow, but never idle for longer than the read timeout
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		for _, part := range []string{"o", "k"} {
+			w.Write([]byte(part))
+			w.(http.Flusher).Flush()
+			if n == 1 {
+				time.Sleep(500 * time.Millisecond)
+				return
+			}
+			time.Sleep(60 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := newRetryClient(server.URL, 1)
+	client.ReadTimeout = 100 * time.Millisecond
+
+	// bodies are streamed, the response comes before the whole body
+	body := ""
+	err := client.Download(server.URL+"/foo", nil, func(res *http.Response) error {
+		contents, err := ioutil.ReadAll(res.Body)
+		body = string(contents)
+		return err
+	})
+	test.Assert(err, nil)
+	test.Assert(body, "ok")
+	test.Assert(atomic.LoadInt32(&hits), int32(2))
+
+	atomic.StoreInt32(&hits, 0)
+	client.Retries = 0
+	err = client.Download(server.URL+"/foo", nil, func(res *http.Response) error {
+		_, err := ioutil.ReadAll(res.Body)
+		return err
+	})
+	httpErr, ok := err.(*lib.HTTPError)
+	test.Assert(ok, true, err)
+	if ok {
+		_, ok = httpErr.Err.(*lib.ReadTimeoutError)
+		test.Assert(ok, true, httpErr.Err)
+	}
+}
+
+func TestHTTPClientStreamsBody(t *testing.T) {
+	test := testutil.New(t)
+
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("o"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("k"))
+	}))
+	defer server.Close()
+
+	// the response is returned before the server sends the rest of the body
+	client := newRetryClient(server.URL, 0)
+	res, err := client.Get(server.URL + "/foo")
+	test.Assert(err, nil)
+	close(release)
+
+	body, err := ioutil.ReadAll(res.Body)
+	test.Assert(err, nil)
+	test.Assert(string(body), "ok")
+	res.Body.Close()
+}
+
+func TestHTTPClientDoesNotRepeatRequestBody(t *testing.T) {
+	test := testutil.New(t)
+
+	// the registry may have handled a request with a body before failing, so
+	// sending it again could publish twice
+	server, hits := flakyServer(nil, 502, 502)
+	defer server.Close()
+
+	client := newRetryClient(server.URL, 3)
+	res, err := client.RequestWithBody("PUT", server.URL+"/foo", nil, []byte("{}"))
+	test.Assert(err, nil)
+	test.Assert(res.StatusCode, 502)
+	test.Assert(atomic.LoadInt32(hits), int32(1))
+	res.Body.Close()
+
+	// requests which never reached the registry are sent again
+	closed := httptest.NewServer(http.NotFoundHandler())
+	url := closed.URL
+	closed.Close()
+
+	_, err = newRetryClient(url, 2).RequestWithBody("PUT", url+"/foo", nil, []byte("{}"))
+	httpErr, ok := err.(*lib.HTTPError)
+	test.Assert(ok, true, err)
+	if ok {
+		test.Assert(httpErr.Attempts, 3)
+	}
+}
+
+func TestHTTPClientDedupesPackumentFetches(t *testing.T) {
+	test := testutil.New(t)
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"name":"foo","dist-tags":{"latest":"1.0.0"},"versions":{"1.0.0":{}}}`))
+	}))
+	defer server.Close()
+
+	client := newRetryClient(server.URL, 0)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = client.GetPackument("foo")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		test.Assert(err, nil)
+	}
+	test.Assert(atomic.LoadInt32(&hits), int32(1))
+}
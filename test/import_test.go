@@ -0,0 +1,106 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const importYarnLock = `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@scope/a@^1.0.0":
+  version "1.0.0"
+  resolved "https://registry.yarnpkg.com/@scope/a/-/a-1.0.0.tgz#0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"
+  dependencies:
+    foo "^2.0.0"
+    shared "^1.0.0"
+
+"baz@npm:shared@^1.0.0", shared@^1.0.0:
+  version "1.1.0"
+  resolved "https://registry.yarnpkg.com/shared/-/shared-1.1.0.tgz"
+  integrity sha512-shared==
+
+foo@^1.0.0, foo@~1.0.0:
+  version "1.0.3"
+  resolved "https://registry.yarnpkg.com/foo/-/foo-1.0.3.tgz"
+  integrity sha512-foo1==
+
+foo@^2.0.0:
+  version "2.0.0"
+  resolved "https://registry.yarnpkg.com/foo/-/foo-2.0.0.tgz"
+  integrity sha512-foo2==
+`
+
+func TestImportLockfiles(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	writeJSON(test, path.Join(dir, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"@scope/a": "^1.0.0", "foo": "^1.0.0", "baz": "npm:shared@^1.0.0"},
+		"devDependencies": {"foo": "~1.0.0"}}`)
+	test.Assert(ioutil.WriteFile(path.Join(dir, "yarn.lock"), []byte(importYarnLock), 0644), nil)
+
+	err := lib.ImportCmdRun([]string{"-C", dir, "-from", "yarn.lock", "-to", "npm-shrinkwrap.json", "-lockfile-version", "3"})
+	test.Assert(err, nil)
+
+	graph, version, err := lib.LoadLockfile(path.Join(dir, "npm-shrinkwrap.json"))
+	test.Assert(err, nil)
+	test.Assert(version, 3)
+
+	type TableEntry struct {
+		path      string
+		name      string
+		version   string
+		resolved  string
+		integrity string
+	}
+
+	table := []TableEntry{
+		TableEntry{"node_modules/@scope/a", "@scope/a", "1.0.0",
+			"https://registry.yarnpkg.com/@scope/a/-/a-1.0.0.tgz", "sha1-C+7Hteo/D9vJXQ3UfzxbwnXaijM="},
+		TableEntry{"node_modules/@scope/a/node_modules/foo", "foo", "2.0.0",
+			"https://registry.yarnpkg.com/foo/-/foo-2.0.0.tgz", "sha512-foo2=="},
+		TableEntry{"node_modules/baz", "shared", "1.1.0",
+			"https://registry.yarnpkg.com/shared/-/shared-1.1.0.tgz", "sha512-shared=="},
+		TableEntry{"node_modules/foo", "foo", "1.0.3",
+			"https://registry.yarnpkg.com/foo/-/foo-1.0.3.tgz", "sha512-foo1=="},
+		TableEntry{"node_modules/shared", "shared", "1.1.0",
+			"https://registry.yarnpkg.com/shared/-/shared-1.1.0.tgz", "sha512-shared=="},
+	}
+
+	test.Assert(len(graph.Packages), len(table)+1, graph.SortedPaths())
+	for _, entry := range table {
+		node := graph.Packages[entry.path]
+		test.Assert(node != nil, true, entry.path)
+		test.Assert(node.Name, entry.name, entry.path)
+		test.Assert(node.Version, entry.version, entry.path)
+		test.Assert(node.Resolved, entry.resolved, entry.path)
+		test.Assert(node.Integrity, entry.integrity, entry.path)
+	}
+
+	// and back again, from a lockfile with a different layout format
+	err = lib.ImportCmdRun([]string{"-C", dir, "-from", "npm-shrinkwrap.json", "-to", "package-lock.json", "-lockfile-version", "1"})
+	test.Assert(err, nil)
+	test.Assert(os.Remove(path.Join(dir, "yarn.lock")), nil)
+	err = lib.ImportCmdRun([]string{"-C", dir, "-from", "package-lock.json", "-to", "yarn.lock"})
+	test.Assert(err, nil)
+
+	contents, err := ioutil.ReadFile(path.Join(dir, "yarn.lock"))
+	test.Assert(err, nil)
+	test.Assert(string(contents), importYarnLock)
+
+	// the target format must be known, and yarn.lock must be up to date
+	err = lib.ImportCmdRun([]string{"-C", dir, "-from", "yarn.lock", "-to", "yarn.lock"})
+	test.Assert(err != nil, true)
+	writeJSON(test, path.Join(dir, "package.json"), `{"name": "app", "dependencies": {"foo": "^3.0.0"}}`)
+	err = lib.ImportCmdRun([]string{"-C", dir, "-from", "yarn.lock", "-to", "npm-shrinkwrap.json"})
+	test.Assert(err != nil && strings.Contains(err.Error(), "foo@^3.0.0"), true, err)
+}
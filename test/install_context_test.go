@@ -23,3 +23,35 @@ func TestInstallContext(t *testing.T) {
 	test.Assert(len(m.CacheKeys), 3)
 	test.Assert(len(m.InstallDirs), 2)
 }
+
+func TestInstallContextDeprecations(t *testing.T) {
+	test := testutil.New(t)
+
+	ictx := lib.NewInstallContext()
+	ictx.AddDeprecated("foo", "1.0.0", "use bar", "/app/node_modules/foo")
+	ictx.AddDeprecated("foo", "1.0.0", "use bar", "/app/node_modules/baz/node_modules/foo")
+	ictx.AddDeprecated("foo", "1.0.0", "use bar", "/app/node_modules/foo")
+	ictx.AddDeprecated("@scope/bar", "2.0.0", "old", "/app/packages/a/node_modules/@scope/bar")
+
+	deprecations := ictx.SortedDeprecations()
+	test.Assert(len(deprecations), 2)
+	test.Assert(deprecations[0].Name, "@scope/bar")
+	test.Assert(deprecations[1].Message, "use bar")
+	test.Assert(len(deprecations[1].InstallDirs), 2)
+
+	type TableEntry struct {
+		installDir string
+		expected   string
+	}
+
+	table := []TableEntry{
+		TableEntry{"/app/node_modules/foo", "foo"},
+		TableEntry{"/app/node_modules/baz/node_modules/foo", "baz > foo"},
+		TableEntry{"/app/node_modules/@scope/bar/node_modules/foo", "@scope/bar > foo"},
+		TableEntry{"/app/packages/a/node_modules/@scope/bar", "packages/a > @scope/bar"},
+	}
+
+	for _, entry := range table {
+		test.Assert(lib.TreePath("/app", entry.installDir), entry.expected, entry.installDir)
+	}
+}
@@ -1,7 +1,134 @@
 package test
 
-// import (
-// 	"github.com/sethmcl/frosty2/install"
-// 	"github.com/sethmcl/frosty2/test/testutil"
-// 	"testing"
-// )
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// makeGitRepo commits files to a new git repository in dir, and returns the
+// sha of the commit
+func makeGitRepo(test *testutil.TestUtil, dir string, files map[string]string) string {
+	writeFiles(test, dir, files)
+
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir,
+			"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		test.Assert(err, nil, args, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	run("init", "--quiet")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "init")
+	return run("rev-parse", "HEAD")
+}
+
+func TestInstallGitAndRegistrySameVersion(t *testing.T) {
+	test := testutil.New(t)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	// the git repository has the version published to the registry, with
+	// different contents
+	sha := makeGitRepo(test, path.Join(dir, "repo"), map[string]string{
+		"package.json": `{"name": "foo", "version": "1.0.0"}`,
+		"git.txt":      "from git",
+	})
+
+	home := path.Join(dir, "home")
+	install := func(app string, spec string) {
+		writeJSON(test, path.Join(dir, app, "package.json"),
+			`{"name": "`+app+`", "version": "1.0.0", "dependencies": {"foo": "`+spec+`"}}`)
+		err := lib.InstallCmdRun([]string{"-C", path.Join(dir, app), "-frosty-home", home,
+			"-registry", reg.URL, "-package"})
+		test.Assert(err, nil, app)
+	}
+
+	// second installs come from the cache
+	gitSpec := "git+file://" + path.Join(dir, "repo") + "#" + sha
+	install("registry-app", "1.0.0")
+	install("git-app", gitSpec)
+	install("git-app-2", gitSpec)
+	install("registry-app-2", "1.0.0")
+
+	type TableEntry struct {
+		app     string
+		fromGit bool
+	}
+
+	table := []TableEntry{
+		TableEntry{"registry-app", false},
+		TableEntry{"git-app", true},
+		TableEntry{"git-app-2", true},
+		TableEntry{"registry-app-2", false},
+	}
+
+	for _, entry := range table {
+		test.Assert(test.IsFile(path.Join(dir, entry.app, "node_modules", "foo", "git.txt")), entry.fromGit, entry.app)
+	}
+}
+
+func TestGitCloneRejectsOptions(t *testing.T) {
+	test := testutil.New(t)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	repo := path.Join(dir, "repo")
+	makeGitRepo(test, repo, map[string]string{"package.json": `{"name": "foo", "version": "1.0.0"}`})
+
+	// refs and urls which look like options are never read as options
+	err := lib.GitClone(repo, "--orphan", path.Join(dir, "a"))
+	test.Assert(err != nil, true)
+	err = lib.GitClone("--upload-pack=touch "+path.Join(dir, "pwned"), "HEAD", path.Join(dir, "b"))
+	test.Assert(err != nil, true)
+	test.Assert(test.IsFile(path.Join(dir, "pwned")), false)
+
+	// branches, which are only on origin after the clone, still resolve
+	cmd := exec.Command("git", "-C", repo, "branch", "other")
+	test.Assert(cmd.Run(), nil)
+	for _, ref := range []string{"HEAD", "other"} {
+		err = lib.GitClone(repo, ref, path.Join(dir, ref))
+		test.Assert(err, nil, ref)
+		test.Assert(test.IsFile(path.Join(dir, ref, "package.json")), true, ref)
+	}
+}
+
+func TestInstallNestedLocalPaths(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	// a declares b relative to its own directory, not to the app
+	writeJSON(test, path.Join(dir, "app", "package.json"),
+		`{"name": "app", "version": "1.0.0", "dependencies": {"a": "file:../libs/a"}}`)
+	writeJSON(test, path.Join(dir, "libs", "a", "package.json"),
+		`{"name": "a", "version": "1.0.0", "dependencies": {"b": "file:../b"}}`)
+	writeJSON(test, path.Join(dir, "libs", "b", "package.json"), `{"name": "b", "version": "1.0.0"}`)
+
+	err := lib.InstallCmdRun([]string{"-C", path.Join(dir, "app"), "-frosty-home", path.Join(dir, "home"), "-package"})
+	test.Assert(err, nil)
+
+	pkg, err := lib.LoadPackageFromDir(path.Join(dir, "app", "node_modules", "a", "node_modules", "b"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Name, "b")
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLinkUnlink(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	home := path.Join(dir, "home")
+	libDir := path.Join(dir, "mylib")
+	appDir := path.Join(dir, "app")
+
+	writeJSON(test, path.Join(libDir, "package.json"),
+		`{"name": "mylib", "version": "1.0.0", "bin": {"mylib": "./cli.js"}}`)
+	writeJSON(test, path.Join(libDir, "cli.js"), "")
+	writeJSON(test, path.Join(appDir, "package.json"),
+		`{"name": "app", "version": "1.0.0", "dependencies": {"mylib": "file:../mylib"}}`)
+
+	// register mylib
+	err := lib.LinkCmdRun([]string{"-C", libDir, "-frosty-home", home})
+	test.Assert(err, nil)
+	target, err := os.Readlink(path.Join(lib.GetLinksDir(home), "mylib"))
+	test.Assert(err, nil)
+	test.Assert(target, libDir)
+
+	// link mylib into app
+	err = lib.LinkCmdRun([]string{"-C", appDir, "-frosty-home", home, "mylib"})
+	test.Assert(err, nil)
+	installDir := path.Join(appDir, "node_modules", "mylib")
+	target, err = os.Readlink(installDir)
+	test.Assert(err, nil)
+	test.Assert(target, libDir)
+	target, err = os.Readlink(path.Join(appDir, "node_modules", ".bin", "mylib"))
+	test.Assert(err, nil)
+	test.Assert(target, "../mylib/cli.js")
+
+	err = lib.LinkCmdRun([]string{"-C", appDir, "-frosty-home", home, "missing"})
+	test.Assert(err != nil, true)
+
+	// unlink restores normal install
+	err = lib.UnlinkCmdRun([]string{"-C", appDir, "-frosty-home", home, "mylib"})
+	test.Assert(err, nil)
+	_, err = os.Readlink(installDir)
+	test.Assert(err != nil, true)
+	test.AssertFile(path.Join(installDir, "package.json"))
+	test.AssertFile(path.Join(appDir, "node_modules", ".bin", "mylib"))
+
+	// unregister mylib
+	err = lib.UnlinkCmdRun([]string{"-C", libDir, "-frosty-home", home})
+	test.Assert(err, nil)
+	_, err = os.Lstat(path.Join(lib.GetLinksDir(home), "mylib"))
+	test.Assert(err != nil, true)
+}
+
+func TestUnlinkRestoresCachedDep(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("mylib", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	home := path.Join(dir, "home")
+	libDir := path.Join(dir, "mylib")
+	appDir := path.Join(dir, "app")
+
+	writeJSON(test, path.Join(libDir, "package.json"), `{"name": "mylib", "version": "2.0.0-dev"}`)
+	writeJSON(test, path.Join(appDir, "package.json"),
+		`{"name": "app", "version": "1.0.0", "dependencies": {"mylib": "1.0.0"}}`)
+	writeFiles(test, appDir, map[string]string{".npmrc": "registry=" + reg.URL + "/\n"})
+
+	// the registry version is installed, and cached
+	err := lib.InstallCmdRun([]string{"-C", appDir, "-frosty-home", home, "-package"})
+	test.Assert(err, nil)
+
+	err = lib.LinkCmdRun([]string{"-C", libDir, "-frosty-home", home})
+	test.Assert(err, nil)
+	err = lib.LinkCmdRun([]string{"-C", appDir, "-frosty-home", home, "mylib"})
+	test.Assert(err, nil)
+
+	installDir := path.Join(appDir, "node_modules", "mylib")
+	pkg, err := lib.LoadPackageFromDir(installDir)
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "2.0.0-dev")
+
+	// unlink restores the cached copy, without the registry
+	reg.Close()
+	err = lib.UnlinkCmdRun([]string{"-C", appDir, "-frosty-home", home, "mylib"})
+	test.Assert(err, nil)
+
+	_, err = os.Readlink(installDir)
+	test.Assert(err != nil, true)
+	pkg, err = lib.LoadPackageFromDir(installDir)
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "1.0.0")
+	test.Assert(pkg.Resolved, reg.URL+"/files/mylib/-/mylib-1.0.0.tgz")
+	test.Assert(reg.HitCount("/files/mylib/-/mylib-1.0.0.tgz"), 1)
+
+	// the linked package is left as it was
+	pkg, err = lib.LoadPackageFromDir(libDir)
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "2.0.0-dev")
+}
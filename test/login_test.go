@@ -0,0 +1,236 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAuthServer implements the login, whoami and token endpoints of a registry
+type fakeAuthServer struct {
+	*httptest.Server
+	WebLogin    bool
+	RequireOTP  bool
+	Polls       int
+	Revoked     []string
+	LegacyUsers map[string]string
+
+	mu sync.Mutex
+}
+
+func newFakeAuthServer() *fakeAuthServer {
+	s := &fakeAuthServer{LegacyUsers: map[string]string{"alice": "hunter22"}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *fakeAuthServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSONBody := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/-/v1/login" && s.WebLogin:
+		writeJSONBody(http.StatusOK, map[string]string{
+			"loginUrl": s.URL + "/login/session",
+			"doneUrl":  s.URL + "/done/session",
+		})
+
+	case r.Method == "GET" && r.URL.Path == "/done/session":
+		s.Polls++
+		if s.Polls < 3 {
+			w.Header().Set("Retry-After", "0")
+			writeJSONBody(http.StatusAccepted, map[string]string{})
+			return
+		}
+		writeJSONBody(http.StatusOK, map[string]string{"token": "web-token-1234"})
+
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/-/user/org.couchdb.user:"):
+		user := struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&user)
+
+		if s.LegacyUsers[user.Name] != user.Password {
+			writeJSONBody(http.StatusUnauthorized, map[string]string{"error": "bad password"})
+			return
+		}
+		if s.RequireOTP && r.Header.Get("npm-otp") != "123456" {
+			w.Header().Set("WWW-Authenticate", "OTP")
+			writeJSONBody(http.StatusUnauthorized, map[string]string{"error": "otp required"})
+			return
+		}
+		writeJSONBody(http.StatusCreated, map[string]string{"token": "legacy-token-" + user.Name})
+
+	case r.Method == "GET" && r.URL.Path == "/-/whoami":
+		switch r.Header.Get("Authorization") {
+		case "Bearer web-token-1234":
+			writeJSONBody(http.StatusOK, map[string]string{"username": "webuser"})
+		case "Bearer legacy-token-alice":
+			writeJSONBody(http.StatusOK, map[string]string{"username": "alice"})
+		default:
+			writeJSONBody(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/-/user/token/"):
+		s.Revoked = append(s.Revoked, strings.TrimPrefix(r.URL.Path, "/-/user/token/"))
+		writeJSONBody(http.StatusOK, map[string]string{})
+
+	default:
+		writeJSONBody(http.StatusNotFound, map[string]string{"error": "Not found"})
+	}
+}
+
+func TestLoginWhoamiLogout(t *testing.T) {
+	test := testutil.New(t)
+
+	web := newFakeAuthServer()
+	web.WebLogin = true
+	defer web.Close()
+
+	legacy := newFakeAuthServer()
+	legacy.RequireOTP = true
+	defer legacy.Close()
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	userConfig := path.Join(dir, "home", ".npmrc")
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   userConfig,
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NETRC":                   path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	app := path.Join(dir, "app")
+	test.Assert(os.MkdirAll(app, os.ModePerm), nil)
+	test.Assert(os.MkdirAll(path.Dir(userConfig), os.ModePerm), nil)
+	test.Assert(ioutil.WriteFile(userConfig, []byte("; my settings\nregistry="+web.URL+"/\n"), 0644), nil)
+
+	webNerf := "//" + web.Listener.Addr().String() + "/"
+	legacyNerf := "//" + legacy.Listener.Addr().String() + "/"
+
+	// not logged in yet
+	err := lib.WhoamiCmdRun([]string{"-C", app})
+	test.Assert(err != nil, true)
+
+	// web login polls until the login is complete
+	err = lib.LoginCmdRun([]string{"-C", app})
+	test.Assert(err, nil)
+	test.Assert(web.Polls, 3)
+
+	npmrc, err := lib.LoadNpmrc(app, nil)
+	test.Assert(err, nil)
+	test.Assert(npmrc.Get(webNerf+":_authToken"), "web-token-1234")
+	test.Assert(npmrc.Sources[webNerf+":_authToken"], userConfig)
+
+	info, err := os.Stat(userConfig)
+	test.Assert(err, nil)
+	test.Assert(info.Mode().Perm(), os.FileMode(0600))
+
+	contents, err := ioutil.ReadFile(userConfig)
+	test.Assert(err, nil)
+	test.Assert(strings.HasPrefix(string(contents), "; my settings\nregistry="), true, string(contents))
+
+	// whoami prints the username as is, without a log prefix
+	out, err := captureOutput(func() error { return lib.WhoamiCmdRun([]string{"-C", app}) })
+	test.Assert(err, nil)
+	test.Assert(out, "webuser\n")
+
+	// legacy login for a scope, which needs a one-time password. The password
+	// comes from the env, never from a flag which would show up in ps.
+	restorePassword := setEnv(map[string]string{"NPM_PASSWORD": "hunter22"})
+	defer restorePassword()
+	args := []string{"-C", app, "-scope", "@corp", "-registry", legacy.URL,
+		"-auth-type", "legacy", "-username", "alice"}
+	err = lib.LoginCmdRun(args)
+	test.Assert(err != nil, true)
+	test.Assert(strings.Contains(err.Error(), "one-time password"), true, err)
+
+	err = lib.LoginCmdRun(append(args, "-otp", "123456"))
+	test.Assert(err, nil)
+
+	npmrc, err = lib.LoadNpmrc(app, nil)
+	test.Assert(err, nil)
+	test.Assert(npmrc.Get("@corp:registry"), legacy.URL)
+	test.Assert(npmrc.Get(legacyNerf+":_authToken"), "legacy-token-alice")
+	test.Assert(npmrc.Get(webNerf+":_authToken"), "web-token-1234")
+
+	out, err = captureOutput(func() error { return lib.WhoamiCmdRun([]string{"-C", app, "-scope", "corp"}) })
+	test.Assert(err, nil)
+	test.Assert(out, "alice\n")
+
+	// wrong password
+	os.Setenv("NPM_PASSWORD", "wrong-password")
+	err = lib.LoginCmdRun([]string{"-C", app, "-registry", legacy.URL,
+		"-auth-type", "legacy", "-username", "alice"})
+	test.Assert(err != nil, true)
+	os.Setenv("NPM_PASSWORD", "hunter22")
+
+	// registries without web login fall back to legacy login
+	err = lib.LoginCmdRun([]string{"-C", app, "-scope", "@corp",
+		"-username", "alice", "-otp", "123456"})
+	test.Assert(err, nil)
+
+	// logout revokes the token, and removes it along with the scope registry
+	err = lib.LogoutCmdRun([]string{"-C", app, "-scope", "@corp"})
+	test.Assert(err, nil)
+	test.Assert(strings.Join(legacy.Revoked, " "), "legacy-token-alice")
+
+	npmrc, err = lib.LoadNpmrc(app, nil)
+	test.Assert(err, nil)
+	test.Assert(npmrc.Get("@corp:registry"), "")
+	test.Assert(npmrc.Get(legacyNerf+":_authToken"), "")
+	test.Assert(npmrc.Get(webNerf+":_authToken"), "web-token-1234")
+
+	err = lib.LogoutCmdRun([]string{"-C", app})
+	test.Assert(err, nil)
+	test.Assert(strings.Join(web.Revoked, " "), "web-token-1234")
+
+	contents, err = ioutil.ReadFile(userConfig)
+	test.Assert(err, nil)
+	test.Assert(string(contents), "; my settings\nregistry="+web.URL+"/\n")
+
+	err = lib.LogoutCmdRun([]string{"-C", app})
+	test.Assert(err != nil, true)
+}
+
+func TestUpdateNpmrc(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	file := path.Join(dir, "npmrc")
+	test.Assert(ioutil.WriteFile(file, []byte("# comment\na=1\nb = 2\n\nc=3\n"), 0644), nil)
+
+	err := lib.UpdateNpmrc(file, map[string]string{"b": "20", "c": "", "d": "4", "e": ""})
+	test.Assert(err, nil)
+
+	contents, err := ioutil.ReadFile(file)
+	test.Assert(err, nil)
+	test.Assert(string(contents), "# comment\na=1\nb=20\nd=4\n")
+
+	// missing files are created
+	file = path.Join(dir, "new", "npmrc")
+	test.Assert(lib.UpdateNpmrc(file, map[string]string{"a": "1"}), nil)
+	contents, err = ioutil.ReadFile(file)
+	test.Assert(err, nil)
+	test.Assert(string(contents), "a=1\n")
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// setEnv sets environment variables, and returns a function which restores them
+func setEnv(vars map[string]string) func() {
+	saved := make(map[string]*string)
+	for k, v := range vars {
+		if old, ok := os.LookupEnv(k); ok {
+			saved[k] = &old
+		} else {
+			saved[k] = nil
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+
+	return func() {
+		for k, v := range saved {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestParseNpmrc(t *testing.T) {
+	test := testutil.New(t)
+
+	restore := setEnv(map[string]string{"FROSTY_TEST_TOKEN": "s3cret"})
+	defer restore()
+
+	values, err := lib.ParseNpmrc(`
+; comment
+# another comment
+registry = https://registry.example.com/
+//registry.example.com/:_authToken=${FROSTY_TEST_TOKEN}
+literal = \${FROSTY_TEST_TOKEN}
+@foo:registry="https://foo.example.com/npm/"
+quoted = 'single'
+always-auth
+ca[] = first
+ca[] = second
+`)
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		key      string
+		expected string
+	}
+
+	table := []TableEntry{
+		TableEntry{"registry", "https://registry.example.com/"},
+		TableEntry{"//registry.example.com/:_authToken", "s3cret"},
+		TableEntry{"literal", "${FROSTY_TEST_TOKEN}"},
+		TableEntry{"@foo:registry", "https://foo.example.com/npm/"},
+		TableEntry{"quoted", "single"},
+		TableEntry{"always-auth", "true"},
+		TableEntry{"ca", "first\nsecond"},
+	}
+
+	for _, entry := range table {
+		test.Assert(values[entry.key], entry.expected, entry.key)
+	}
+
+	_, err = lib.ParseNpmrc("token=${FROSTY_TEST_UNSET_VAR}")
+	test.Assert(err != nil, true)
+}
+
+func TestLoadNpmrcPrecedence(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	global := path.Join(dir, "global", "npmrc")
+	user := path.Join(dir, "user", ".npmrc")
+	project := path.Join(dir, "project")
+
+	write := func(file string, contents string) {
+		os.MkdirAll(path.Dir(file), os.ModePerm)
+		test.Assert(ioutil.WriteFile(file, []byte(contents), os.ModePerm), nil)
+	}
+
+	write(global, "registry=https://global.example.com/\nstrict-ssl=false\ncafile=/global/ca.pem\nproxy=http://proxy.global:8080\n")
+	write(user, "registry=https://user.example.com/\n//user.example.com/:_authToken=user-token\n_auth=dXNlcjpwYXNz\n")
+	write(path.Join(project, ".npmrc"), "@foo:registry=https://foo.example.com/npm\n//foo.example.com/npm/:_authToken=foo-token\n")
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_GLOBALCONFIG": global,
+		"NPM_CONFIG_USERCONFIG":   user,
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+		"npm_config_strict_ssl":   "",
+		"npm_config_registry":     "",
+	})
+	defer restore()
+
+	npmrc, err := lib.LoadNpmrc(project, nil)
+	test.Assert(err, nil)
+	test.Assert(npmrc.Registry(), "https://user.example.com")
+	test.Assert(npmrc.Sources["registry"], user)
+	test.Assert(npmrc.AuthToken(npmrc.Registry()), "user-token")
+	test.Assert(npmrc.BasicAuth(npmrc.Registry()), "dXNlcjpwYXNz")
+	test.Assert(npmrc.ScopeRegistry("@foo"), "https://foo.example.com/npm")
+	test.Assert(npmrc.ScopeRegistry("@bar"), "https://user.example.com")
+	test.Assert(npmrc.AuthToken("https://foo.example.com/npm/@foo/bar/-/bar-1.0.0.tgz"), "foo-token")
+	test.Assert(npmrc.AuthToken("https://foo.example.com/other"), "")
+	test.Assert(npmrc.BasicAuth("https://foo.example.com/npm"), "")
+
+	config := npmrc.HTTPConfig()
+	test.Assert(config.StrictSSL, false)
+	test.Assert(config.CAFile, "/global/ca.pem")
+	test.Assert(config.Proxy, "http://proxy.global:8080")
+
+	// env vars override npmrc files, and NPM_TOKEN applies to the registry in effect
+	restoreEnv := setEnv(map[string]string{
+		"npm_config_strict_ssl": "true",
+		"NPM_REGISTRY_URL":      "https://env.example.com",
+		"NPM_TOKEN":             "env-token",
+	})
+	npmrc, err = lib.LoadNpmrc(project, nil)
+	test.Assert(err, nil)
+	test.Assert(npmrc.Registry(), "https://env.example.com")
+	test.Assert(npmrc.AuthToken("https://env.example.com"), "env-token")
+	test.Assert(npmrc.AuthToken("https://user.example.com"), "user-token")
+	test.Assert(npmrc.HTTPConfig().StrictSSL, true)
+
+	// flags override everything
+	npmrc, err = lib.LoadNpmrc(project, map[string]string{"registry": "https://flag.example.com/"})
+	test.Assert(err, nil)
+	test.Assert(npmrc.Registry(), "https://flag.example.com")
+	test.Assert(npmrc.Sources["registry"], "flag")
+	test.Assert(npmrc.AuthToken("https://flag.example.com"), "env-token")
+	restoreEnv()
+}
+
+func TestNerfDart(t *testing.T) {
+	test := testutil.New(t)
+
+	test.Assert(lib.NerfDart("https://registry.npmjs.org"), "//registry.npmjs.org/")
+	test.Assert(lib.NerfDart("https://registry.npmjs.org/"), "//registry.npmjs.org/")
+	test.Assert(lib.NerfDart("http://example.com:8080/npm"), "//example.com:8080/npm/")
+}
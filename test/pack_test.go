@@ -0,0 +1,219 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles writes files, relative to dir
+func writeFiles(test *testutil.TestUtil, dir string, files map[string]string) {
+	for name, contents := range files {
+		file := path.Join(dir, name)
+		test.Assert(os.MkdirAll(path.Dir(file), os.ModePerm), nil)
+		test.Assert(ioutil.WriteFile(file, []byte(contents), 0644), nil)
+	}
+}
+
+// tarEntries returns names of the entries of a gzipped tarball, in order
+func tarEntries(test *testutil.TestUtil, data []byte) []string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	test.Assert(err, nil)
+	tr := tar.NewReader(gz)
+
+	names := []string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		test.Assert(err, nil)
+		names = append(names, header.Name)
+	}
+	return names
+}
+
+func TestPackFiles(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	common := map[string]string{
+		"README.md":                     "readme",
+		"LICENSE":                       "license",
+		"index.js":                      "index",
+		"lib/a.js":                      "a",
+		"lib/a.test.js":                 "test",
+		"lib/.npmignore":                "*.test.js\n",
+		"docs/guide.md":                 "guide",
+		"debug.log":                     "log",
+		"package-lock.json":             "{}",
+		".npmrc":                        "//registry/:_authToken=secret",
+		".git/HEAD":                     "ref",
+		"node_modules/dep/package.json": `{"name": "dep", "version": "1.0.0"}`,
+		"node_modules/dep/index.js":     "dep",
+		"node_modules/other/index.js":   "other",
+		"lib/node_modules/x/index.js":   "nested",
+
+		"node_modules/dep/node_modules/sub/index.js": "sub",
+	}
+
+	type TableEntry struct {
+		pkgJSON string
+		extra   map[string]string
+		files   string
+	}
+
+	table := []TableEntry{
+		// everything, minus defaults and nested ignore files
+		TableEntry{`{"name": "foo", "version": "1.0.0"}`, nil,
+			"LICENSE README.md debug.log docs/guide.md index.js lib/a.js package.json"},
+
+		// .npmignore wins over .gitignore
+		TableEntry{`{"name": "foo", "version": "1.0.0"}`,
+			map[string]string{".npmignore": "*.log\n/docs/\n", ".gitignore": "index.js\n"},
+			"LICENSE README.md index.js lib/a.js package.json"},
+
+		TableEntry{`{"name": "foo", "version": "1.0.0"}`,
+			map[string]string{".gitignore": "*.log\ndocs\n"},
+			"LICENSE README.md index.js lib/a.js package.json"},
+
+		// negation, and always included files
+		TableEntry{`{"name": "foo", "version": "1.0.0"}`,
+			map[string]string{".npmignore": "*\n!lib/\n!lib/*.js\n"},
+			"LICENSE README.md lib/a.js package.json"},
+
+		// files lists what is packed; main, package.json, README and LICENSE are
+		// always included
+		TableEntry{`{"name": "foo", "version": "1.0.0", "main": "./index.js", "files": ["lib"]}`,
+			map[string]string{".npmignore": "lib\n"},
+			"LICENSE README.md index.js lib/a.js package.json"},
+
+		TableEntry{`{"name": "foo", "version": "1.0.0", "files": ["lib/*.js", "!lib/a.js", "docs/"]}`, nil,
+			"LICENSE README.md docs/guide.md package.json"},
+
+		// bundled dependencies are packed with node_modules
+		TableEntry{`{"name": "foo", "version": "1.0.0", "files": ["index.js"],
+			"dependencies": {"dep": "1.0.0"}, "bundledDependencies": ["dep"]}`, nil,
+			"LICENSE README.md index.js node_modules/dep/index.js " +
+				"node_modules/dep/node_modules/sub/index.js node_modules/dep/package.json package.json"},
+
+		TableEntry{`{"name": "foo", "version": "1.0.0", "files": ["index.js"],
+			"dependencies": {"dep": "1.0.0"}, "bundleDependencies": true}`, nil,
+			"LICENSE README.md index.js node_modules/dep/index.js " +
+				"node_modules/dep/node_modules/sub/index.js node_modules/dep/package.json package.json"},
+	}
+
+	for i, entry := range table {
+		pkgDir := path.Join(dir, "pkg"+string('a'+rune(i)))
+		writeFiles(test, pkgDir, common)
+		writeFiles(test, pkgDir, entry.extra)
+		writeFiles(test, pkgDir, map[string]string{"package.json": entry.pkgJSON})
+
+		pkg, err := lib.LoadPackageFromDir(pkgDir)
+		test.Assert(err, nil, entry.pkgJSON)
+
+		files, err := lib.PackFiles(pkg)
+		test.Assert(err, nil, entry.pkgJSON)
+		test.Assert(strings.Join(files, " "), entry.files, entry.pkgJSON)
+	}
+
+	// symlinked directories are not followed, symlinked files are packed
+	pkgDir := path.Join(dir, "links")
+	writeFiles(test, pkgDir, map[string]string{
+		"package.json": `{"name": "foo", "version": "1.0.0"}`,
+		"index.js":     "index",
+	})
+	writeFiles(test, path.Join(dir, "outside"), map[string]string{"secret.js": "secret"})
+	test.Assert(os.Symlink("..", path.Join(pkgDir, "loop")), nil)
+	test.Assert(os.Symlink(path.Join(dir, "outside"), path.Join(pkgDir, "outside")), nil)
+	test.Assert(os.Symlink("index.js", path.Join(pkgDir, "alias.js")), nil)
+	test.Assert(os.Symlink("nope.js", path.Join(pkgDir, "dangling.js")), nil)
+
+	pkg, err := lib.LoadPackageFromDir(pkgDir)
+	test.Assert(err, nil)
+	files, err := lib.PackFiles(pkg)
+	test.Assert(err, nil)
+	test.Assert(strings.Join(files, " "), "alias.js index.js package.json")
+
+	// a bundled dependency must be installed
+	pkgDir = path.Join(dir, "missing")
+	writeFiles(test, pkgDir, map[string]string{"package.json": `{"name": "foo", "version": "1.0.0",
+		"bundledDependencies": ["nope"]}`})
+	pkg, err = lib.LoadPackageFromDir(pkgDir)
+	test.Assert(err, nil)
+	_, err = lib.PackFiles(pkg)
+	test.Assert(err != nil, true)
+}
+
+func TestPackCmd(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	pkgDir := path.Join(dir, "pkg")
+	writeFiles(test, pkgDir, map[string]string{
+		"package.json": `{"name": "@scope/foo", "version": "1.2.3", "files": ["dist"],
+			"scripts": {"prepack": "mkdir -p dist && echo built > dist/index.js",
+				"prepare": "echo prepared > dist/prepared.txt",
+				"postpack": "echo packed > postpack.txt"}}`,
+		"src/index.js": "source",
+	})
+
+	out := path.Join(dir, "out")
+	err := lib.PackCmdRun([]string{"-C", pkgDir, "-pack-destination", out})
+	test.Assert(err, nil)
+	test.Assert(test.IsFile(path.Join(pkgDir, "postpack.txt")), true)
+
+	data, err := ioutil.ReadFile(path.Join(out, "scope-foo-1.2.3.tgz"))
+	test.Assert(err, nil)
+	test.Assert(strings.Join(tarEntries(test, data), " "),
+		"package/dist/index.js package/dist/prepared.txt package/package.json")
+
+	// the tarball is the inverse of ExtractTar
+	extracted := path.Join(dir, "extracted")
+	test.Assert(lib.ExtractTar(bytes.NewReader(data), extracted, 1), nil)
+	contents, err := ioutil.ReadFile(path.Join(extracted, "dist", "index.js"))
+	test.Assert(err, nil)
+	test.Assert(string(contents), "built\n")
+	pkg, err := lib.LoadPackageFromDir(extracted)
+	test.Assert(err, nil)
+	test.Assert(pkg.Name, "@scope/foo")
+
+	// repacking gives the same bytes, whatever the mtimes
+	later := time.Now().Add(time.Hour)
+	test.Assert(os.Chtimes(path.Join(pkgDir, "dist", "index.js"), later, later), nil)
+	pkg, err = lib.LoadPackageFromDir(pkgDir)
+	test.Assert(err, nil)
+	tarball, err := lib.PackPackage(pkg)
+	test.Assert(err, nil)
+	test.Assert(bytes.Equal(tarball.Data, data), true)
+	test.Assert(tarball.Filename, "scope-foo-1.2.3.tgz")
+
+	// dry runs and failing scripts do not write the tarball
+	test.Assert(os.Remove(path.Join(out, "scope-foo-1.2.3.tgz")), nil)
+	err = lib.PackCmdRun([]string{"-C", pkgDir, "-pack-destination", out, "-dry-run"})
+	test.Assert(err, nil)
+	test.Assert(test.IsFile(path.Join(out, "scope-foo-1.2.3.tgz")), false)
+
+	writeFiles(test, pkgDir, map[string]string{
+		"package.json": `{"name": "foo", "version": "1.0.0", "scripts": {"prepack": "exit 1"}}`,
+	})
+	err = lib.PackCmdRun([]string{"-C", pkgDir, "-pack-destination", out})
+	test.Assert(err != nil, true)
+	test.Assert(test.IsFile(path.Join(out, "foo-1.0.0.tgz")), false)
+	err = lib.PackCmdRun([]string{"-C", pkgDir, "-pack-destination", out, "-ignore-scripts"})
+	test.Assert(err, nil)
+	test.Assert(test.IsFile(path.Join(out, "foo-1.0.0.tgz")), true)
+}
@@ -0,0 +1,272 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadLockfileV1(t *testing.T) {
+	test := testutil.New(t)
+
+	graph, version, err := lib.LoadLockfile(test.DataPath("npm-shrinkwrap-2.11.3.json"))
+	test.Assert(err, nil)
+	test.Assert(version, 1)
+	test.Assert(graph.Root().Name, "project")
+
+	type TableEntry struct {
+		path     string
+		version  string
+		resolved string
+	}
+
+	table := []TableEntry{
+		TableEntry{"node_modules/lib", "1.0.0", "file:../lib"},
+		TableEntry{"node_modules/lib/node_modules/small-uuid", "1.0.1",
+			"https://registry.npmjs.org/small-uuid/-/small-uuid-1.0.1.tgz"},
+		TableEntry{"node_modules/lib/node_modules/small-uuid/node_modules/node-uuid", "1.4.7",
+			"https://registry.npmjs.org/node-uuid/-/node-uuid-1.4.7.tgz"},
+		TableEntry{"node_modules/reference-node-module", "1.0.0",
+			"git+https://github.com/sethmcl/reference-node-module.git#b56b83ed395074afc90493dbc376a5fdb50964bf"},
+	}
+
+	for _, entry := range table {
+		node := graph.Packages[entry.path]
+		test.Assert(node != nil, true, entry.path)
+		test.Assert(node.Version, entry.version, entry.path)
+		test.Assert(node.Resolved, entry.resolved, entry.path)
+	}
+}
+
+// writePackageLock writes a lockfile with a packages map for the fake registry
+func writePackageLock(test *testutil.TestUtil, file string, reg *fakeRegistry, version int, packages map[string]map[string]interface{}) {
+	for p, entry := range packages {
+		name, _ := entry["name"].(string)
+		if name == "" {
+			name = lib.LockPathName(p)
+		}
+		ver, _ := entry["version"].(string)
+		if dist, ok := reg.Manifests[name][ver]["dist"].(map[string]interface{}); ok && strings.Contains(p, "node_modules/") {
+			entry["resolved"] = dist["tarball"]
+			entry["integrity"] = dist["integrity"]
+		}
+	}
+
+	bytes, err := json.Marshal(map[string]interface{}{
+		"name":            "app",
+		"version":         "1.0.0",
+		"lockfileVersion": version,
+		"packages":        packages,
+	})
+	test.Assert(err, nil)
+	writeJSON(test, file, string(bytes))
+}
+
+func TestInstallFromPackageLock(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+	reg.Publish("foo", "2.0.0", nil)
+	reg.Publish("bar", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	app := path.Join(dir, "app")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"workspaces": ["packages/*"], "dependencies": {"foo": "^1.0.0", "baz": "npm:bar@1"}}`)
+	writeJSON(test, path.Join(app, "packages", "ws", "package.json"),
+		`{"name": "ws", "version": "0.1.0", "dependencies": {"foo": "^2.0.0", "bar": "^1.0.0"}}`)
+
+	// the layout is not what frosty would resolve from package.json: bar is
+	// hoisted, and the workspace has its own foo
+	lockfile := path.Join(app, "package-lock.json")
+	writePackageLock(test, lockfile, reg, 3, map[string]map[string]interface{}{
+		"": map[string]interface{}{"name": "app", "version": "1.0.0",
+			"dependencies": map[string]string{"foo": "^1.0.0", "baz": "npm:bar@1"}},
+		"node_modules/foo":             map[string]interface{}{"version": "1.0.0"},
+		"node_modules/bar":             map[string]interface{}{"version": "1.0.0"},
+		"node_modules/baz":             map[string]interface{}{"name": "bar", "version": "1.0.0"},
+		"node_modules/ws":              map[string]interface{}{"resolved": "packages/ws", "link": true},
+		"packages/ws":                  map[string]interface{}{"name": "ws", "version": "0.1.0"},
+		"packages/ws/node_modules/foo": map[string]interface{}{"version": "2.0.0"},
+	})
+
+	err := lib.InstallCmdRun([]string{"-C", app, "-frosty-home", path.Join(dir, "home"), "-registry", reg.URL})
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		path    string
+		name    string
+		version string
+	}
+
+	table := []TableEntry{
+		TableEntry{"node_modules/foo", "foo", "1.0.0"},
+		TableEntry{"node_modules/bar", "bar", "1.0.0"},
+		TableEntry{"node_modules/baz", "bar", "1.0.0"},
+		TableEntry{"node_modules/ws", "ws", "0.1.0"},
+		TableEntry{"packages/ws/node_modules/foo", "foo", "2.0.0"},
+	}
+
+	for _, entry := range table {
+		pkg, err := lib.LoadPackageFromDir(path.Join(app, entry.path))
+		test.Assert(err, nil, entry.path)
+		test.Assert(pkg.Name, entry.name, entry.path)
+		test.Assert(pkg.Version, entry.version, entry.path)
+	}
+
+	info, err := os.Lstat(path.Join(app, "node_modules", "ws"))
+	test.Assert(err, nil)
+	test.Assert(info.Mode()&os.ModeSymlink != 0, true)
+	test.Assert(reg.HitCount("/foo"), 0)
+
+	// the package-lock.json is kept up to date, in its own format, and no
+	// npm-shrinkwrap.json is added next to it
+	test.Assert(test.IsFile(path.Join(app, "npm-shrinkwrap.json")), false)
+	graph, version, err := lib.LoadLockfile(lockfile)
+	test.Assert(err, nil)
+	test.Assert(version, 3)
+	test.Assert(len(graph.Packages), 7, graph.SortedPaths())
+	test.Assert(graph.Packages["packages/ws/node_modules/foo"].Version, "2.0.0")
+	test.Assert(graph.Packages["node_modules/baz"].Name, "bar")
+	test.Assert(graph.Packages["node_modules/ws"].Link, true)
+	test.Assert(graph.Packages["node_modules/ws"].Resolved, "packages/ws")
+
+	contents, err := ioutil.ReadFile(lockfile)
+	test.Assert(err, nil)
+	raw := map[string]interface{}{}
+	test.Assert(json.Unmarshal(contents, &raw), nil)
+	_, hasV1Section := raw["dependencies"]
+	test.Assert(hasV1Section, false)
+
+	// npm-shrinkwrap.json takes precedence
+	test.Assert(lib.FindLockfile(app), lockfile)
+	writeJSON(test, path.Join(app, "npm-shrinkwrap.json"), `{"name": "app", "dependencies": {}}`)
+	test.Assert(lib.FindLockfile(app), path.Join(app, "npm-shrinkwrap.json"))
+}
+
+func TestLockfileRecordsVerifiedIntegrity(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	// the registry only publishes a sha1, which is checked, but the lockfile
+	// records the sha512 computed from the tarball
+	dist := reg.Manifests["foo"]["1.0.0"]["dist"].(map[string]interface{})
+	sha512 := dist["integrity"]
+	sha1, err := hex.DecodeString(dist["shasum"].(string))
+	test.Assert(err, nil)
+	dist["integrity"] = "sha1-" + base64.StdEncoding.EncodeToString(sha1)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	app := path.Join(dir, "app")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0"}}`)
+
+	err = lib.InstallCmdRun([]string{"-C", app, "-frosty-home", path.Join(dir, "home"), "-registry", reg.URL})
+	test.Assert(err, nil)
+
+	graph, _, err := lib.LoadLockfile(lib.FindLockfile(app))
+	test.Assert(err, nil)
+	test.Assert(graph.Packages["node_modules/foo"].Integrity, sha512)
+}
+
+func TestInstallRejectsLockfileOutsideProject(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	table := []map[string]interface{}{
+		map[string]interface{}{"node_modules/../../evil": map[string]interface{}{"name": "foo", "version": "1.0.0"}},
+		map[string]interface{}{"lib/node_modules/foo": map[string]interface{}{"version": "1.0.0"}},
+		map[string]interface{}{"node_modules/foo": map[string]interface{}{"link": true, "resolved": "../../outside"}},
+	}
+
+	for i, entry := range table {
+		app := path.Join(dir, "app", "project", fmt.Sprint(i))
+		writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+			"dependencies": {"foo": "^1.0.0"}}`)
+
+		packages := map[string]map[string]interface{}{
+			"": map[string]interface{}{"name": "app", "version": "1.0.0", "dependencies": map[string]string{"foo": "^1.0.0"}},
+		}
+		for p, node := range entry {
+			packages[p] = node.(map[string]interface{})
+		}
+		writePackageLock(test, path.Join(app, "package-lock.json"), reg, 3, packages)
+
+		for _, run := range []func([]string) error{lib.InstallCmdRun, lib.CICmdRun} {
+			err := run([]string{"-C", app, "-frosty-home", path.Join(dir, "home"), "-registry", reg.URL})
+			test.Assert(err != nil && strings.Contains(err.Error(), "Invalid lockfile entry"), true, entry, err)
+		}
+		test.Assert(test.IsDir(path.Join(dir, "app", "evil")), false, entry)
+		test.Assert(test.IsFile(path.Join(app, "node_modules", "foo", "package.json")), false, entry)
+	}
+}
+
+func TestWriteLockfileVersions(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	graph := lib.NewLockGraph()
+	graph.Packages[""] = &lib.LockNode{Name: "app", Version: "1.0.0",
+		Dependencies: map[string]string{"foo": ">=1.0.0"}}
+	graph.Packages["node_modules/foo"] = &lib.LockNode{Name: "foo", Version: "1.0.0",
+		Resolved: "http://r/foo-1.0.0.tgz", Integrity: "sha512-foo", Dependencies: map[string]string{"bar": "^2.0.0"}}
+	graph.Packages["node_modules/foo/node_modules/bar"] = &lib.LockNode{Name: "bar", Version: "2.0.0",
+		Resolved: "http://r/bar-2.0.0.tgz", Dev: true}
+	graph.Packages["node_modules/git"] = &lib.LockNode{Name: "git",
+		Resolved: "git+https://example.com/git.git#abc123"}
+
+	for _, version := range []int{1, 2, 3} {
+		file := path.Join(dir, "lock.json")
+		test.Assert(lib.WriteLockfile(file, graph, version), nil)
+		test.Assert(lib.LockfileVersionOf(file, 0), version)
+
+		contents, err := ioutil.ReadFile(file)
+		test.Assert(err, nil)
+		test.Assert(strings.Contains(string(contents), `">=1.0.0"`) || version == 1, true, string(contents))
+		test.Assert(strings.Contains(string(contents), `"node_modules/foo"`), version > 1)
+		test.Assert(strings.Contains(string(contents), `"requires": {`), version < 3)
+
+		loaded, loadedVersion, err := lib.LoadLockfile(file)
+		test.Assert(err, nil)
+		test.Assert(loadedVersion, version)
+		test.Assert(loaded.Root().Name, "app")
+
+		for _, p := range graph.SortedPaths()[1:] {
+			expected, actual := graph.Packages[p], loaded.Packages[p]
+			test.Assert(actual != nil, true, version, p)
+			test.Assert(actual.Name, expected.Name, version, p)
+			test.Assert(actual.Version, expected.Version, version, p)
+			test.Assert(actual.Resolved, expected.Resolved, version, p)
+			test.Assert(actual.Integrity, expected.Integrity, version, p)
+			test.Assert(actual.Dev, expected.Dev, version, p)
+		}
+	}
+
+	test.Assert(lib.WriteLockfile(path.Join(dir, "lock.json"), graph, 4) != nil, true)
+	test.Assert(lib.LockfileVersionOf(path.Join(dir, "missing.json"), 2), 2)
+}
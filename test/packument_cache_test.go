@@ -0,0 +1,82 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackumentCache(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("@scope/foo", "1.0.0", nil)
+
+	client := lib.NewNpmRegistryClient(reg.URL, "")
+	client.PackumentCache = lib.NewPackumentCache(dir, time.Hour)
+
+	// first request populates the cache, and asks for the abbreviated document
+	packument, err := client.GetPackument("@scope/foo")
+	test.Assert(err, nil)
+	test.Assert(packument.DistTags["latest"], "1.0.0")
+	test.Assert(reg.HitCount("/@scope/foo"), 1)
+	test.Assert(strings.HasPrefix(reg.Accepts[0], "application/vnd.npm.install-v1+json"), true)
+
+	// fresh entries are used without contacting the registry
+	packument, err = client.GetPackument("@scope/foo")
+	test.Assert(err, nil)
+	test.Assert(packument.DistTags["latest"], "1.0.0")
+	test.Assert(reg.HitCount("/@scope/foo"), 1)
+
+	// stale entries are revalidated
+	client.PackumentCache.MaxAge = 0
+	packument, err = client.GetPackument("@scope/foo")
+	test.Assert(err, nil)
+	test.Assert(len(packument.Versions), 1)
+	test.Assert(reg.HitCount("/@scope/foo"), 2)
+	test.Assert(reg.NotModified, 1)
+
+	// and replaced when the registry has a newer document
+	reg.Publish("@scope/foo", "1.1.0", nil)
+	packument, err = client.GetPackument("@scope/foo")
+	test.Assert(err, nil)
+	test.Assert(packument.DistTags["latest"], "1.1.0")
+	test.Assert(reg.NotModified, 1)
+
+	client.PackumentCache.MaxAge = time.Hour
+	packument, err = client.GetPackument("@scope/foo")
+	test.Assert(err, nil)
+	test.Assert(len(packument.Versions), 2)
+	test.Assert(reg.HitCount("/@scope/foo"), 3)
+
+	// full documents are cached separately
+	_, err = client.GetFullPackument("@scope/foo")
+	test.Assert(err, nil)
+	test.Assert(reg.HitCount("/@scope/foo"), 4)
+	test.Assert(reg.Accepts[len(reg.Accepts)-1], "application/json")
+
+	entry := client.PackumentCache.Get(reg.URL, "@scope/foo", false)
+	test.Assert(entry != nil, true)
+	test.Assert(entry.ETag != "", true)
+}
+
+func TestPackumentCachePath(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	cache := lib.NewPackumentCache(dir, time.Hour)
+	err := cache.Put("https://registry.npmjs.org", "../../escape", false, &lib.PackumentCacheEntry{
+		Packument: []byte(`{}`),
+	})
+	test.Assert(err, nil)
+	test.AssertFile(path.Join(dir, "https_registry.npmjs.org", "escape.json"))
+}
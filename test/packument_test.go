@@ -0,0 +1,168 @@
+package test
+
+import (
+	"bytes"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGetPackument(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", map[string]interface{}{
+		"deprecated":   "use bar instead",
+		"engines":      map[string]interface{}{"node": ">=4"},
+		"os":           []string{"linux", "darwin"},
+		"cpu":          []string{"x64"},
+		"bin":          "./cli.js",
+		"dependencies": map[string]interface{}{"bar": "^2.0.0"},
+	})
+	reg.Publish("foo", "1.1.0", nil)
+
+	client := lib.NewNpmRegistryClient(reg.URL, "")
+	packument, err := client.GetPackument("foo")
+	test.Assert(err, nil)
+	test.Assert(len(packument.Versions), 2)
+	test.Assert(packument.DistTags["latest"], "1.1.0")
+
+	v := packument.Versions["1.0.0"]
+	test.Assert(v.Deprecated, "use bar instead")
+	test.Assert(v.Engines["node"], ">=4")
+	test.Assert(len(v.OS), 2)
+	test.Assert(v.CPU[0], "x64")
+	test.Assert(v.Bin["foo"], "./cli.js")
+	test.Assert(v.Dependencies["bar"], "^2.0.0")
+	test.Assert(v.Dist.Tarball, reg.URL+"/files/foo/-/foo-1.0.0.tgz")
+	test.Assert(len(v.Dist.Shasum), 40)
+	test.Assert(v.Dist.Integrity[:7], "sha512-")
+
+	test.Assert(packument.Versions["1.1.0"].Deprecated, "")
+}
+
+func TestGetTarURLFromPackument(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("@scope/foo", "1.0.0", nil)
+	reg.Publish("@scope/foo", "1.2.0", nil)
+
+	client := lib.NewNpmRegistryClient(reg.URL, "")
+	url, err := client.GetTarURL("@scope/foo", "^1.0.0")
+	test.Assert(err, nil)
+	test.Assert(url, reg.URL+"/files/@scope/foo/-/foo-1.2.0.tgz")
+}
+
+func TestInstallFromRegistryDist(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", map[string]interface{}{
+		"dependencies": map[string]interface{}{"bar": "latest"},
+	})
+	reg.Publish("bar", "2.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+	writeJSON(test, path.Join(dir, "app", "package.json"),
+		`{"name": "app", "version": "1.0.0", "dependencies": {"foo": "^1.0.0"}}`)
+
+	err := lib.InstallCmdRun([]string{"-C", path.Join(dir, "app"),
+		"-frosty-home", path.Join(dir, "home"), "-registry", reg.URL, "-package"})
+	test.Assert(err, nil)
+
+	pkg, err := lib.LoadPackageFromDir(path.Join(dir, "app", "node_modules", "foo"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "1.0.0")
+	test.Assert(pkg.Resolved, reg.URL+"/files/foo/-/foo-1.0.0.tgz")
+	test.Assert(pkg.Integrity[:7], "sha512-")
+
+	pkg, err = lib.LoadPackageFromDir(path.Join(dir, "app", "node_modules", "foo", "node_modules", "bar"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "2.0.0")
+}
+
+func TestInstallVerifiesDist(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+	reg.Publish("bar", "1.0.0", nil)
+	reg.Tamper("foo", "1.0.0")
+	reg.Tamper("bar", "1.0.0")
+
+	// without an integrity, the sha1 shasum is checked
+	delete(reg.Manifests["bar"]["1.0.0"]["dist"].(map[string]interface{}), "integrity")
+
+	for _, name := range []string{"foo", "bar"} {
+		dir, cleanup := test.TempDir()
+		defer cleanup()
+		writeJSON(test, path.Join(dir, "app", "package.json"),
+			`{"name": "app", "version": "1.0.0", "dependencies": {"`+name+`": "^1.0.0"}}`)
+
+		err := lib.InstallCmdRun([]string{"-C", path.Join(dir, "app"),
+			"-frosty-home", path.Join(dir, "home"), "-registry", reg.URL, "-package"})
+		integrityErr, ok := err.(*lib.IntegrityError)
+		test.Assert(ok, true, name, err)
+		test.Assert(integrityErr.URL, reg.URL+"/files/"+name+"/-/"+name+"-1.0.0.tgz")
+		test.Assert(test.IsFile(path.Join(dir, "app", "node_modules", name, "package.json")), false, name)
+	}
+}
+
+func TestInstallReportsDeprecated(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", map[string]interface{}{
+		"dependencies": map[string]interface{}{"bar": "^2.0.0"},
+	})
+	reg.Publish("bar", "2.0.0", map[string]interface{}{"deprecated": "bar is no longer maintained"})
+	reg.Publish("baz", "1.0.0", map[string]interface{}{"deprecated": true})
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	home := path.Join(dir, "home")
+	install := func(app string, args ...string) (string, error) {
+		writeJSON(test, path.Join(app, "package.json"),
+			`{"name": "app", "version": "1.0.0", "dependencies": {"foo": "1.0.0", "bar": "2.0.0", "baz": "1.0.0"}}`)
+
+		buf := &bytes.Buffer{}
+		lib.GetContext().SetLogOutput(buf)
+		defer lib.GetContext().SetLogOutput(os.Stdout)
+
+		err := lib.InstallCmdRun(append([]string{"-C", app, "-frosty-home", home,
+			"-registry", reg.URL, "-package"}, args...))
+		return buf.String(), err
+	}
+
+	expected := []string{
+		"WARN deprecated bar@2.0.0 (bar, foo > bar): bar is no longer maintained",
+		"WARN deprecated baz@1.0.0 (baz): This version has been deprecated",
+	}
+
+	out, err := install(path.Join(dir, "app1"))
+	test.Assert(err, nil)
+	test.Assert(strings.Count(out, "WARN deprecated"), 2, out)
+	for _, line := range expected {
+		test.Assert(strings.Contains(out, line), true, line, out)
+	}
+
+	// deprecations are remembered for packages installed from the cache
+	out, err = install(path.Join(dir, "app2"), "-fail-on-deprecated")
+	test.Assert(err != nil, true)
+	test.Assert(strings.Contains(err.Error(), "2 deprecated packages"), true, err)
+	for _, line := range expected {
+		test.Assert(strings.Contains(out, line), true, line, out)
+	}
+	test.Assert(test.IsFile(path.Join(dir, "app2", "node_modules", "foo", "node_modules", "bar", "package.json")), true)
+}
@@ -0,0 +1,263 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newForwardProxy returns an HTTP proxy which forwards plain http requests,
+// and counts them
+func newForwardProxy() (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		r.RequestURI = ""
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	return server, &hits
+}
+
+// loadTestNpmrc writes a project npmrc and loads it, isolated from the npmrc
+// files and proxy env vars of the machine running the tests
+func loadTestNpmrc(test *testutil.TestUtil, dir string, contents string) *lib.Npmrc {
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"HTTP_PROXY":              "",
+		"HTTPS_PROXY":             "",
+		"NO_PROXY":                "",
+		"http_proxy":              "",
+		"https_proxy":             "",
+		"no_proxy":                "",
+	})
+	defer restore()
+
+	err := ioutil.WriteFile(path.Join(dir, ".npmrc"), []byte(contents), os.ModePerm)
+	test.Assert(err, nil)
+
+	npmrc, err := lib.LoadNpmrc(dir, nil)
+	test.Assert(err, nil)
+	return npmrc
+}
+
+func newConfiguredClient(npmrc *lib.Npmrc) (*lib.NpmRegistryClient, error) {
+	client, err := npmrc.NewRegistryClient(npmrc.HTTPConfig())
+	if err != nil {
+		return nil, err
+	}
+	client.Retries = 0
+	return client, nil
+}
+
+func TestProxy(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	proxy, hits := newForwardProxy()
+	defer proxy.Close()
+
+	type TableEntry struct {
+		npmrc string
+		hits  int32
+	}
+
+	proxyHost := strings.TrimPrefix(proxy.URL, "http://")
+	regURL, _ := url.Parse(reg.URL)
+
+	table := []TableEntry{
+		TableEntry{"proxy=" + proxy.URL, 2},
+		TableEntry{"proxy=" + proxyHost, 2},
+		TableEntry{"https-proxy=" + proxy.URL, 0},
+		TableEntry{"proxy=" + proxy.URL + "\nnoproxy=example.com," + regURL.Hostname(), 0},
+		TableEntry{"proxy=" + proxy.URL + "\nnoproxy=" + regURL.Host, 0},
+		TableEntry{"proxy=" + proxy.URL + "\nnoproxy=127.0.0.0/8", 0},
+		TableEntry{"proxy=" + proxy.URL + "\nnoproxy=" + regURL.Hostname() + ":1", 2},
+	}
+
+	for _, entry := range table {
+		atomic.StoreInt32(hits, 0)
+		npmrc := loadTestNpmrc(test, dir, "registry="+reg.URL+"\n"+entry.npmrc+"\n")
+
+		client, err := newConfiguredClient(npmrc)
+		test.Assert(err, nil, entry.npmrc)
+
+		// both packument and tarball go through the proxy
+		url, err := client.GetTarURL("foo", "1.0.0")
+		test.Assert(err, nil, entry.npmrc)
+		res, err := client.Get(url)
+		test.Assert(err, nil, entry.npmrc)
+		res.Body.Close()
+
+		test.Assert(atomic.LoadInt32(hits), entry.hits, entry.npmrc)
+	}
+}
+
+func TestProxyFromEnv(t *testing.T) {
+	test := testutil.New(t)
+
+	restore := setEnv(map[string]string{
+		"HTTP_PROXY":  "http://env-proxy:3128",
+		"HTTPS_PROXY": "",
+		"https_proxy": "",
+		"NO_PROXY":    ".internal",
+	})
+	defer restore()
+
+	config := lib.DefaultHTTPConfig()
+	test.Assert(config.Proxy, "http://env-proxy:3128")
+	test.Assert(config.NoProxy, ".internal")
+
+	u, _ := url.Parse("https://registry.internal/foo")
+	test.Assert(lib.IsNoProxy(u, config.NoProxy), true)
+	u, _ = url.Parse("https://registry.npmjs.org/foo")
+	test.Assert(lib.IsNoProxy(u, config.NoProxy), false)
+}
+
+func TestCustomCA(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	reg := newFakeTLSRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: reg.Certificate().Raw}))
+	caFile := path.Join(dir, "ca.pem")
+	test.Assert(ioutil.WriteFile(caFile, []byte(caPEM), os.ModePerm), nil)
+	inlineCA := strings.Replace(strings.TrimSpace(caPEM), "\n", "\\n", -1)
+
+	type TableEntry struct {
+		npmrc string
+		ok    bool
+	}
+
+	table := []TableEntry{
+		TableEntry{"", false},
+		TableEntry{"cafile=" + caFile, true},
+		TableEntry{`ca="` + inlineCA + `"`, true},
+		TableEntry{"ca[]=" + inlineCA, true},
+		TableEntry{"strict-ssl=false", true},
+	}
+
+	for _, entry := range table {
+		npmrc := loadTestNpmrc(test, dir, "registry="+reg.URL+"\n"+entry.npmrc+"\n")
+
+		client, err := newConfiguredClient(npmrc)
+		test.Assert(err, nil, entry.npmrc)
+
+		_, err = client.GetPackument("foo")
+		test.Assert(err == nil, entry.ok, entry.npmrc, err)
+	}
+
+	npmrc := loadTestNpmrc(test, dir, "cafile="+path.Join(dir, "missing.pem")+"\n")
+	_, err := newConfiguredClient(npmrc)
+	test.Assert(err != nil, true)
+}
+
+func TestClientCertificate(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	reg := newUnstartedFakeRegistry()
+	reg.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	reg.StartTLS()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	certPEM, keyPEM := makeClientCert(test)
+	certFile := path.Join(dir, "client.crt")
+	keyFile := path.Join(dir, "client.key")
+	test.Assert(ioutil.WriteFile(certFile, certPEM, os.ModePerm), nil)
+	test.Assert(ioutil.WriteFile(keyFile, keyPEM, os.ModePerm), nil)
+
+	inline := func(b []byte) string {
+		return strings.Replace(strings.TrimSpace(string(b)), "\n", "\\n", -1)
+	}
+
+	type TableEntry struct {
+		npmrc string
+		ok    bool
+	}
+
+	table := []TableEntry{
+		TableEntry{"", false},
+		TableEntry{"certfile=" + certFile + "\nkeyfile=" + keyFile, true},
+		TableEntry{`cert="` + inline(certPEM) + `"` + "\n" + `key="` + inline(keyPEM) + `"`, true},
+	}
+
+	for _, entry := range table {
+		npmrc := loadTestNpmrc(test, dir, "registry="+reg.URL+"\nstrict-ssl=false\n"+entry.npmrc+"\n")
+
+		client, err := newConfiguredClient(npmrc)
+		test.Assert(err, nil, entry.npmrc)
+
+		_, err = client.GetPackument("foo")
+		test.Assert(err == nil, entry.ok, entry.npmrc, err)
+	}
+
+	npmrc := loadTestNpmrc(test, dir, "certfile="+certFile+"\n")
+	_, err := newConfiguredClient(npmrc)
+	test.Assert(err != nil, true)
+}
+
+// makeClientCert returns PEM encoded self-signed certificate and key
+func makeClientCert(test *testutil.TestUtil) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.Assert(err, nil)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "frosty-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.Assert(err, nil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	test.Assert(err, nil)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
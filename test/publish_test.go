@@ -0,0 +1,116 @@
+package test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	test := testutil.New(t)
+
+	public := newFakeRegistry()
+	defer public.Close()
+
+	scoped := newFakeRegistry()
+	defer scoped.Close()
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NETRC":                   path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	pkgDir := path.Join(dir, "pkg")
+	writeFiles(test, pkgDir, map[string]string{
+		"package.json": `{"name": "@scope/foo", "version": "1.0.0", "description": "Foo",
+			"_resolved": "http://example.com/stale.tgz"}`,
+		"index.js": "module.exports = 1",
+		".npmrc": "registry=" + public.URL + "\n@scope:registry=" + scoped.URL + "\n" +
+			"//" + scoped.Listener.Addr().String() + "/:_authToken=scoped-token\n",
+	})
+
+	// the scope's registry is published to, with its credentials
+	err := lib.PublishCmdRun([]string{"-C", pkgDir, "-tag", "beta", "-access", "public"})
+	test.Assert(err, nil)
+	test.Assert(scoped.Auth["/@scope/foo"], "Bearer scoped-token")
+	test.Assert(public.HitCount("/@scope/foo"), 0)
+
+	doc := scoped.Published["@scope/foo"]
+	test.Assert(doc["access"], "public")
+	test.Assert(doc["description"], "Foo")
+	test.Assert(doc["dist-tags"].(map[string]interface{})["beta"], "1.0.0")
+	test.Assert(doc["_attachments"].(map[string]interface{})["@scope/foo-1.0.0.tgz"] != nil, true)
+
+	manifest := doc["versions"].(map[string]interface{})["1.0.0"].(map[string]interface{})
+	test.Assert(manifest["_id"], "@scope/foo@1.0.0")
+	test.Assert(manifest["_resolved"], nil)
+
+	// the published version installs like any other
+	client := lib.NewNpmRegistryClient(scoped.URL, "")
+	tag, err := client.ResolveTag("@scope/foo", "beta")
+	test.Assert(err, nil)
+	test.Assert(tag, "1.0.0")
+
+	published, err := client.ResolveVersion("@scope/foo", "1.0.0")
+	test.Assert(err, nil)
+	res, err := client.Get(published.Dist.Tarball)
+	test.Assert(err, nil)
+	tarball, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	test.Assert(err, nil)
+	sum := sha1.Sum(tarball)
+	test.Assert(hex.EncodeToString(sum[:]), published.Dist.Shasum)
+
+	extracted := path.Join(dir, "extracted")
+	test.Assert(lib.ExtractTar(strings.NewReader(string(tarball)), extracted, 1), nil)
+	test.Assert(test.IsFile(path.Join(extracted, "index.js")), true)
+	test.Assert(test.IsFile(path.Join(extracted, ".npmrc")), false)
+
+	// published versions are never overwritten
+	err = lib.PublishCmdRun([]string{"-C", pkgDir})
+	test.Assert(err != nil, true)
+	test.Assert(strings.Contains(err.Error(), "previously published"), true, err)
+
+	// dry runs do not publish
+	hits := scoped.HitCount("/@scope/foo")
+	writeFiles(test, pkgDir, map[string]string{
+		"package.json": `{"name": "@scope/foo", "version": "1.1.0"}`,
+	})
+	err = lib.PublishCmdRun([]string{"-C", pkgDir, "-dry-run"})
+	test.Assert(err, nil)
+	test.Assert(scoped.Manifests["@scope/foo"]["1.1.0"] == nil, true)
+	test.Assert(scoped.HitCount("/@scope/foo"), hits)
+
+	type TableEntry struct {
+		pkgJSON string
+		args    []string
+	}
+
+	// packages which cannot be published
+	table := []TableEntry{
+		TableEntry{`{"name": "bar", "version": "1.0.0"}`, []string{}},
+		TableEntry{`{"name": "@scope/foo", "version": "2.0.0"}`, []string{"-tag", "1.0.0"}},
+		TableEntry{`{"name": "@scope/foo", "version": "2.0.0"}`, []string{"-access", "secret"}},
+		TableEntry{`{"name": "@scope/foo", "version": "2.0.0", "scripts": {"prepublishOnly": "exit 1"}}`, []string{}},
+	}
+
+	for _, entry := range table {
+		writeFiles(test, pkgDir, map[string]string{"package.json": entry.pkgJSON})
+		err = lib.PublishCmdRun(append([]string{"-C", pkgDir}, entry.args...))
+		test.Assert(err != nil, true, entry.pkgJSON, entry.args)
+	}
+	test.Assert(public.HitCount("/bar"), 0)
+	test.Assert(scoped.Manifests["@scope/foo"]["2.0.0"] == nil, true)
+}
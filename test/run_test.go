@@ -0,0 +1,46 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	test := testutil.New(t)
+
+	table := map[string]string{
+		"--grep":       "--grep",
+		"a b":          "'a b'",
+		"it's":         `'it'\''s'`,
+		"":             "''",
+		"$(touch x)":   "'$(touch x)'",
+		"src/**/*.js":  "'src/**/*.js'",
+		"--name=a@1.0": "--name=a@1.0",
+	}
+
+	for raw, expected := range table {
+		test.Assert(lib.ShellQuote(raw), expected, raw)
+	}
+}
+
+func TestRunScriptArgs(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	writeJSON(test, path.Join(dir, "package.json"),
+		`{"name": "app", "version": "1.0.0", "scripts": {"save": "sh ./save.sh"}}`)
+	writeJSON(test, path.Join(dir, "save.sh"), `for a in "$@"; do printf '%s|' "$a"; done > args.txt`)
+
+	err := lib.RunCmdRun([]string{"-C", dir, "save", "--grep", "a b", "it's", "$(touch pwned)"})
+	test.Assert(err, nil)
+
+	args, err := ioutil.ReadFile(path.Join(dir, "args.txt"))
+	test.Assert(err, nil)
+	test.Assert(string(args), "--grep|a b|it's|$(touch pwned)|")
+	test.Assert(test.IsFile(path.Join(dir, "pwned")), false)
+}
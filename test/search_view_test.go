@@ -0,0 +1,189 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// captureOutput runs fn, and returns what it printed for the user
+func captureOutput(fn func() error) (string, error) {
+	ctx := lib.GetContext()
+	buf := &bytes.Buffer{}
+	ctx.Output = buf
+	defer func() {
+		ctx.Output = os.Stdout
+		ctx.SetLogOutput(os.Stdout)
+	}()
+
+	err := fn()
+	return buf.String(), err
+}
+
+func isolateNpmConfig(dir string) func() {
+	return setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NETRC":                   path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+}
+
+func TestSearch(t *testing.T) {
+	test := testutil.New(t)
+
+	queries := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/-/v1/search" {
+			http.NotFound(w, r)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"objects": []interface{}{
+				map[string]interface{}{"package": map[string]interface{}{
+					"name":        "left-pad",
+					"version":     "1.3.0",
+					"description": "String left pad",
+					"date":        "2018-04-09T01:20:46.654Z",
+					"publisher":   map[string]string{"username": "stevemao"},
+				}},
+				map[string]interface{}{"package": map[string]interface{}{
+					"name":        "@corp/pad",
+					"version":     "0.1.0",
+					"description": strings.Repeat("very long description ", 5),
+				}},
+			},
+			"total": 2,
+		})
+	}))
+	defer server.Close()
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+	defer isolateNpmConfig(dir)()
+
+	out, err := captureOutput(func() error {
+		return lib.SearchCmdRun([]string{"-C", dir, "-registry", server.URL, "-size", "5", "left", "pad"})
+	})
+	test.Assert(err, nil)
+	test.Assert(strings.Join(queries, " "), "text=left+pad&size=5")
+
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	test.Assert(len(lines), 3, out)
+	test.Assert(strings.Join(strings.Fields(lines[0]), " "), "NAME VERSION DATE PUBLISHER DESCRIPTION")
+	test.Assert(strings.Join(strings.Fields(lines[1]), " "), "left-pad 1.3.0 2018-04-09 stevemao String left pad")
+	test.Assert(strings.HasPrefix(lines[2], "@corp/pad"), true, lines[2])
+	test.Assert(strings.HasSuffix(lines[2], "very long description very long des..."), true, lines[2])
+
+	out, err = captureOutput(func() error {
+		return lib.SearchCmdRun([]string{"-C", dir, "-registry", server.URL, "-json", "pad"})
+	})
+	test.Assert(err, nil)
+
+	results := []*lib.SearchPackage{}
+	test.Assert(json.Unmarshal([]byte(out), &results), nil, out)
+	test.Assert(len(results), 2)
+	test.Assert(results[0].Name, "left-pad")
+	test.Assert(results[0].Publisher.Username, "stevemao")
+}
+
+func TestView(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+
+	reg.Publish("foo", "1.0.0", map[string]interface{}{"license": "MIT"})
+	reg.Publish("foo", "1.2.0", map[string]interface{}{
+		"license":      "MIT",
+		"description":  "A basic library for parsing tokens",
+		"dependencies": map[string]string{"bar": "^2.0.0", "baz": "~1.0.0", "csrf-token": "^3.1.0"},
+		"maintainers":  []interface{}{map[string]string{"name": "alice", "email": "alice@example.com"}},
+		"deprecated":   "Use foo@2",
+	})
+	reg.Publish("foo", "2.0.0", map[string]interface{}{"license": "ISC"})
+	reg.Publish("foo", "10.0.0-beta.1", nil)
+	reg.DistTags["foo"]["latest"] = "2.0.0"
+	reg.DistTags["foo"]["next"] = "10.0.0-beta.1"
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+	defer isolateNpmConfig(dir)()
+
+	view := func(args ...string) string {
+		out, err := captureOutput(func() error {
+			return lib.ViewCmdRun(append([]string{"-C", dir, "-registry", reg.URL}, args...))
+		})
+		test.Assert(err, nil, args)
+		return strings.TrimRight(out, "\n")
+	}
+
+	type TableEntry struct {
+		args     []string
+		expected string
+	}
+
+	table := []TableEntry{
+		TableEntry{[]string{"foo", "version"}, "2.0.0"},
+		TableEntry{[]string{"foo@^1.0.0", "version"}, "1.2.0"},
+		TableEntry{[]string{"foo@1.0.0", "version"}, "1.0.0"},
+		TableEntry{[]string{"foo@next", "version"}, "10.0.0-beta.1"},
+		TableEntry{[]string{"foo@1", "deprecated"}, "Use foo@2"},
+		TableEntry{[]string{"foo@1", "dependencies.bar"}, "^2.0.0"},
+		TableEntry{[]string{"foo@1", "dependencies.csrf-token"}, "^3.1.0"},
+		TableEntry{[]string{"foo", "dist-tags.next"}, "10.0.0-beta.1"},
+		TableEntry{[]string{"foo", "dist.tarball"}, reg.URL + reg.TarballPrefix + "/foo/-/foo-2.0.0.tgz"},
+		TableEntry{[]string{"foo", "missing"}, ""},
+		TableEntry{[]string{"foo", "versions"}, "[\n  \"1.0.0\",\n  \"1.2.0\",\n  \"2.0.0\",\n  \"10.0.0-beta.1\"\n]"},
+		TableEntry{[]string{"-json", "foo", "version"}, "\"2.0.0\""},
+		TableEntry{[]string{"foo@1", "version", "license"}, "version = 1.2.0\nlicense = MIT"},
+	}
+
+	for _, entry := range table {
+		test.Assert(view(entry.args...), entry.expected, entry.args)
+	}
+
+	summary := view("foo@~1.2")
+	for _, line := range []string{
+		"foo@1.2.0 | MIT | deps: 3 | versions: 4",
+		"A basic library for parsing tokens",
+		"DEPRECATED: Use foo@2",
+		".tarball: " + reg.URL + reg.TarballPrefix + "/foo/-/foo-1.2.0.tgz",
+		"bar: ^2.0.0",
+		"csrf-token: ^3.1.0",
+		"- alice <alice@example.com>",
+		"latest: 2.0.0",
+	} {
+		test.Assert(strings.Contains(summary, line+"\n") || strings.HasSuffix(summary, line), true, line, summary)
+	}
+
+	doc := map[string]interface{}{}
+	test.Assert(json.Unmarshal([]byte(view("-json", "foo@2")), &doc), nil)
+	test.Assert(doc["version"], "2.0.0")
+	test.Assert(doc["license"], "ISC")
+
+	// command output is registry data, only registered secrets are masked
+	doc = map[string]interface{}{}
+	test.Assert(json.Unmarshal([]byte(view("-json", "foo@1.2.0")), &doc), nil)
+	test.Assert(doc["description"], "A basic library for parsing tokens")
+	test.Assert(doc["dependencies"].(map[string]interface{})["csrf-token"], "^3.1.0")
+
+	_, err := captureOutput(func() error {
+		return lib.ViewCmdRun([]string{"-C", dir, "-registry", reg.URL, "foo@^3.0.0"})
+	})
+	test.Assert(err != nil, true)
+
+	_, err = captureOutput(func() error {
+		return lib.ViewCmdRun([]string{"-C", dir, "-registry", reg.URL, "nope"})
+	})
+	test.Assert(err != nil, true)
+}
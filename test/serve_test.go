@@ -0,0 +1,244 @@
+package test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// getServed returns status and body of a GET request
+func getServed(test *testutil.TestUtil, url string) (int, []byte) {
+	res, err := http.Get(url)
+	test.Assert(err, nil, url)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	test.Assert(err, nil, url)
+	return res.StatusCode, body
+}
+
+// getServedPackument returns packument served at url
+func getServedPackument(test *testutil.TestUtil, url string) *lib.Packument {
+	status, body := getServed(test, url)
+	test.Assert(status, http.StatusOK, url)
+
+	packument := &lib.Packument{}
+	test.Assert(json.Unmarshal(body, packument), nil, url)
+	return packument
+}
+
+func TestServeCache(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+	reg.Publish("foo", "1.1.0", nil)
+	reg.Publish("@scope/bar", "2.0.0", map[string]interface{}{
+		"dependencies": map[string]string{"foo": "1.0.0"},
+	})
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	// populate the cache
+	app := path.Join(dir, "app")
+	home := path.Join(dir, "home")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.1.0", "@scope/bar": "2.0.0"}}`)
+	err := lib.InstallCmdRun([]string{"-C", app, "-frosty-home", home, "-registry", reg.URL, "-package"})
+	test.Assert(err, nil)
+
+	cache, err := lib.LoadCache(path.Join(home, "cache"))
+	test.Assert(err, nil)
+	server := httptest.NewServer(lib.NewCacheRegistry(cache, nil))
+	defer server.Close()
+
+	packument := getServedPackument(test, server.URL+"/foo")
+	test.Assert(len(packument.Versions), 2)
+	test.Assert(packument.DistTags["latest"], "1.1.0")
+
+	manifest := packument.Versions["1.1.0"]
+	test.Assert(manifest.Dist.Tarball, server.URL+"/foo/-/foo-1.1.0.tgz")
+	test.Assert(strings.HasPrefix(manifest.Dist.Integrity, "sha512-"), true)
+
+	// tarballs are packed on the fly, always to the same bytes
+	status, tarball := getServed(test, manifest.Dist.Tarball)
+	test.Assert(status, http.StatusOK)
+	sum := sha1.Sum(tarball)
+	test.Assert(hex.EncodeToString(sum[:]), manifest.Dist.Shasum)
+	_, again := getServed(test, manifest.Dist.Tarball)
+	test.Assert(string(again), string(tarball))
+
+	scoped := getServedPackument(test, server.URL+"/@scope%2fbar")
+	test.Assert(scoped.Versions["2.0.0"].Dist.Tarball, server.URL+"/@scope/bar/-/bar-2.0.0.tgz")
+
+	type TableEntry struct {
+		method string
+		url    string
+		status int
+	}
+
+	table := []TableEntry{
+		TableEntry{"GET", "/-/ping", http.StatusOK},
+		TableEntry{"GET", "/missing", http.StatusNotFound},
+		TableEntry{"GET", "/foo/-/foo-9.9.9.tgz", http.StatusNotFound},
+		TableEntry{"GET", "/foo/bar", http.StatusNotFound},
+		TableEntry{"HEAD", "/foo", http.StatusOK},
+		TableEntry{"PUT", "/foo", http.StatusMethodNotAllowed},
+		TableEntry{"DELETE", "/foo/-/foo-1.0.0.tgz", http.StatusMethodNotAllowed},
+	}
+
+	for _, entry := range table {
+		req, err := http.NewRequest(entry.method, server.URL+entry.url, nil)
+		test.Assert(err, nil)
+		res, err := http.DefaultClient.Do(req)
+		test.Assert(err, nil, entry.method, entry.url)
+		res.Body.Close()
+		test.Assert(res.StatusCode, entry.status, entry.method, entry.url)
+	}
+
+	// a fresh frosty home installs from the served cache alone
+	reg.Close()
+	other := path.Join(dir, "other")
+	writeJSON(test, path.Join(other, "package.json"), `{"name": "other", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0", "@scope/bar": "^2.0.0"}}`)
+	err = lib.InstallCmdRun([]string{"-C", other, "-frosty-home", path.Join(dir, "home2"),
+		"-registry", server.URL, "-package"})
+	test.Assert(err, nil)
+
+	pkg, err := lib.LoadPackageFromDir(path.Join(other, "node_modules", "foo"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "1.1.0")
+	pkg, err = lib.LoadPackageFromDir(path.Join(other, "node_modules", "@scope", "bar"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "2.0.0")
+}
+
+func TestServeUpstream(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	cache, err := lib.LoadCache(path.Join(dir, "cache"))
+	test.Assert(err, nil)
+
+	upstream := lib.NewNpmRegistryClient(reg.URL, "")
+	upstream.Retries = 0
+	server := httptest.NewServer(lib.NewCacheRegistry(cache, upstream))
+	defer server.Close()
+
+	// upstream versions are listed, with tarballs served through the cache
+	packument := getServedPackument(test, server.URL+"/foo")
+	manifest := packument.Versions["1.0.0"]
+	test.Assert(manifest.Dist.Tarball, server.URL+"/foo/-/foo-1.0.0.tgz")
+	test.Assert(cache.Contains("foo", "1.0.0"), false)
+
+	// the upstream tarball is passed through unchanged, and cached
+	status, tarball := getServed(test, manifest.Dist.Tarball)
+	test.Assert(status, http.StatusOK)
+	sum := sha1.Sum(tarball)
+	test.Assert(hex.EncodeToString(sum[:]), manifest.Dist.Shasum)
+	test.Assert(cache.Contains("foo", "1.0.0"), true)
+
+	reloaded, err := lib.LoadCache(path.Join(dir, "cache"))
+	test.Assert(err, nil)
+	test.Assert(reloaded.Contains("foo", "1.0.0"), true)
+
+	status, _ = getServed(test, server.URL+"/foo/-/foo-2.0.0.tgz")
+	test.Assert(status, http.StatusNotFound)
+
+	// cached packages are still served once upstream is gone
+	reg.Close()
+	packument = getServedPackument(test, server.URL+"/foo")
+	test.Assert(packument.DistTags["latest"], "1.0.0")
+	status, tarball = getServed(test, packument.Versions["1.0.0"].Dist.Tarball)
+	test.Assert(status, http.StatusOK)
+	sum = sha1.Sum(tarball)
+	test.Assert(hex.EncodeToString(sum[:]), packument.Versions["1.0.0"].Dist.Shasum)
+}
+
+func TestServeOriginalTarball(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", map[string]interface{}{
+		"scripts":     map[string]string{"postinstall": "echo built > built.txt", "test": "true"},
+		"description": "foo",
+	})
+	reg.Publish("bar", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	restore := setEnv(map[string]string{
+		"NPM_CONFIG_USERCONFIG":   path.Join(dir, "none"),
+		"NPM_CONFIG_GLOBALCONFIG": path.Join(dir, "none"),
+		"NPM_REGISTRY_URL":        "",
+		"NPM_TOKEN":               "",
+	})
+	defer restore()
+
+	app := path.Join(dir, "app")
+	home := path.Join(dir, "home")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "1.0.0", "bar": "1.0.0"}}`)
+	err := lib.InstallCmdRun([]string{"-C", app, "-frosty-home", home, "-registry", reg.URL, "-package"})
+	test.Assert(err, nil)
+	test.Assert(test.IsFile(path.Join(app, "node_modules", "foo", "built.txt")), true)
+
+	cache, err := lib.LoadCache(path.Join(home, "cache"))
+	test.Assert(err, nil)
+	server := httptest.NewServer(lib.NewCacheRegistry(cache, nil))
+	defer server.Close()
+
+	// the cached directory ran postinstall, but the tarball is served as
+	// published, with the published checksums and manifest
+	packument := getServedPackument(test, server.URL+"/foo")
+	manifest := packument.Versions["1.0.0"]
+	published := reg.Manifests["foo"]["1.0.0"]["dist"].(map[string]interface{})
+	test.Assert(manifest.Dist.Integrity, published["integrity"])
+	test.Assert(manifest.Dist.Shasum, published["shasum"])
+
+	status, body := getServed(test, server.URL+"/foo")
+	test.Assert(status, http.StatusOK)
+	test.Assert(strings.Contains(string(body), `"test":"true"`), true, string(body))
+	test.Assert(strings.Contains(string(body), `"_resolved"`), false, string(body))
+
+	status, tarball := getServed(test, manifest.Dist.Tarball)
+	test.Assert(status, http.StatusOK)
+	test.Assert(string(tarball), string(reg.Tarballs["/files/foo/-/foo-1.0.0.tgz"]))
+
+	// versions cached without their tarball are not served
+	cacheDir, err := cache.GetPath("bar", "1.0.0")
+	test.Assert(err, nil)
+	test.Assert(os.Remove(lib.TarballPath(cacheDir)), nil)
+
+	status, _ = getServed(test, server.URL+"/bar")
+	test.Assert(status, http.StatusNotFound)
+	status, _ = getServed(test, server.URL+"/bar/-/bar-1.0.0.tgz")
+	test.Assert(status, http.StatusNotFound)
+}
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestInstallWritesShrinkwrap(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", map[string]interface{}{
+		"dependencies": map[string]interface{}{"bar": ">=2.0.0 <3"},
+	})
+	reg.Publish("bar", "2.0.0", nil)
+	reg.Publish("@scope/baz", "1.0.0", nil)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	app := path.Join(dir, "app")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0", "@scope/baz": "latest", "qux": "npm:bar@^2.0.0"}}`)
+
+	install := func(home string, args ...string) error {
+		return lib.InstallCmdRun(append([]string{"-C", app, "-frosty-home", path.Join(dir, home),
+			"-registry", reg.URL}, args...))
+	}
+
+	err := install("home1", "-package", "-save-package-lock")
+	test.Assert(err, nil)
+
+	contents, err := ioutil.ReadFile(path.Join(app, "npm-shrinkwrap.json"))
+	test.Assert(err, nil)
+	packageLock, err := ioutil.ReadFile(path.Join(app, "package-lock.json"))
+	test.Assert(err, nil)
+	test.Assert(string(packageLock), string(contents))
+
+	// keys are sorted, and ranges are not escaped
+	text := string(contents)
+	test.Assert(strings.Index(text, `"@scope/baz"`) < strings.Index(text, `"foo"`), true, text)
+	test.Assert(strings.Index(text, `"foo"`) < strings.Index(text, `"qux"`), true, text)
+	test.Assert(strings.Contains(text, `"bar": ">=2.0.0 <3"`), true, text)
+
+	shrinkwrap, err := lib.LoadShrinkwrapFile(path.Join(app, "npm-shrinkwrap.json"))
+	test.Assert(err, nil)
+	test.Assert(shrinkwrap.Name, "app")
+	test.Assert(shrinkwrap.LockfileVersion, 1)
+	test.Assert(len(shrinkwrap.Dependencies), 3)
+
+	foo := shrinkwrap.Dependencies["foo"]
+	test.Assert(foo.Version, "1.0.0")
+	test.Assert(foo.Resolved, reg.URL+"/files/foo/-/foo-1.0.0.tgz")
+	test.Assert(foo.Integrity[:7], "sha512-")
+	test.Assert(foo.Dev, false)
+	test.Assert(foo.Optional, false)
+	test.Assert(foo.Dependencies["bar"].Version, "2.0.0")
+	test.Assert(shrinkwrap.Dependencies["@scope/baz"].Version, "1.0.0")
+	test.Assert(shrinkwrap.Dependencies["qux"].Version, "npm:bar@2.0.0")
+
+	// frosty shrinkwrap writes the same file from node_modules
+	test.Assert(os.Remove(path.Join(app, "npm-shrinkwrap.json")), nil)
+	test.Assert(lib.ShrinkwrapCmdRun([]string{"-C", app}), nil)
+	regenerated, err := ioutil.ReadFile(path.Join(app, "npm-shrinkwrap.json"))
+	test.Assert(err, nil)
+	test.Assert(string(regenerated), text)
+
+	// newer versions are ignored once the tree is locked, and tarballs are
+	// fetched from where they were resolved, without resolving versions again
+	reg.Publish("foo", "1.5.0", nil)
+	packumentHits := reg.HitCount("/foo")
+	test.Assert(os.RemoveAll(path.Join(app, "node_modules")), nil)
+
+	err = install("home2")
+	test.Assert(err, nil)
+	test.Assert(reg.HitCount("/foo"), packumentHits)
+	test.Assert(reg.HitCount("/files/foo/-/foo-1.0.0.tgz"), 2)
+
+	pkg, err := lib.LoadPackageFromDir(path.Join(app, "node_modules", "foo"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "1.0.0")
+	test.Assert(pkg.Integrity, foo.Integrity)
+
+	pkg, err = lib.LoadPackageFromDir(path.Join(app, "node_modules", "foo", "node_modules", "bar"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "2.0.0")
+
+	pkg, err = lib.LoadPackageFromDir(path.Join(app, "node_modules", "qux"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Name, "bar")
+
+	after, err := ioutil.ReadFile(path.Join(app, "npm-shrinkwrap.json"))
+	test.Assert(err, nil)
+	test.Assert(string(after), text)
+}
+
+func TestBuildLockGraph(t *testing.T) {
+	test := testutil.New(t)
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	writeFiles(test, dir, map[string]string{
+		"package.json": `{"name": "root", "version": "1.0.0", "workspaces": ["packages/*"],
+			"dependencies": {"a": "^1.0.0", "opt": "^1.0.0"}, "optionalDependencies": {"opt": "^1.0.0"},
+			"devDependencies": {"test-lib": "^1.0.0"}}`,
+		"packages/ws/package.json": `{"name": "ws", "version": "0.1.0",
+			"dependencies": {"a": "^2.0.0"}, "devDependencies": {"ws-dev": "*"}}`,
+		"packages/ws/node_modules/a/package.json":  `{"name": "a", "version": "2.0.0"}`,
+		"node_modules/a/package.json":              `{"name": "a", "version": "1.0.0", "dependencies": {"shared": "*"}, "_resolved": "http://r/a-1.0.0.tgz", "_integrity": "sha512-a"}`,
+		"node_modules/opt/package.json":            `{"name": "opt", "version": "1.0.0", "dependencies": {"only-opt": "*"}}`,
+		"node_modules/only-opt/package.json":       `{"name": "only-opt", "version": "1.0.0"}`,
+		"node_modules/test-lib/package.json":       `{"name": "test-lib", "version": "1.0.0", "dependencies": {"shared": "*", "@s/dev-only": "*"}}`,
+		"node_modules/shared/package.json":         `{"name": "shared", "version": "1.0.0"}`,
+		"node_modules/@s/dev-only/package.json":    `{"name": "@s/dev-only", "version": "3.0.0"}`,
+		"node_modules/ws-dev/package.json":         `{"name": "ws-dev", "version": "1.0.0"}`,
+		"node_modules/.bin/placeholder":            "",
+		"node_modules/not-a-package/readme.md":     "",
+	})
+	test.Assert(os.Symlink("../packages/ws", path.Join(dir, "node_modules", "ws")), nil)
+
+	graph, err := lib.BuildLockGraph(dir)
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		path     string
+		version  string
+		dev      bool
+		optional bool
+	}
+
+	table := []TableEntry{
+		TableEntry{"node_modules/a", "1.0.0", false, false},
+		TableEntry{"node_modules/shared", "1.0.0", false, false},
+		TableEntry{"node_modules/opt", "1.0.0", false, true},
+		TableEntry{"node_modules/only-opt", "1.0.0", false, true},
+		TableEntry{"node_modules/test-lib", "1.0.0", true, false},
+		TableEntry{"node_modules/@s/dev-only", "3.0.0", true, false},
+		TableEntry{"node_modules/ws-dev", "1.0.0", true, false},
+		TableEntry{"node_modules/ws", "0.1.0", false, false},
+		TableEntry{"packages/ws/node_modules/a", "2.0.0", false, false},
+	}
+
+	test.Assert(len(graph.Packages), len(table)+2, graph.SortedPaths())
+	for _, entry := range table {
+		node := graph.Packages[entry.path]
+		test.Assert(node != nil, true, entry.path)
+		test.Assert(node.Version, entry.version, entry.path)
+		test.Assert(node.Dev, entry.dev, entry.path)
+		test.Assert(node.Optional, entry.optional, entry.path)
+	}
+
+	test.Assert(graph.Packages["node_modules/a"].Resolved, "http://r/a-1.0.0.tgz")
+	test.Assert(graph.Packages["node_modules/ws"].Link, true)
+	test.Assert(graph.Packages["node_modules/ws"].Resolved, "packages/ws")
+	test.Assert(graph.Packages["packages/ws"].Name, "ws")
+
+	// the nested format records links by location
+	shrinkwrap := lib.NewShrinkwrap(graph)
+	test.Assert(shrinkwrap.Dependencies["ws"].Version, "file:packages/ws")
+	test.Assert(shrinkwrap.Dependencies["@s/dev-only"].Dev, true)
+	test.Assert(shrinkwrap.Dependencies["a"].Requires["shared"], "*")
+
+	file := path.Join(dir, "npm-shrinkwrap.json")
+	test.Assert(shrinkwrap.Write(file), nil)
+	loaded, err := lib.LoadShrinkwrapFile(file)
+	test.Assert(err, nil)
+
+	roundTrip := loaded.Graph()
+	test.Assert(roundTrip.Packages["node_modules/a"].Integrity, "sha512-a")
+	test.Assert(roundTrip.Packages["node_modules/ws"].Resolved, "file:packages/ws")
+	test.Assert(roundTrip.Packages["node_modules/ws"].Version, "")
+	test.Assert(roundTrip.Packages["node_modules/test-lib"].Dev, true)
+
+	bytes, err := json.Marshal(lib.NewShrinkwrap(roundTrip))
+	test.Assert(err, nil)
+	expected, err := json.Marshal(shrinkwrap)
+	test.Assert(err, nil)
+	test.Assert(string(bytes), string(expected))
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	test := testutil.New(t)
+
+	type TableEntry struct {
+		Raw      string
+		Type     lib.SpecType
+		Expected string
+	}
+	table := []TableEntry{
+		// registry
+		TableEntry{"1.0.0", lib.VersionSpec, "1.0.0"},
+		TableEntry{"v1.2.3", lib.VersionSpec, "1.2.3"},
+		TableEntry{"1.0.0-beta.1", lib.VersionSpec, "1.0.0-beta.1"},
+		TableEntry{"^1.0.0", lib.RangeSpec, "^1.0.0"},
+		TableEntry{"~1.2", lib.RangeSpec, "~1.2"},
+		TableEntry{"1.x", lib.RangeSpec, "1.x"},
+		TableEntry{"x", lib.RangeSpec, "x"},
+		TableEntry{"*", lib.RangeSpec, "*"},
+		TableEntry{"", lib.RangeSpec, "*"},
+		TableEntry{">=1.0.0 <2.0.0", lib.RangeSpec, ">=1.0.0 <2.0.0"},
+		TableEntry{"1 || 2", lib.RangeSpec, "1 || 2"},
+		TableEntry{"latest", lib.TagSpec, "latest"},
+		TableEntry{"next", lib.TagSpec, "next"},
+		TableEntry{"beta1", lib.TagSpec, "beta1"},
+
+		// remote
+		TableEntry{"https://foo.com/foo.tgz", lib.TarballSpec, "https://foo.com/foo.tgz"},
+		TableEntry{"http://foo.com/foo.tar.gz", lib.TarballSpec, "http://foo.com/foo.tar.gz"},
+		TableEntry{"http://foo.com/download", lib.TarballSpec, "http://foo.com/download"},
+		TableEntry{"git+ssh://git@foo.com/foo.git#v1.0.0", lib.GitSpec, "ssh://git@foo.com/foo.git"},
+		TableEntry{"git+https://foo.com/foo.git", lib.GitSpec, "https://foo.com/foo.git"},
+		TableEntry{"git://foo.com/foo.git#main", lib.GitSpec, "git://foo.com/foo.git"},
+		TableEntry{"user/repo", lib.HostedGitSpec, "github:user/repo"},
+		TableEntry{"github:user/repo#v1.2.0", lib.HostedGitSpec, "github:user/repo#v1.2.0"},
+		TableEntry{"gitlab:group/proj", lib.HostedGitSpec, "gitlab:group/proj"},
+		TableEntry{"bitbucket:team/lib", lib.HostedGitSpec, "bitbucket:team/lib"},
+
+		// local
+		TableEntry{"file:../lib", lib.DirectorySpec, "../lib"},
+		TableEntry{"../lib", lib.DirectorySpec, "../lib"},
+		TableEntry{"./vendor/foo", lib.DirectorySpec, "./vendor/foo"},
+		TableEntry{"/abs/foo", lib.DirectorySpec, "/abs/foo"},
+		TableEntry{"file:../foo-1.0.0.tgz", lib.FileSpec, "../foo-1.0.0.tgz"},
+		TableEntry{"./foo.tar.gz", lib.FileSpec, "./foo.tar.gz"},
+
+		// alias
+		TableEntry{"npm:lodash@^4.17.0", lib.AliasSpec, "lodash@^4.17.0"},
+		TableEntry{"npm:@scope/foo@1.0.0", lib.AliasSpec, "@scope/foo@1.0.0"},
+		TableEntry{"npm:lodash", lib.AliasSpec, "lodash@"},
+
+		// workspace
+		TableEntry{"workspace:*", lib.WorkspaceSpec, "*"},
+		TableEntry{"workspace:^1.0.0", lib.WorkspaceSpec, "^1.0.0"},
+		TableEntry{"workspace:", lib.WorkspaceSpec, "*"},
+	}
+
+	for _, entry := range table {
+		spec, err := lib.ParseSpec("foo", entry.Raw)
+		test.Assert(err, nil, entry.Raw)
+		if err != nil {
+			continue
+		}
+		test.Assert(spec.Name, "foo", entry.Raw)
+		test.Assert(spec.Type, entry.Type, entry.Raw)
+
+		actual := ""
+		switch spec.Type {
+		case lib.VersionSpec:
+			actual = spec.Version
+		case lib.RangeSpec, lib.WorkspaceSpec:
+			actual = spec.Range.Raw
+		case lib.TagSpec:
+			actual = spec.Tag
+		case lib.TarballSpec, lib.GitSpec:
+			actual = spec.URL
+		case lib.HostedGitSpec:
+			actual = spec.Hosted.String()
+		case lib.FileSpec, lib.DirectorySpec:
+			actual = spec.Path
+		case lib.AliasSpec:
+			actual = spec.Alias.String()
+		}
+		test.Assert(actual, entry.Expected, entry.Raw)
+	}
+}
+
+func TestParseSpecCommittish(t *testing.T) {
+	test := testutil.New(t)
+
+	type TableEntry struct {
+		Raw        string
+		Committish string
+		Cacheable  bool
+	}
+
+	// only commits are cacheable, branches and tags move
+	table := []TableEntry{
+		TableEntry{"git+ssh://git@foo.com/foo.git#v1.0.0", "v1.0.0", false},
+		TableEntry{"git+https://foo.com/foo.git", "", false},
+		TableEntry{"git+https://foo.com/foo.git#main", "main", false},
+		TableEntry{"github:user/repo#abc123", "abc123", false},
+		TableEntry{"github:user/repo#b56b83ed395074afc90493dbc376a5fdb50964bf",
+			"b56b83ed395074afc90493dbc376a5fdb50964bf", true},
+		TableEntry{"user/repo", "", false},
+	}
+
+	for _, entry := range table {
+		spec, err := lib.ParseSpec("foo", entry.Raw)
+		test.Assert(err, nil, entry.Raw)
+		test.Assert(spec.Committish, entry.Committish, entry.Raw)
+		test.Assert(spec.Cacheable(), entry.Cacheable, entry.Raw)
+	}
+}
+
+func TestParseSpecInvalid(t *testing.T) {
+	test := testutil.New(t)
+
+	invalid := []string{
+		">=",
+		"1.0.0 ||",
+		"npm:",
+		"file:",
+		"git+https://example.com/repo.git#--orphan",
+	}
+
+	for _, raw := range invalid {
+		_, err := lib.ParseSpec("foo", raw)
+		test.Assert(err != nil, true, raw)
+	}
+}
+
+func TestSplitNameSpec(t *testing.T) {
+	test := testutil.New(t)
+
+	type TableEntry struct {
+		Input string
+		Name  string
+		Spec  string
+	}
+	table := []TableEntry{
+		TableEntry{"foo@^1.0.0", "foo", "^1.0.0"},
+		TableEntry{"@scope/foo@1.0.0", "@scope/foo", "1.0.0"},
+		TableEntry{"@scope/foo", "@scope/foo", ""},
+		TableEntry{"foo", "foo", ""},
+	}
+
+	for _, entry := range table {
+		name, spec := lib.SplitNameSpec(entry.Input)
+		test.Assert(name, entry.Name, entry.Input)
+		test.Assert(spec, entry.Spec, entry.Input)
+	}
+}
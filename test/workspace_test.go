@@ -0,0 +1,115 @@
+package test
+
+import (
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func writeJSON(test *testutil.TestUtil, file string, contents string) {
+	err := os.MkdirAll(path.Dir(file), os.ModePerm)
+	test.Assert(err, nil)
+	err = ioutil.WriteFile(file, []byte(contents), os.ModePerm)
+	test.Assert(err, nil)
+}
+
+func createMonorepo(test *testutil.TestUtil, workspaces string) string {
+	dir, _ := test.TempDir()
+	writeJSON(test, path.Join(dir, "package.json"),
+		`{"name": "root", "version": "1.0.0", "workspaces": `+workspaces+`}`)
+	writeJSON(test, path.Join(dir, "packages", "a", "package.json"),
+		`{"name": "a", "version": "1.0.0", "dependencies": {"@co/b": "workspace:*"}, "scripts": {"build": "echo a"}}`)
+	writeJSON(test, path.Join(dir, "packages", "b", "package.json"),
+		`{"name": "@co/b", "version": "2.1.0", "bin": {"b-tool": "./cli.js"}}`)
+	writeJSON(test, path.Join(dir, "packages", "b", "cli.js"), "")
+	writeJSON(test, path.Join(dir, "packages", "private", "package.json"),
+		`{"name": "private", "version": "0.0.1"}`)
+	return dir
+}
+
+func TestLoadWorkspaces(t *testing.T) {
+	test := testutil.New(t)
+
+	for _, workspaces := range []string{
+		`["packages/*", "!packages/private"]`,
+		`{"packages": ["packages/*", "!packages/private"]}`,
+	} {
+		dir := createMonorepo(test, workspaces)
+		defer os.RemoveAll(dir)
+
+		root, err := lib.LoadPackageFromDir(dir)
+		test.Assert(err, nil)
+		test.Assert(len(root.Workspaces), 2, workspaces)
+
+		found, err := lib.LoadWorkspaces(root)
+		test.Assert(err, nil)
+		test.Assert(len(found), 2, workspaces)
+		test.Assert(found["a"].Dir, path.Join(dir, "packages", "a"))
+		test.Assert(found["@co/b"].Package.Version, "2.1.0")
+
+		names := lib.SortedWorkspaceNames(found)
+		test.Assert(names[0], "@co/b")
+		test.Assert(names[1], "a")
+
+		ws, err := lib.FindWorkspace(found, dir, "packages/a")
+		test.Assert(err, nil)
+		test.Assert(ws.Name, "a")
+
+		_, err = lib.FindWorkspace(found, dir, "private")
+		test.Assert(err != nil, true)
+	}
+}
+
+func TestWorkspaceSatisfies(t *testing.T) {
+	test := testutil.New(t)
+	ws := &lib.Workspace{Name: "b", Package: &lib.Package{Version: "2.1.0"}}
+
+	table := map[string]bool{
+		"workspace:*":      true,
+		"workspace:^2.0.0": true,
+		"workspace:^1.0.0": false,
+		"^2.0.0":           true,
+		"2.1.0":            true,
+		"~2.0.0":           false,
+		"latest":           true,
+		"next":             false,
+		"file:../b":        false,
+	}
+
+	for raw, expected := range table {
+		spec, err := lib.ParseSpec("b", raw)
+		test.Assert(err, nil, raw)
+		test.Assert(ws.Satisfies(spec), expected, raw)
+	}
+}
+
+func TestInstallWorkspaces(t *testing.T) {
+	test := testutil.New(t)
+
+	dir := createMonorepo(test, `["packages/*", "!packages/private"]`)
+	defer os.RemoveAll(dir)
+	home, cleanup := test.TempDir()
+	defer cleanup()
+
+	err := lib.InstallCmdRun([]string{"-C", dir, "-frosty-home", home, "-package"})
+	test.Assert(err, nil)
+
+	nodeModules := path.Join(dir, "node_modules")
+	target, err := os.Readlink(path.Join(nodeModules, "a"))
+	test.Assert(err, nil)
+	test.Assert(target, "../packages/a")
+
+	target, err = os.Readlink(path.Join(nodeModules, "@co", "b"))
+	test.Assert(err, nil)
+	test.Assert(target, "../../packages/b")
+
+	target, err = os.Readlink(path.Join(nodeModules, ".bin", "b-tool"))
+	test.Assert(err, nil)
+	test.Assert(target, "../@co/b/cli.js")
+	test.AssertFile(path.Join(nodeModules, ".bin", "b-tool"))
+
+	test.Assert(test.IsDir(path.Join(nodeModules, "private")), false)
+}
@@ -0,0 +1,237 @@
+package test
+
+import (
+	"fmt"
+	"github.com/sethmcl/gofrosty/lib"
+	"github.com/sethmcl/gofrosty/lib/testutil"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const yarnLockFixture = `# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@scope/foo@^1.0.0", "@scope/foo@^1.1.0":
+  version "1.2.0"
+  resolved "https://registry.yarnpkg.com/@scope/foo/-/foo-1.2.0.tgz#0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33"
+  dependencies:
+    bar "~2.0.0"
+  optionalDependencies:
+    fsevents "^1.0.0"
+
+bar@~2.0.0:
+  version "2.0.1"
+  resolved "https://registry.yarnpkg.com/bar/-/bar-2.0.1.tgz#62cdb7020ff920e5aa642c3d4066950dd1f01f4d"
+  integrity sha512-abc==
+
+"baz@npm:bar@^2.0.0":
+  version "2.0.1"
+  resolved "https://registry.yarnpkg.com/bar/-/bar-2.0.1.tgz"
+`
+
+func TestParseYarnLock(t *testing.T) {
+	test := testutil.New(t)
+
+	lock, err := lib.ParseYarnLock([]byte(yarnLockFixture))
+	test.Assert(err, nil)
+	test.Assert(len(lock.Entries), 4)
+
+	foo, ok := lock.Find("@scope/foo", "^1.1.0")
+	test.Assert(ok, true)
+	test.Assert(foo.Name, "@scope/foo")
+	test.Assert(strings.Join(foo.Patterns, ","), "@scope/foo@^1.0.0,@scope/foo@^1.1.0")
+	test.Assert(foo.Version, "1.2.0")
+	test.Assert(foo.Dependencies["bar"], "~2.0.0")
+	test.Assert(foo.OptionalDependencies["fsevents"], "^1.0.0")
+
+	other, _ := lock.Find("@scope/foo", "^1.0.0")
+	test.Assert(other == foo, true)
+
+	// the sha1 in resolved URLs stands in for a missing integrity
+	resolved, integrity := foo.ResolvedIntegrity()
+	test.Assert(resolved, "https://registry.yarnpkg.com/@scope/foo/-/foo-1.2.0.tgz")
+	test.Assert(integrity, "sha1-C+7Hteo/D9vJXQ3UfzxbwnXaijM=")
+
+	bar, _ := lock.Find("bar", "~2.0.0")
+	resolved, integrity = bar.ResolvedIntegrity()
+	test.Assert(resolved, "https://registry.yarnpkg.com/bar/-/bar-2.0.1.tgz")
+	test.Assert(integrity, "sha512-abc==")
+
+	baz, ok := lock.Find("baz", "npm:bar@^2.0.0")
+	test.Assert(ok, true)
+	test.Assert(baz.Name, "bar")
+
+	_, err = lib.ParseYarnLock([]byte("__metadata:\n  version: 6\n"))
+	test.Assert(err != nil, true)
+	_, err = lib.ParseYarnLock([]byte("  version \"1.0.0\"\n"))
+	test.Assert(err != nil, true)
+}
+
+func TestYarnLockGraph(t *testing.T) {
+	test := testutil.New(t)
+
+	lock, err := lib.ParseYarnLock([]byte(`
+a@^1.0.0:
+  version "1.0.0"
+  dependencies:
+    foo "^2.0.0"
+    shared "^1.0.0"
+
+b@^1.0.0:
+  version "1.0.0"
+  dependencies:
+    shared "^1.0.0"
+
+foo@^1.0.0:
+  version "1.0.0"
+
+foo@^2.0.0:
+  version "2.0.0"
+
+shared@^1.0.0:
+  version "1.1.0"
+
+dev@^1.0.0:
+  version "1.0.0"
+`))
+	test.Assert(err, nil)
+
+	root := &lib.Package{
+		Name:            "app",
+		Dependencies:    map[string]string{"a": "^1.0.0", "b": "^1.0.0", "foo": "^1.0.0"},
+		DevDependencies: map[string]string{"dev": "^1.0.0"},
+	}
+	test.Assert(len(lock.Missing(root, nil)), 0)
+
+	graph, err := lock.Graph(root, nil)
+	test.Assert(err, nil)
+
+	layout := []string{}
+	for _, p := range graph.SortedPaths()[1:] {
+		node := graph.Packages[p]
+		layout = append(layout, fmt.Sprintf("%s@%s dev=%v", p, node.Version, node.Dev))
+	}
+
+	// shared is hoisted and deduped, the second foo nests under a
+	test.Assert(strings.Join(layout, "\n"), strings.Join([]string{
+		"node_modules/a@1.0.0 dev=false",
+		"node_modules/a/node_modules/foo@2.0.0 dev=false",
+		"node_modules/b@1.0.0 dev=false",
+		"node_modules/dev@1.0.0 dev=true",
+		"node_modules/foo@1.0.0 dev=false",
+		"node_modules/shared@1.1.0 dev=false",
+	}, "\n"))
+
+	root.Dependencies["c"] = "^1.0.0"
+	root.DevDependencies["dev"] = "^2.0.0"
+	missing := lock.Missing(root, nil)
+	sort.Strings(missing)
+	test.Assert(strings.Join(missing, ","), "c@^1.0.0,dev@^2.0.0")
+}
+
+// writeYarnLock writes a yarn.lock which resolves each name@spec pattern to
+// a version published to the fake registry
+func writeYarnLock(test *testutil.TestUtil, file string, reg *fakeRegistry, entries map[string]string) {
+	patterns := []string{}
+	for pattern := range entries {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	lines := []string{"# yarn lockfile v1", ""}
+	for _, pattern := range patterns {
+		name := pattern[:strings.Index(pattern[1:], "@")+1]
+		version := entries[pattern]
+		dist := reg.Manifests[name][version]["dist"].(map[string]interface{})
+
+		lines = append(lines, fmt.Sprintf("%q:", pattern))
+		lines = append(lines, fmt.Sprintf("  version %q", version))
+		lines = append(lines, fmt.Sprintf("  resolved \"%s#%s\"", dist["tarball"], dist["shasum"]))
+		if deps, ok := reg.Manifests[name][version]["dependencies"].(map[string]interface{}); ok {
+			lines = append(lines, "  dependencies:")
+			for dep, spec := range deps {
+				lines = append(lines, fmt.Sprintf("    %s %q", dep, spec))
+			}
+		}
+		lines = append(lines, "")
+	}
+
+	test.Assert(ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")), 0644), nil)
+}
+
+func TestInstallFromYarnLock(t *testing.T) {
+	test := testutil.New(t)
+
+	reg := newFakeRegistry()
+	defer reg.Close()
+	reg.Publish("foo", "1.0.0", nil)
+	reg.Publish("foo", "1.1.0", nil)
+	reg.Publish("foo", "2.0.0", nil)
+	reg.Publish("qux", "1.0.0", nil)
+	reg.Publish("bar", "1.0.0", map[string]interface{}{"dependencies": map[string]interface{}{"foo": "^2.0.0"}})
+
+	dir, cleanup := test.TempDir()
+	defer cleanup()
+
+	app := path.Join(dir, "app")
+	home := path.Join(dir, "home")
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0", "bar": "^1.0.0"}}`)
+
+	// foo is pinned below the latest version matching ^1.0.0
+	yarnLock := path.Join(app, "yarn.lock")
+	writeYarnLock(test, yarnLock, reg, map[string]string{
+		"foo@^1.0.0": "1.0.0",
+		"foo@^2.0.0": "2.0.0",
+		"bar@^1.0.0": "1.0.0",
+	})
+	test.Assert(lib.FindLockfile(app), yarnLock)
+
+	contents, err := ioutil.ReadFile(yarnLock)
+	test.Assert(err, nil)
+
+	err = lib.InstallCmdRun([]string{"-C", app, "-frosty-home", home, "-registry", reg.URL})
+	test.Assert(err, nil)
+
+	type TableEntry struct {
+		path    string
+		version string
+	}
+
+	table := []TableEntry{
+		TableEntry{"node_modules/foo", "1.0.0"},
+		TableEntry{"node_modules/bar", "1.0.0"},
+		TableEntry{"node_modules/bar/node_modules/foo", "2.0.0"},
+	}
+
+	for _, entry := range table {
+		pkg, err := lib.LoadPackageFromDir(path.Join(app, entry.path))
+		test.Assert(err, nil, entry.path)
+		test.Assert(pkg.Version, entry.version, entry.path)
+	}
+
+	// versions come from yarn.lock, which is left alone, and no npm lockfile
+	// is added to the project
+	test.Assert(reg.HitCount("/foo"), 0)
+	test.Assert(test.IsFile(path.Join(app, "npm-shrinkwrap.json")), false)
+	test.Assert(test.IsFile(path.Join(app, "package-lock.json")), false)
+	after, err := ioutil.ReadFile(yarnLock)
+	test.Assert(err, nil)
+	test.Assert(string(after), string(contents))
+
+	// once package.json declares a dependency yarn.lock has not resolved,
+	// modules are resolved from package.json
+	writeJSON(test, path.Join(app, "package.json"), `{"name": "app", "version": "1.0.0",
+		"dependencies": {"foo": "^1.0.0", "bar": "^1.0.0", "qux": "^1.0.0"}}`)
+	err = lib.InstallCmdRun([]string{"-C", app, "-frosty-home", home, "-registry", reg.URL})
+	test.Assert(err, nil)
+
+	pkg, err := lib.LoadPackageFromDir(path.Join(app, "node_modules", "qux"))
+	test.Assert(err, nil)
+	test.Assert(pkg.Version, "1.0.0")
+	test.Assert(reg.HitCount("/qux") > 0, true)
+}